@@ -0,0 +1,81 @@
+/*
+Copyright © 2021 FairwindsOps Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"encoding/json"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+
+	"github.com/fairwindsops/gonogo/pkg/bundle"
+)
+
+func init() {
+	rootCmd.AddCommand(bundleCmd)
+}
+
+var bundleCmd = &cobra.Command{
+	Use:   "bundle",
+	Short: "Work with bundle spec files",
+	Long:  `Work with bundle spec files`,
+}
+
+// bundleFiles returns the bundle sources to read, dir is read when no sources are given
+func bundleFiles(files []string, dir string) []string {
+	if len(files) == 0 && dir != "" {
+		return []string{dir}
+	}
+	return files
+}
+
+// bundleSourcesHelp describes the sources the --bundle flags accept
+const bundleSourcesHelp = "bundle and overlay file(s) to use: paths, directories, globs such as dir/**/*.yaml, - for stdin, https:// urls, " +
+	"oci://registry/repository:tag or git::repository//path?ref=ref, any of which can end in @sha256:<digest> to pin them"
+
+// filterAddons returns the addons with any of the names and the chart, names and chart are ignored when empty
+func filterAddons(addons []*bundle.Bundle, names []string, chart string) []*bundle.Bundle {
+	var filtered []*bundle.Bundle
+	for _, a := range addons {
+		if chart != "" && a.Source.Chart != chart {
+			continue
+		}
+		if len(names) == 0 {
+			filtered = append(filtered, a)
+			continue
+		}
+		for _, n := range names {
+			if a.Name == n {
+				filtered = append(filtered, a)
+				break
+			}
+		}
+	}
+	return filtered
+}
+
+// bundleJSON marshals bundles to json with the same keys that are used in bundle files
+func bundleJSON(v interface{}) ([]byte, error) {
+	b, err := yaml.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var generic interface{}
+	if err := yaml.Unmarshal(b, &generic); err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(generic, "", " ")
+}
@@ -0,0 +1,105 @@
+/*
+Copyright © 2021 FairwindsOps Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+
+	"github.com/fairwindsops/gonogo/pkg/bundle"
+	"github.com/fairwindsops/gonogo/pkg/helm"
+)
+
+var (
+	generateChart  string
+	generateRepo   string
+	generateFrom   string
+	generateTo     string
+	generateOutput string
+)
+
+func init() {
+	bundleCmd.AddCommand(generateCmd)
+	generateCmd.PersistentFlags().StringVarP(&generateChart, "chart", "c", "", "chart to compare, a chart archive or directory, repo/chart, a chart name in --repo or an oci:// reference")
+	generateCmd.PersistentFlags().StringVar(&generateRepo, "repo", "", "chart repository url to find the chart in")
+	generateCmd.PersistentFlags().StringVar(&generateFrom, "from", "", "chart version, or chart archive or directory, to upgrade from")
+	generateCmd.PersistentFlags().StringVar(&generateTo, "to", "", "chart version, or chart archive or directory, to upgrade to")
+	generateCmd.PersistentFlags().StringVarP(&generateOutput, "output-file", "f", "", "file to write the bundle to, defaults to stdout")
+}
+
+var generateCmd = &cobra.Command{
+	Use:   "generate",
+	Short: "Drafts a bundle by comparing two versions of a chart",
+	Long: `Drafts a bundle for upgrading a chart by comparing two of its versions. The versions, compatible kubernetes versions,
+necessary api versions and values schema are filled in from the charts, and the differences in values, values schemas,
+CRDs and kubeVersion are added as warnings to review before the bundle is used.`,
+	Example: `  gonogo bundle generate --chart metrics-server --repo https://kubernetes-sigs.github.io/metrics-server --from 3.8.4 --to 3.9.0
+  gonogo bundle generate --chart oci://registry-1.docker.io/bitnamicharts/redis --from 17.0.0 --to 18.0.0
+  gonogo bundle generate --from ./mychart-1.0.0.tgz --to ./mychart-1.1.0.tgz`,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if generateFrom == "" || generateTo == "" {
+			return fmt.Errorf("both --from and --to are required")
+		}
+
+		from, err := loadGenerateChart(generateFrom)
+		if err != nil {
+			return err
+		}
+		to, err := loadGenerateChart(generateTo)
+		if err != nil {
+			return err
+		}
+
+		addon, err := bundle.Generate(from, to, generateRepo)
+		if err != nil {
+			return err
+		}
+
+		var buf bytes.Buffer
+		buf.WriteString("# Drafted by gonogo bundle generate, review the warnings before using this bundle\n")
+		enc := yaml.NewEncoder(&buf)
+		enc.SetIndent(2)
+		err = enc.Encode(bundle.BundleConfig{
+			TypeMeta: bundle.TypeMeta{APIVersion: bundle.LatestAPIVersion, Kind: bundle.Kind},
+			Addons:   []*bundle.Bundle{addon},
+		})
+		if err != nil {
+			return err
+		}
+
+		if generateOutput == "" {
+			fmt.Print(buf.String())
+			return nil
+		}
+		return os.WriteFile(generateOutput, buf.Bytes(), 0644)
+	},
+}
+
+// loadGenerateChart loads the chart of --chart at a version, or the chart archive or directory given instead of
+// a version so that two local charts can be compared
+func loadGenerateChart(version string) (*chart.Chart, error) {
+	if _, err := os.Stat(version); err == nil {
+		return loader.Load(version)
+	}
+	return helm.LoadChart(generateChart, generateRepo, version)
+}
@@ -0,0 +1,87 @@
+/*
+Copyright © 2021 FairwindsOps Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/fairwindsops/gonogo/pkg/bundle"
+)
+
+var (
+	lintDir    string
+	lintOutput string
+)
+
+func init() {
+	bundleCmd.AddCommand(lintCmd)
+	lintCmd.PersistentFlags().StringVarP(&lintDir, "directory", "d", "", "directory to scan for .yaml and .yml bundle files, including subdirectories")
+	lintCmd.PersistentFlags().StringVarP(&lintOutput, "output", "o", "text", "output format, one of text or json")
+
+	bundleCmd.AddCommand(schemaCmd)
+}
+
+var lintCmd = &cobra.Command{
+	Use:   "lint [bundle file(s)]",
+	Short: "Validate bundle spec files",
+	Long: `Validate bundle spec files against the bundle schema. Unknown keys, invalid versions, invalid values schemas,
+opa checks that do not compile and malformed resource paths are reported with the file and line they are found on.
+The embedded bundles are linted when no files are given.`,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		files := args
+		if len(files) == 0 && lintDir != "" {
+			files = []string{lintDir}
+		}
+
+		lintErrs, err := bundle.NewLoader(cacheDir).Lint(files)
+		if err != nil {
+			return err
+		}
+
+		switch lintOutput {
+		case "json":
+			out, err := json.MarshalIndent(lintErrs, "", " ")
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(out))
+		case "text":
+			for _, e := range lintErrs {
+				fmt.Println(e.Error())
+			}
+		default:
+			return fmt.Errorf("unknown output format %s", lintOutput)
+		}
+
+		if len(lintErrs) > 0 {
+			return fmt.Errorf("found %d problem(s) in bundle files", len(lintErrs))
+		}
+		return nil
+	},
+}
+
+var schemaCmd = &cobra.Command{
+	Use:   "schema",
+	Short: "Prints the JSON Schema for bundle spec files",
+	Long:  `Prints the JSON Schema for bundle spec files. It can be used with editors that support yaml schema validation.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		fmt.Print(string(bundle.Schema()))
+	},
+}
@@ -0,0 +1,107 @@
+/*
+Copyright © 2021 FairwindsOps Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/fairwindsops/gonogo/pkg/bundle"
+)
+
+var (
+	listBundleFile []string
+	listBundleDir  string
+	listChart      string
+	listOutput     string
+)
+
+func init() {
+	bundleCmd.AddCommand(listCmd)
+	listCmd.PersistentFlags().StringSliceVarP(&listBundleFile, "bundle", "b", []string{}, bundleSourcesHelp)
+	listCmd.PersistentFlags().StringVarP(&listBundleDir, "directory", "d", "", "directory to scan for .yaml and .yml bundle and overlay files, including subdirectories")
+	listCmd.PersistentFlags().StringVar(&listChart, "chart", "", "only list bundles for this chart")
+	listCmd.PersistentFlags().StringVarP(&listOutput, "output", "o", "table", "output format, one of table or json")
+}
+
+// addonSummary is a single row of the bundle list
+type addonSummary struct {
+	Name        string `json:"name"`
+	Chart       string `json:"chart"`
+	Versions    string `json:"versions"`
+	Upgrade     string `json:"upgrade"`
+	Kubernetes  string `json:"kubernetes"`
+	OpaChecks   int    `json:"opaChecks"`
+	APIVersions int    `json:"apiVersions"`
+	Warnings    int    `json:"warnings"`
+	Schema      bool   `json:"valuesSchema"`
+}
+
+var listCmd = &cobra.Command{
+	Use:   "list",
+	Short: "Lists the bundles that gonogo uses",
+	Long: `Lists every addon in the bundles that gonogo uses, with the versions they apply to, the kubernetes versions
+they support and how many checks they have. The embedded bundles are listed when no files are given.`,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		config, err := bundle.NewLoader(cacheDir).ReadConfig(bundleFiles(listBundleFile, listBundleDir))
+		if err != nil {
+			return err
+		}
+
+		var summaries []addonSummary
+		for _, a := range filterAddons(config.Addons, nil, listChart) {
+			summaries = append(summaries, addonSummary{
+				Name:        a.Name,
+				Chart:       a.Source.Chart,
+				Versions:    a.Versions.String(),
+				Upgrade:     a.Versions.Target(),
+				Kubernetes:  a.CompatibleK8sVersions.String(),
+				OpaChecks:   len(a.OpaChecks),
+				APIVersions: len(a.NecessaryAPIVersions),
+				Warnings:    len(a.Warnings),
+				Schema:      a.ValuesSchema != "",
+			})
+		}
+
+		switch listOutput {
+		case "json":
+			out, err := json.MarshalIndent(summaries, "", " ")
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(out))
+		case "table":
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+			fmt.Fprintln(w, "NAME\tCHART\tVERSIONS\tUPGRADE\tKUBERNETES\tOPA CHECKS\tAPI VERSIONS\tWARNINGS\tVALUES SCHEMA")
+			for _, s := range summaries {
+				kubernetes := s.Kubernetes
+				if kubernetes == "" {
+					kubernetes = "*"
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%d\t%d\t%d\t%t\n", s.Name, s.Chart, s.Versions, s.Upgrade, kubernetes, s.OpaChecks, s.APIVersions, s.Warnings, s.Schema)
+			}
+			return w.Flush()
+		default:
+			return fmt.Errorf("unknown output format %s", listOutput)
+		}
+		return nil
+	},
+}
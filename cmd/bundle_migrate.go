@@ -0,0 +1,86 @@
+/*
+Copyright © 2021 FairwindsOps Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"k8s.io/klog"
+
+	"github.com/fairwindsops/gonogo/pkg/bundle"
+)
+
+var (
+	migrateDir     string
+	migrateInPlace bool
+)
+
+func init() {
+	bundleCmd.AddCommand(migrateCmd)
+	migrateCmd.PersistentFlags().StringVarP(&migrateDir, "directory", "d", "", "directory to scan for .yaml and .yml bundle files, including subdirectories")
+	migrateCmd.PersistentFlags().BoolVarP(&migrateInPlace, "write", "w", false, "write the migrated bundles back to their files instead of printing them")
+}
+
+var migrateCmd = &cobra.Command{
+	Use:   "migrate [bundle file(s)]",
+	Short: "Convert bundle spec files to the latest format",
+	Long: `Convert bundle spec files to the latest apiVersion. Bundles without an apiVersion are read as the legacy format.
+The migrated bundles are printed unless --write is set, in which case files that changed are rewritten in place.`,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		files := args
+		if len(files) == 0 && migrateDir != "" {
+			files = findFiles(migrateDir, ".yaml", ".yml")
+		}
+		if len(files) == 0 {
+			return fmt.Errorf("no bundle files specified")
+		}
+
+		for i, file := range files {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				return fmt.Errorf("unable to read file: %v", err)
+			}
+			out, changed, err := bundle.Migrate(data)
+			if err != nil {
+				return fmt.Errorf("unable to migrate %s: %v", file, err)
+			}
+
+			if !migrateInPlace {
+				if i > 0 {
+					fmt.Println("---")
+				}
+				fmt.Print(string(out))
+				continue
+			}
+			if !changed {
+				klog.V(3).Infof("%s is already at %s", file, bundle.LatestAPIVersion)
+				continue
+			}
+			info, err := os.Stat(file)
+			if err != nil {
+				return err
+			}
+			if err := os.WriteFile(file, out, info.Mode()); err != nil {
+				return fmt.Errorf("unable to write file: %v", err)
+			}
+			klog.Infof("migrated %s to %s", file, bundle.LatestAPIVersion)
+		}
+		return nil
+	},
+}
@@ -0,0 +1,188 @@
+/*
+Copyright © 2021 FairwindsOps Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+
+	"github.com/fairwindsops/gonogo/pkg/bundle"
+)
+
+var (
+	showBundleFile []string
+	showBundleDir  string
+	showEffective  bool
+	showChart      string
+	showOutput     string
+)
+
+func init() {
+	bundleCmd.AddCommand(showCmd)
+	showCmd.PersistentFlags().StringSliceVarP(&showBundleFile, "bundle", "b", []string{}, bundleSourcesHelp)
+	showCmd.PersistentFlags().StringVarP(&showBundleDir, "directory", "d", "", "directory to scan for .yaml and .yml bundle and overlay files, including subdirectories")
+	showCmd.PersistentFlags().BoolVar(&showEffective, "effective", false, "show the bundles after overlays have been applied")
+	showCmd.PersistentFlags().StringVar(&showChart, "chart", "", "only show bundles for this chart")
+	showCmd.PersistentFlags().StringVarP(&showOutput, "output", "o", "text", "output format, one of text, yaml or json")
+}
+
+var showCmd = &cobra.Command{
+	Use:   "show [addon name(s)]",
+	Short: "Prints the bundles that gonogo uses",
+	Long: `Prints the bundles that gonogo uses, including their opa checks and values schemas, optionally only those for the
+given addon names. The embedded bundles are used when no files are given, or when only overlay files are given.
+With --effective the overlays are applied, which shows exactly what gonogo check evaluates. The yaml output
+is a bundle file that can be used with --bundle.`,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		loader := bundle.NewLoader(cacheDir)
+		read := loader.ReadBaseConfig
+		if showEffective {
+			read = loader.ReadConfig
+		}
+		config, err := read(bundleFiles(showBundleFile, showBundleDir))
+		if err != nil {
+			return err
+		}
+
+		addons := filterAddons(config.Addons, args, showChart)
+		if len(addons) == 0 {
+			return fmt.Errorf("no bundles found")
+		}
+
+		switch showOutput {
+		case "yaml":
+			var buf bytes.Buffer
+			enc := yaml.NewEncoder(&buf)
+			enc.SetIndent(2)
+			err := enc.Encode(bundle.BundleConfig{
+				TypeMeta: bundle.TypeMeta{APIVersion: bundle.LatestAPIVersion, Kind: bundle.Kind},
+				Addons:   addons,
+			})
+			if err != nil {
+				return err
+			}
+			fmt.Print(buf.String())
+		case "json":
+			out, err := bundleJSON(addons)
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(out))
+		case "text":
+			for i, a := range addons {
+				if i > 0 {
+					fmt.Println()
+				}
+				if err := printAddon(os.Stdout, a); err != nil {
+					return err
+				}
+			}
+		default:
+			return fmt.Errorf("unknown output format %s", showOutput)
+		}
+		return nil
+	},
+}
+
+// printAddon writes a readable description of a bundle, including its opa checks and values schema
+func printAddon(out io.Writer, a *bundle.Bundle) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Name:\t%s\n", a.Name)
+	chart := a.Source.Chart
+	if a.Source.Repository != "" {
+		chart = fmt.Sprintf("%s (%s)", chart, a.Source.Repository)
+	}
+	fmt.Fprintf(w, "Chart:\t%s\n", chart)
+	fmt.Fprintf(w, "Versions:\t%s\n", a.Versions.String())
+	fmt.Fprintf(w, "Upgrade:\t%s\n", a.Versions.Target())
+	if a.Versions.Prerelease {
+		fmt.Fprintf(w, "Pre-releases:\tincluded\n")
+	}
+	if k := a.CompatibleK8sVersions.String(); k != "" {
+		fmt.Fprintf(w, "Kubernetes:\t%s\n", k)
+	}
+	if a.Notes != "" {
+		fmt.Fprintf(w, "Notes:\t%s\n", a.Notes)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	match, err := yaml.Marshal(a.Match)
+	if err != nil {
+		return err
+	}
+	if s := strings.TrimSpace(string(match)); s != "{}" {
+		printSection(out, "Match", []string{s})
+	}
+	printList(out, "Warnings", a.Warnings)
+	printList(out, "API versions", a.NecessaryAPIVersions)
+	printList(out, "Resources", a.Resources)
+	if a.ValuesSchema != "" {
+		printSection(out, "Values schema", []string{a.ValuesSchema})
+	}
+	if len(a.OpaChecks) > 0 {
+		var checks []string
+		for _, check := range a.OpaChecks {
+			checks = append(checks, fmt.Sprintf("# rules: %s\n%s", strings.Join(bundle.OpaCheckRules(check), ", "), check))
+		}
+		printSection(out, "OPA checks", checks)
+	}
+	for _, sc := range a.StatusChecks {
+		title := fmt.Sprintf("Releases in status %s", strings.Join(sc.Statuses, ", "))
+		printList(out, title+", warnings", sc.Warnings)
+		var checks []string
+		for _, check := range sc.OpaChecks {
+			checks = append(checks, fmt.Sprintf("# rules: %s\n%s", strings.Join(bundle.OpaCheckRules(check), ", "), check))
+		}
+		if len(checks) > 0 {
+			printSection(out, title+", OPA checks", checks)
+		}
+	}
+	return nil
+}
+
+// printList writes a titled bullet list, nothing is written for an empty list
+func printList(out io.Writer, title string, items []string) {
+	if len(items) == 0 {
+		return
+	}
+	fmt.Fprintf(out, "%s:\n", title)
+	for _, item := range items {
+		fmt.Fprintf(out, "  - %s\n", item)
+	}
+}
+
+// printSection writes a title followed by indented blocks of text separated by blank lines
+func printSection(out io.Writer, title string, blocks []string) {
+	fmt.Fprintf(out, "%s:\n", title)
+	for i, block := range blocks {
+		if i > 0 {
+			fmt.Fprintln(out)
+		}
+		for _, line := range strings.Split(strings.TrimRight(block, "\n"), "\n") {
+			fmt.Fprintf(out, "    %s\n", line)
+		}
+	}
+}
@@ -16,12 +16,16 @@ limitations under the License.
 package cmd
 
 import (
+	"encoding/json"
 	"fmt"
 	"io/fs"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
+	"github.com/thoas/go-funk"
 	"k8s.io/klog"
 
 	"github.com/fairwindsops/gonogo/pkg/helm"
@@ -29,14 +33,47 @@ import (
 )
 
 var (
-	bundleFile []string
-	bundleDir  string
+	bundleFile   []string
+	bundleDir    string
+	targets      map[string]string
+	chartBundles bool
+	renderTarget bool
+	checkCRDs    bool
+	deprecated   bool
+	helmDriver   string
+
+	namespaces        []string
+	allNamespaces     bool
+	namespaceSelector string
+	releaseNames      []string
+	leastPrivilege    bool
+	snapshotFile      string
+	repoDir           string
+	scoringFile       string
+	targetKubeVersion string
+	providers         []string
 )
 
 func init() {
 	rootCmd.AddCommand(checkCmd)
-	checkCmd.PersistentFlags().StringSliceVarP(&bundleFile, "bundle", "b", []string{}, "bundle file(s) to use")
-	checkCmd.PersistentFlags().StringVarP(&bundleDir, "directory", "d", "", "directory to scan for bundle files")
+	checkCmd.PersistentFlags().StringSliceVarP(&bundleFile, "bundle", "b", []string{}, bundleSourcesHelp)
+	checkCmd.PersistentFlags().StringVarP(&bundleDir, "directory", "d", "", "directory to scan for .yaml and .yml bundle files, including subdirectories")
+	checkCmd.PersistentFlags().StringToStringVarP(&targets, "target", "t", map[string]string{}, "plan upgrades through several bundles to a chart version, as chart=version or namespace/release=version. Use latest as the version for the highest version the bundles reach")
+	checkCmd.PersistentFlags().StringVar(&helmDriver, "helm-driver", helm.DefaultDriver(), "helm storage driver to read releases from: secret, configmap, sql or auto to detect it, defaults to HELM_DRIVER")
+	checkCmd.PersistentFlags().StringSliceVarP(&namespaces, "namespace", "n", []string{}, "only read releases and cluster objects in these namespaces, every namespace is read by default")
+	checkCmd.PersistentFlags().BoolVarP(&allNamespaces, "all-namespaces", "A", false, "read releases and cluster objects in every namespace")
+	checkCmd.PersistentFlags().StringVar(&namespaceSelector, "namespace-selector", "", "only read releases and cluster objects in the namespaces that match this label selector")
+	checkCmd.PersistentFlags().StringSliceVar(&releaseNames, "release", []string{}, "only check these releases, as name or namespace/name")
+	checkCmd.PersistentFlags().BoolVar(&leastPrivilege, "least-privilege", false, "only read in the given namespaces, or the namespace of the current context, and skip the checks that need permissions that are missing")
+	checkCmd.PersistentFlags().StringSliceVar(&providers, "providers", helm.AllProviders(), "where to discover releases: helm for helm storage, flux for Flux HelmReleases and argocd for Argo CD Applications")
+	checkCmd.PersistentFlags().StringVar(&snapshotFile, "snapshot", "", "replay the checks against a snapshot taken with gonogo snapshot instead of a cluster")
+	checkCmd.PersistentFlags().StringVar(&repoDir, "repo", "", "check the releases declared in a gitops repository: Flux HelmReleases, Argo CD Applications, helmfiles and chart dependencies")
+	checkCmd.PersistentFlags().StringVar(&scoringFile, "scoring", "", "file with the weights of the upgrade confidence and the threshold of a go, the default weights are kept for what it does not set")
+	checkCmd.PersistentFlags().BoolVar(&chartBundles, "chart-bundles", false, "download the charts that releases are upgraded to and use the bundles shipped in them")
+	checkCmd.PersistentFlags().BoolVar(&deprecated, "deprecated-apis", true, "report the objects of every release, those no bundle matches included, whose apis are deprecated or removed")
+	checkCmd.PersistentFlags().StringVar(&targetKubeVersion, "target-kube-version", "", "kubernetes version the cluster is upgraded to, apis deprecated or removed in it are reported")
+	checkCmd.PersistentFlags().BoolVar(&renderTarget, "render-target", false, "render the charts that releases are upgraded to with the values of the releases and report how their objects change")
+	checkCmd.PersistentFlags().BoolVar(&checkCRDs, "check-crds", true, "download the charts that releases are upgraded to and compare their crds with those in the cluster")
 }
 
 var checkCmd = &cobra.Command{
@@ -45,25 +82,120 @@ var checkCmd = &cobra.Command{
 	Long:    `Check for Helm releases that can be updated`,
 	PreRunE: validateArgs,
 	Run: func(cmd *cobra.Command, args []string) {
-		if len(bundleFile) == 0 {
-			if bundleDir != "" {
-				t := ".yaml"
-				bundleFile = findFiles(bundleDir, t)
+		var scoring *validate.Scoring
+		if scoringFile != "" {
+			var err error
+			scoring, err = validate.ReadScoring(scoringFile)
+			if err != nil {
+				klog.Error(err)
+				return
 			}
 		}
+
+		if fleetMode() {
+			clusters, err := fleetClusters()
+			if err != nil {
+				klog.Error(err)
+				return
+			}
+			fleet := &validate.Fleet{
+				Config: validate.Config{
+					Bundle:            bundleFiles(bundleFile, bundleDir),
+					CacheDir:          cacheDir,
+					Targets:           targets,
+					ChartBundles:      chartBundles,
+					RenderTarget:      renderTarget,
+					CheckCRDs:         checkCRDs,
+					DeprecatedAPIs:    deprecated,
+					TargetKubeVersion: targetKubeVersion,
+					LeastPrivilege:    leastPrivilege,
+					Scoring:           scoring,
+				},
+				Clusters: clusters,
+				Parallel: parallel,
+			}
+			out, err := fleet.Validate(cmd.Context())
+			if err != nil {
+				klog.Error(err)
+			}
+			if out != nil {
+				printJSON(out)
+			}
+			return
+		}
+
+		var h *helm.Helm
+		switch {
+		case offline:
+			var err error
+			h, err = offlineHelm()
+			if err != nil {
+				klog.Error(err)
+				return
+			}
+		case snapshotFile != "":
+			var err error
+			h, err = snapshotHelm()
+			if err != nil {
+				klog.Error(err)
+				return
+			}
+			h.Namespaces = namespaces
+		case repoDir != "":
+			var err error
+			h, err = helm.NewRepoHelm(repoDir, offlineKubeVersion, offlineAPIVersions)
+			if err != nil {
+				klog.Error(err)
+				return
+			}
+			h.Namespaces = namespaces
+		default:
+			var err error
+			h, err = helm.NewHelm()
+			if err != nil {
+				klog.Error(err)
+				return
+			}
+			h.Driver = helmDriver
+			h.Namespaces = namespaces
+			h.Providers = providers
+		}
+		h.NamespaceSelector = namespaceSelector
+		h.ReleaseNames = releaseNames
 		config := &validate.Config{
-			Helm:   helm.NewHelm(),
-			Bundle: bundleFile,
+			Releases:          h,
+			Cluster:           h,
+			Bundle:            bundleFiles(bundleFile, bundleDir),
+			CacheDir:          cacheDir,
+			Targets:           targets,
+			ChartBundles:      chartBundles,
+			RenderTarget:      renderTarget,
+			CheckCRDs:         checkCRDs,
+			DeprecatedAPIs:    deprecated,
+			TargetKubeVersion: targetKubeVersion,
+			LeastPrivilege:    leastPrivilege,
+			Scoring:           scoring,
 		}
 
-		out, err := config.Validate()
+		out, err := config.Validate(cmd.Context())
 		if err != nil {
 			klog.Error(err)
+			return
 		}
-		fmt.Println(out)
+		printJSON(out)
 	},
 }
 
+// printJSON prints the result of a check
+func printJSON(out interface{}) {
+	data, err := json.MarshalIndent(out, "", " ")
+	if err != nil {
+		klog.Error(err)
+		return
+	}
+	fmt.Println(string(data))
+}
+
 func validateArgs(cmd *cobra.Command, args []string) error {
 	if len(args) != 0 {
 		_, err := os.Stat(args[0])
@@ -72,19 +204,87 @@ func validateArgs(cmd *cobra.Command, args []string) error {
 			return fmt.Errorf("bundle file %s does not exist", args[0])
 		}
 	}
+	if err := validateProviders(providers); err != nil {
+		return err
+	}
+	if err := validateOffline(); err != nil {
+		return err
+	}
+	if err := validateFleet(); err != nil {
+		return err
+	}
+	if snapshotFile != "" && (offline || leastPrivilege || namespaceSelector != "") {
+		return fmt.Errorf("--snapshot can not be used with --offline, --least-privilege or --namespace-selector")
+	}
+	if repoDir != "" && (offline || snapshotFile != "" || leastPrivilege || namespaceSelector != "") {
+		return fmt.Errorf("--repo can not be used with --offline, --snapshot, --least-privilege or --namespace-selector")
+	}
+	return validateScope()
+}
+
+// validateScope checks that the namespace flags do not conflict and defaults the namespace in least privilege mode
+func validateScope() error {
+	if allNamespaces && (len(namespaces) > 0 || namespaceSelector != "") {
+		return fmt.Errorf("--all-namespaces can not be used with --namespace or --namespace-selector")
+	}
+	if len(namespaces) > 0 && namespaceSelector != "" {
+		return fmt.Errorf("--namespace can not be used with --namespace-selector")
+	}
+	if !leastPrivilege || offline || snapshotFile != "" || repoDir != "" || fleetMode() {
+		return nil
+	}
+	if allNamespaces || namespaceSelector != "" {
+		return fmt.Errorf("--least-privilege needs --namespace, namespaces can not be listed or selected")
+	}
+	if len(namespaces) == 0 {
+		ns, err := helm.CurrentNamespace()
+		if err != nil {
+			return fmt.Errorf("unable to find the namespace of the current context: %w", err)
+		}
+		klog.Infof("least privilege mode, reading releases in namespace %s", ns)
+		namespaces = []string{ns}
+	}
 	return nil
 }
 
-func findFiles(dir, ext string) []string {
+func findFiles(dir string, exts ...string) []string {
 	var a []string
 	filepath.WalkDir(dir, func(path string, d fs.DirEntry, e error) error {
 		if e != nil {
 			return e
 		}
-		if filepath.Ext(d.Name()) == ext {
-			a = append(a, path)
+		for _, ext := range exts {
+			if filepath.Ext(d.Name()) == ext {
+				a = append(a, path)
+				break
+			}
 		}
 		return nil
 	})
 	return a
 }
+
+// snapshotHelm returns a Helm that replays the snapshot file
+func snapshotHelm() (*helm.Helm, error) {
+	f, err := os.Open(snapshotFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	s, err := helm.ReadSnapshot(f)
+	if err != nil {
+		return nil, err
+	}
+	klog.Infof("replaying snapshot taken %s", s.Metadata.Created.Format(time.RFC3339))
+	return helm.NewSnapshotHelm(s), nil
+}
+
+// validateProviders checks that every provider is known
+func validateProviders(providers []string) error {
+	for _, p := range providers {
+		if !funk.ContainsString(helm.AllProviders(), p) {
+			return fmt.Errorf("unknown provider %s, use any of %s", p, strings.Join(helm.AllProviders(), ", "))
+		}
+	}
+	return nil
+}
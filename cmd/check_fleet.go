@@ -0,0 +1,113 @@
+/*
+Copyright © 2021 FairwindsOps Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/fairwindsops/gonogo/pkg/helm"
+	"github.com/fairwindsops/gonogo/pkg/validate"
+)
+
+var (
+	kubeContexts []string
+	allContexts  bool
+	fleetFile    string
+	parallel     int
+)
+
+func init() {
+	checkCmd.PersistentFlags().StringSliceVar(&kubeContexts, "context", []string{}, "check the clusters of these kubeconfig contexts, can be repeated")
+	checkCmd.PersistentFlags().BoolVar(&allContexts, "all-contexts", false, "check the clusters of every kubeconfig context")
+	checkCmd.PersistentFlags().StringVar(&fleetFile, "fleet", "", "check the clusters listed in a fleet file")
+	checkCmd.PersistentFlags().IntVar(&parallel, "parallel", 4, "number of clusters checked at once with --context, --all-contexts or --fleet")
+}
+
+// fleetMode reports whether several clusters are checked
+func fleetMode() bool {
+	return len(kubeContexts) > 0 || allContexts || fleetFile != ""
+}
+
+// validateFleet checks that the flags of a fleet check are usable
+func validateFleet() error {
+	if !fleetMode() {
+		return nil
+	}
+	set := 0
+	for _, s := range []bool{len(kubeContexts) > 0, allContexts, fleetFile != ""} {
+		if s {
+			set++
+		}
+	}
+	if set > 1 {
+		return fmt.Errorf("only one of --context, --all-contexts and --fleet can be used")
+	}
+	if offline || snapshotFile != "" || repoDir != "" {
+		return fmt.Errorf("--context, --all-contexts and --fleet can not be used with --offline, --snapshot or --repo")
+	}
+	if leastPrivilege && len(namespaces) == 0 {
+		return fmt.Errorf("--least-privilege needs --namespace when checking several clusters")
+	}
+	if parallel < 1 {
+		return fmt.Errorf("--parallel must be at least 1")
+	}
+	return nil
+}
+
+// fleetClusters returns the clusters to check from the fleet flags. Clusters whose context does not load are
+// returned with the error, so that they are reported along with the others.
+func fleetClusters() ([]validate.FleetCluster, error) {
+	var entries []helm.FleetCluster
+	switch {
+	case fleetFile != "":
+		fleet, err := helm.ReadFleet(fleetFile)
+		if err != nil {
+			return nil, err
+		}
+		entries = fleet.Clusters
+	case allContexts:
+		names, err := helm.KubeContexts("")
+		if err != nil {
+			return nil, err
+		}
+		if len(names) == 0 {
+			return nil, fmt.Errorf("no contexts in kubeconfig")
+		}
+		for _, name := range names {
+			entries = append(entries, helm.FleetCluster{Name: name, Context: name})
+		}
+	default:
+		for _, name := range kubeContexts {
+			entries = append(entries, helm.FleetCluster{Name: name, Context: name})
+		}
+	}
+
+	clusters := make([]validate.FleetCluster, 0, len(entries))
+	for _, e := range entries {
+		h, err := helm.NewHelmForContext(e.Kubeconfig, e.Context)
+		if err != nil {
+			clusters = append(clusters, validate.FleetCluster{Name: e.Name, Err: err})
+			continue
+		}
+		h.Driver = helmDriver
+		h.Namespaces = namespaces
+		h.NamespaceSelector = namespaceSelector
+		h.ReleaseNames = releaseNames
+		h.Providers = providers
+		clusters = append(clusters, validate.FleetCluster{Name: e.Name, Releases: h, Cluster: h})
+	}
+	return clusters, nil
+}
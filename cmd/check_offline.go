@@ -0,0 +1,124 @@
+/*
+Copyright © 2021 FairwindsOps Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/cli"
+	"helm.sh/helm/v3/pkg/cli/values"
+	"helm.sh/helm/v3/pkg/getter"
+	"helm.sh/helm/v3/pkg/release"
+
+	"github.com/fairwindsops/gonogo/pkg/helm"
+)
+
+var (
+	offline             bool
+	offlineChart        string
+	offlineChartVersion string
+	offlineAppVersion   string
+	offlineReleaseName  string
+	offlineValues       []string
+	offlineManifests    []string
+	offlineKubeVersion  string
+	offlineAPIVersions  []string
+)
+
+func init() {
+	checkCmd.PersistentFlags().BoolVar(&offline, "offline", false, "check a chart without a cluster, described by the --chart, --values, --manifests, --kube-version and --api-versions flags")
+	checkCmd.PersistentFlags().StringVar(&offlineChart, "chart", "", "with --offline, name of the chart or path to a local chart")
+	checkCmd.PersistentFlags().StringVar(&offlineChartVersion, "chart-version", "", "with --offline, version of the chart, read from the chart when --chart is a path")
+	checkCmd.PersistentFlags().StringVar(&offlineAppVersion, "app-version", "", "with --offline, appVersion of the chart, read from the chart when --chart is a path")
+	checkCmd.PersistentFlags().StringVar(&offlineReleaseName, "release-name", "", "with --offline, name of the release, defaults to the chart name")
+	checkCmd.PersistentFlags().StringSliceVarP(&offlineValues, "values", "f", []string{}, "with --offline, values files of the release, later files take precedence")
+	checkCmd.PersistentFlags().StringSliceVar(&offlineManifests, "manifests", []string{}, "with --offline, files with the manifests the release renders to such as helm template output, - reads stdin")
+	checkCmd.PersistentFlags().StringVar(&offlineKubeVersion, "kube-version", "", "with --offline or --repo, kubernetes version of the cluster, the version check is skipped without it")
+	checkCmd.PersistentFlags().StringSliceVar(&offlineAPIVersions, "api-versions", []string{}, "with --offline or --repo, api group versions served by the cluster such as apps/v1, the api version check is skipped without them")
+}
+
+// validateOffline checks that the flags of an offline check are usable
+func validateOffline() error {
+	if !offline {
+		return nil
+	}
+	if offlineChart == "" {
+		return fmt.Errorf("--offline needs --chart")
+	}
+	if allNamespaces || namespaceSelector != "" || leastPrivilege {
+		return fmt.Errorf("--offline can not be used with --all-namespaces, --namespace-selector or --least-privilege")
+	}
+	if len(namespaces) > 1 {
+		return fmt.Errorf("--offline takes a single --namespace for the release")
+	}
+	return nil
+}
+
+// offlineHelm returns a Helm with the release described by the offline flags
+func offlineHelm() (*helm.Helm, error) {
+	metadata := &chart.Metadata{Name: offlineChart, Version: offlineChartVersion, AppVersion: offlineAppVersion}
+	if _, err := os.Stat(offlineChart); err == nil {
+		c, err := loader.Load(offlineChart)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load chart %s: %w", offlineChart, err)
+		}
+		metadata = c.Metadata
+		if offlineChartVersion != "" {
+			metadata.Version = offlineChartVersion
+		}
+		if offlineAppVersion != "" {
+			metadata.AppVersion = offlineAppVersion
+		}
+	}
+	if metadata.Version == "" {
+		return nil, fmt.Errorf("--offline needs --chart-version when --chart is not a local chart")
+	}
+
+	vals, err := (&values.Options{ValueFiles: offlineValues}).MergeValues(getter.All(cli.New()))
+	if err != nil {
+		return nil, fmt.Errorf("unable to read values: %w", err)
+	}
+
+	var manifests []string
+	for _, f := range offlineManifests {
+		var data []byte
+		if f == "-" {
+			data, err = io.ReadAll(os.Stdin)
+		} else {
+			data, err = os.ReadFile(f)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to read manifests: %w", err)
+		}
+		manifests = append(manifests, string(data))
+	}
+
+	name := offlineReleaseName
+	if name == "" {
+		name = metadata.Name
+	}
+	namespace := "default"
+	if len(namespaces) > 0 {
+		namespace = namespaces[0]
+	}
+	rel := helm.NewOfflineRelease(name, namespace, metadata, vals, strings.Join(manifests, "\n---\n"))
+	return helm.NewOfflineHelm([]*release.Release{rel}, offlineKubeVersion, offlineAPIVersions)
+}
@@ -24,16 +24,20 @@ import (
 	"github.com/spf13/pflag"
 
 	"k8s.io/klog"
+
+	"github.com/fairwindsops/gonogo/pkg/bundle"
 )
 
 var (
 	version       string
 	versionCommit string
+	cacheDir      string
 )
 
 func init() {
 	klog.InitFlags(nil)
 	pflag.CommandLine.AddGoFlag(flag.CommandLine.Lookup("v"))
+	rootCmd.PersistentFlags().StringVar(&cacheDir, "cache-dir", bundle.DefaultCacheDir(), "directory to cache bundles downloaded from urls, oci registries and git repositories in")
 }
 
 // rootCmd represents the base command when called without any subcommands
@@ -0,0 +1,122 @@
+/*
+Copyright © 2021 FairwindsOps Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/klog"
+
+	"github.com/fairwindsops/gonogo/pkg/bundle"
+	"github.com/fairwindsops/gonogo/pkg/helm"
+)
+
+var (
+	snapshotBundleFile        []string
+	snapshotBundleDir         string
+	snapshotOutput            string
+	snapshotRedact            bool
+	snapshotHelmDriver        string
+	snapshotNamespaces        []string
+	snapshotNamespaceSelector string
+	snapshotReleaseNames      []string
+	snapshotProviders         []string
+)
+
+func init() {
+	rootCmd.AddCommand(snapshotCmd)
+	snapshotCmd.PersistentFlags().StringSliceVarP(&snapshotBundleFile, "bundle", "b", []string{}, bundleSourcesHelp)
+	snapshotCmd.PersistentFlags().StringVarP(&snapshotBundleDir, "directory", "d", "", "directory to scan for .yaml and .yml bundle files, including subdirectories")
+	snapshotCmd.PersistentFlags().StringVarP(&snapshotOutput, "output", "o", "cluster.tgz", "file to write the snapshot to")
+	snapshotCmd.PersistentFlags().BoolVar(&snapshotRedact, "redact", false, "redact the data of Secrets and the release values whose keys look like they hold secrets")
+	snapshotCmd.PersistentFlags().StringVar(&snapshotHelmDriver, "helm-driver", helm.DefaultDriver(), "helm storage driver to read releases from: secret, configmap, sql or auto to detect it, defaults to HELM_DRIVER")
+	snapshotCmd.PersistentFlags().StringSliceVarP(&snapshotNamespaces, "namespace", "n", []string{}, "only capture releases and cluster objects in these namespaces")
+	snapshotCmd.PersistentFlags().StringVar(&snapshotNamespaceSelector, "namespace-selector", "", "only capture releases and cluster objects in the namespaces that match this label selector")
+	snapshotCmd.PersistentFlags().StringSliceVar(&snapshotProviders, "providers", helm.AllProviders(), "where to discover releases: helm for helm storage, flux for Flux HelmReleases and argocd for Argo CD Applications")
+	snapshotCmd.PersistentFlags().StringSliceVar(&snapshotReleaseNames, "release", []string{}, "only capture these releases, as name or namespace/name")
+}
+
+var snapshotCmd = &cobra.Command{
+	Use:   "snapshot",
+	Short: "Capture what gonogo reads from a cluster to replay checks without it",
+	Long: `Captures the helm releases with their history, the cluster version, the api versions it serves and the
+objects of the resources the bundles ask for into a gzipped tarball. Run gonogo check --snapshot with the file
+to replay the checks without access to the cluster.`,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(snapshotNamespaces) > 0 && snapshotNamespaceSelector != "" {
+			return fmt.Errorf("--namespace can not be used with --namespace-selector")
+		}
+		if err := validateProviders(snapshotProviders); err != nil {
+			return err
+		}
+		config, err := bundle.NewLoader(cacheDir).ReadConfig(bundleFiles(snapshotBundleFile, snapshotBundleDir))
+		if err != nil {
+			return err
+		}
+
+		h, err := helm.NewHelm()
+		if err != nil {
+			return err
+		}
+		h.Driver = snapshotHelmDriver
+		h.Namespaces = snapshotNamespaces
+		h.NamespaceSelector = snapshotNamespaceSelector
+		h.ReleaseNames = snapshotReleaseNames
+		h.Providers = snapshotProviders
+
+		s, err := h.Snapshot(bundleResources(config.Addons), snapshotRedact)
+		if err != nil {
+			return err
+		}
+
+		// the snapshot has release values and secrets unless redacted
+		f, err := os.OpenFile(snapshotOutput, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o600)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if err := helm.WriteSnapshot(f, s); err != nil {
+			return fmt.Errorf("unable to write snapshot %s: %w", snapshotOutput, err)
+		}
+		klog.Infof("wrote snapshot of %d release revisions and %d resources to %s", len(s.Releases), len(s.Objects), snapshotOutput)
+		return f.Close()
+	},
+}
+
+// bundleResources returns the resources that the bundles ask for, once each
+func bundleResources(addons []*bundle.Bundle) []schema.GroupVersionResource {
+	seen := map[schema.GroupVersionResource]bool{}
+	var resources []schema.GroupVersionResource
+	for _, a := range addons {
+		for _, r := range a.Resources {
+			group, version, resource, err := bundle.ParseResourcePath(r)
+			if err != nil {
+				klog.Warningf("ignoring resource of bundle %s: %v", a.Name, err)
+				continue
+			}
+			gvr := schema.GroupVersionResource{Group: group, Version: version, Resource: resource}
+			if !seen[gvr] {
+				seen[gvr] = true
+				resources = append(resources, gvr)
+			}
+		}
+	}
+	return resources
+}
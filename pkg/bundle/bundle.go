@@ -19,11 +19,8 @@ package bundle
 import (
 	"embed"
 	"fmt"
-	"os"
-	"path/filepath"
 
 	multierror "github.com/hashicorp/go-multierror"
-	"gopkg.in/yaml.v2"
 )
 
 //go:embed bundles
@@ -32,81 +29,138 @@ var defaultBundle embed.FS
 // Source is the chart and repo for Helm releases
 type Source struct {
 	Chart      string `yaml:"chart"`
-	Repository string `yaml:"repository"`
+	Repository string `yaml:"repository,omitempty"`
 }
 
-// Versions is a list of version strings within the bundle spec file
+// Versions is a list of version strings within the bundle spec file. Either From and To, or Start and End are set.
 type Versions struct {
-	Start string `yaml:"start"`
-	End   string `yaml:"end"`
+	Start      string `yaml:"start,omitempty"`      // first chart version to evaluate
+	End        string `yaml:"end,omitempty"`        // chart version to upgrade to, versions up to but not including it are evaluated
+	From       string `yaml:"from,omitempty"`       // semver constraint for the chart versions to evaluate
+	To         string `yaml:"to,omitempty"`         // chart version to upgrade to when using from
+	Prerelease bool   `yaml:"prerelease,omitempty"` // match pre-release chart versions as their release version
+}
+
+// TypeMeta identifies the version of a bundle spec file. Files without it are read as the legacy format.
+type TypeMeta struct {
+	APIVersion string `yaml:"apiVersion,omitempty"`
+	Kind       string `yaml:"kind,omitempty"`
 }
 
 // BundleConfig is the top level key for the bundle spec file and contains slices of the Bundle struct
 type BundleConfig struct {
-	Addons []*Bundle `yaml:"addons"`
+	TypeMeta `yaml:",inline"`
+	Addons   []*Bundle `yaml:"addons"`
+
+	// overlays are the overlays applied to Addons, kept to apply them again with ApplyPatches
+	overlays []*Overlay
 }
 
+// K8sVersions are the kubernetes versions supported by the upgraded addon
 type K8sVersions struct {
-	Min string `yaml:"min"`
-	Max string `yaml:"max"`
+	Min        string `yaml:"min,omitempty"`
+	Max        string `yaml:"max,omitempty"`
+	Constraint string `yaml:"constraint,omitempty"` // semver constraint for the cluster version
 }
 
 // Bundle maps the fields from a supplied bundle spec file
 type Bundle struct {
-	Name                  string      `yaml:"name"`                    // name of the helm release
-	Versions              Versions    `yaml:"versions"`                // start and stop versions of helm chart to evaluate
-	Notes                 string      `yaml:"notes"`                   // strings of general notes
-	Source                Source      `yaml:"source"`                  // chart name and repository for helm release
-	Warnings              []string    `yaml:"warnings"`                // strings of warning messages
-	CompatibleK8sVersions K8sVersions `yaml:"compatible_k8s_versions"` // kubernetes cluster version to check for
-	NecessaryAPIVersions  []string    `yaml:"necessary_api_versions"`  // specific api versions to check for
-	ValuesSchema          string      `yaml:"values_schema"`           // embedded values.schema.json
-	OpaChecks             []string    `yaml:"opa_checks"`              // embedded rego code
-	Resources             []string    `yaml:"resources"`               // api objects
+	Name                  string        `yaml:"name"`                              // name of the helm release
+	Versions              Versions      `yaml:"versions"`                          // versions of helm chart to evaluate
+	Notes                 string        `yaml:"notes,omitempty"`                   // strings of general notes
+	Source                Source        `yaml:"source,omitempty"`                  // chart name and repository for helm release
+	Match                 Match         `yaml:"match,omitempty"`                   // additional criteria a release must meet
+	Warnings              []string      `yaml:"warnings,omitempty"`                // strings of warning messages
+	CompatibleK8sVersions K8sVersions   `yaml:"compatible_k8s_versions,omitempty"` // kubernetes cluster version to check for
+	NecessaryAPIVersions  []string      `yaml:"necessary_api_versions,omitempty"`  // specific api versions to check for
+	ValuesSchema          string        `yaml:"values_schema,omitempty"`           // embedded values.schema.json
+	OpaChecks             []string      `yaml:"opa_checks,omitempty"`              // embedded rego code
+	Resources             []string      `yaml:"resources,omitempty"`               // api objects
+	StatusChecks          []StatusCheck `yaml:"status_checks,omitempty"`           // checks for releases in particular statuses
+
+	Origin  string            `yaml:"-"` // where the bundle was read from, one of the Origin constants
+	origins map[string]string // origin of each check of a merged bundle
 }
 
-// ReadConfig takes a bundle spec file as a string and maps it into the Bundle struct
+// source is the raw content of a bundle spec file along with where it was read from
+type source struct {
+	name string
+	data []byte
+}
+
+// ReadConfig takes a bundle spec file as a string and maps it into the Bundle struct.
+// Overlay files are applied to the bundles from the other files, or to the embedded bundles when only overlays are given.
+// Remote bundles are cached in DefaultCacheDir.
 func ReadConfig(file []string) (*BundleConfig, error) {
-	var tempBundleConfig struct {
-		Addons []*Bundle `yaml:"addons"`
-	}
-	var allErrs error = nil
+	return NewLoader(DefaultCacheDir()).ReadConfig(file)
+}
+
+// ReadBaseConfig reads bundle spec files like ReadConfig, without applying overlays
+func ReadBaseConfig(file []string) (*BundleConfig, error) {
+	return NewLoader(DefaultCacheDir()).ReadBaseConfig(file)
+}
+
+// ReadConfig reads bundle spec files like the package level ReadConfig, from any of the sources the Loader supports
+func (l *Loader) ReadConfig(file []string) (*BundleConfig, error) {
+	return l.readConfig(file, true)
+}
+
+// ReadBaseConfig reads bundle spec files like ReadConfig, without applying overlays
+func (l *Loader) ReadBaseConfig(file []string) (*BundleConfig, error) {
+	return l.readConfig(file, false)
+}
+
+func (l *Loader) readConfig(file []string, applyOverlay bool) (*BundleConfig, error) {
 	bundleconfig := &BundleConfig{}
+	var overlays []*Overlay
+	foundBundles := false
 
+	sources, allErrs := l.readSources(file)
+	origin := OriginUser
 	if len(file) == 0 {
-		files, err := defaultBundle.ReadDir("bundles")
+		origin = OriginEmbedded
+	}
+
+	for _, src := range sources {
+		tempBundleConfig, overlay, err := decodeDocument(src.data)
 		if err != nil {
-			return nil, fmt.Errorf("unable to process bundles: %v", err)
+			allErrs = multierror.Append(allErrs, fmt.Errorf("unable to read file %s: %v", src.name, err))
+			continue
 		}
-
-		for _, file := range files {
-			f, err := defaultBundle.ReadFile(filepath.Join("bundles", file.Name()))
-			if err != nil {
-				allErrs = multierror.Append(allErrs, fmt.Errorf("unable to read file: %v", err))
-				continue
-			}
-
-			if err := yaml.Unmarshal(f, &tempBundleConfig); err != nil {
-				allErrs = multierror.Append(allErrs, fmt.Errorf("unable to read file: %v", err))
-				continue
-			}
-			bundleconfig.Addons = append(bundleconfig.Addons, tempBundleConfig.Addons...)
+		if overlay != nil {
+			setOrigin(overlay.Addons, origin)
+			overlays = append(overlays, overlay)
+			continue
 		}
-	} else {
-		for _, str := range file {
-			f, err := os.ReadFile(str)
-			if err != nil {
-				allErrs = multierror.Append(allErrs, fmt.Errorf("unable to read file: %v", err))
-				continue
-			}
-			if err := yaml.Unmarshal(f, &tempBundleConfig); err != nil {
-				allErrs = multierror.Append(allErrs, fmt.Errorf("unable to read file: %v", err))
-				continue
-			}
-
-			bundleconfig.Addons = append(bundleconfig.Addons, tempBundleConfig.Addons...)
+		foundBundles = true
+		setOrigin(tempBundleConfig.Addons, origin)
+		bundleconfig.Addons = append(bundleconfig.Addons, tempBundleConfig.Addons...)
+	}
+
+	if len(file) > 0 && !foundBundles && len(overlays) > 0 {
+		base, err := l.readConfig(nil, false)
+		if err != nil {
+			allErrs = multierror.Append(allErrs, err)
 		}
+		bundleconfig.Addons = base.Addons
 	}
 
+	if !applyOverlay {
+		return bundleconfig, allErrs
+	}
+
+	addons, err := applyOverlays(bundleconfig.Addons, overlays)
+	if err != nil {
+		return bundleconfig, multierror.Append(allErrs, fmt.Errorf("unable to apply overlays: %v", err))
+	}
+	bundleconfig.Addons = addons
+	bundleconfig.overlays = overlays
 	return bundleconfig, allErrs
 }
+
+// setOrigin records where bundles were read from
+func setOrigin(addons []*Bundle, origin string) {
+	for _, a := range addons {
+		a.Origin = origin
+	}
+}
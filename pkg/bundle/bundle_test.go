@@ -36,19 +36,41 @@ func TestReadConfig(t *testing.T) {
 				Addons: []*Bundle{
 					{
 						Name:                  "metrics-server",
-						Versions:              Versions{"5.10.2", "5.10.14"},
+						Versions:              Versions{Start: "5.10.2", End: "5.10.14"},
 						Notes:                 "A text field with general notes",
 						Source:                Source{"metrics-server", "https://charts.bitnami.com/bitnami"},
 						Warnings:              []string{"warning 1", "warning 2"},
-						CompatibleK8sVersions: K8sVersions{"1.18", "1.20"},
+						CompatibleK8sVersions: K8sVersions{Min: "1.18", Max: "1.20"},
 						NecessaryAPIVersions:  []string{"apps/v1", "v1"},
 						ValuesSchema:          "",
 						OpaChecks:             []string{"Check One", "Check Two"},
+						Origin:                OriginUser,
 					},
 				},
 			},
 			wantErr: false,
 		},
+		{
+			name: "versioned bundle",
+			file: []string{"testdata/bundle_v1alpha1.yaml"},
+			want: &BundleConfig{
+				Addons: []*Bundle{
+					{
+						Name:     "metrics-server",
+						Versions: Versions{Start: "5.10.2", End: "5.10.14"},
+						Source:   Source{"metrics-server", "https://charts.bitnami.com/bitnami"},
+						Origin:   OriginUser,
+					},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name:    "unsupported bundle version",
+			file:    []string{"testdata/bundle_unknown_version.yaml"},
+			want:    nil,
+			wantErr: true,
+		},
 		{
 			name:    "file is not valid syntax",
 			file:    []string{"testdata/invalid_bundle.yaml"},
@@ -58,7 +80,7 @@ func TestReadConfig(t *testing.T) {
 		{
 			name:    "file does not exist",
 			file:    []string{"farglebargle"},
-			want: nil,
+			want:    nil,
 			wantErr: true,
 		},
 	}
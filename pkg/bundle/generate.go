@@ -0,0 +1,211 @@
+/*
+Copyright © 2021 FairwindsOps Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bundle
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+	"helm.sh/helm/v3/pkg/chart"
+)
+
+// apiVersionLine finds the apiVersion of the objects in a template, templated apiVersions are skipped
+var apiVersionLine = regexp.MustCompile(`(?m)^\s*apiVersion:\s*["']?([^\s"'{}#]+)["']?\s*(#.*)?$`)
+
+// Generate drafts a bundle for upgrading a chart from one version to another by comparing the two charts.
+// It fills in the versions, the kubernetes versions from the kubeVersion of the target chart, the api versions
+// used by its templates and its values schema. The differences in values, values schemas, CRDs and kubeVersion
+// are added as warnings, which are meant to be reviewed and edited before the bundle is used.
+func Generate(from, to *chart.Chart, repository string) (*Bundle, error) {
+	if from.Metadata == nil || to.Metadata == nil {
+		return nil, fmt.Errorf("chart metadata is missing")
+	}
+	if from.Metadata.Name != to.Metadata.Name {
+		return nil, fmt.Errorf("charts %s and %s are not the same chart", from.Metadata.Name, to.Metadata.Name)
+	}
+
+	b := &Bundle{
+		Name:     to.Metadata.Name,
+		Versions: Versions{Start: from.Metadata.Version, End: to.Metadata.Version},
+		Source:   Source{Chart: to.Metadata.Name, Repository: repository},
+		CompatibleK8sVersions: K8sVersions{
+			Constraint: to.Metadata.KubeVersion,
+		},
+		NecessaryAPIVersions: templateAPIVersions(to),
+		ValuesSchema:         string(to.Schema),
+	}
+	if from.Metadata.AppVersion != to.Metadata.AppVersion {
+		b.Notes = fmt.Sprintf("Upgrades %s from app version %s to %s", to.Metadata.Name, from.Metadata.AppVersion, to.Metadata.AppVersion)
+	}
+
+	b.Warnings = append(b.Warnings, diffValues(from, to)...)
+	b.Warnings = append(b.Warnings, diffSchema(from, to)...)
+	b.Warnings = append(b.Warnings, diffCRDs(from, to)...)
+	if from.Metadata.KubeVersion != to.Metadata.KubeVersion {
+		b.Warnings = append(b.Warnings, fmt.Sprintf("kubeVersion changed from %q to %q in %s", from.Metadata.KubeVersion, to.Metadata.KubeVersion, to.Metadata.Version))
+	}
+	return b, nil
+}
+
+// diffValues describes the keys of the default values that were removed, added or whose default changed
+func diffValues(from, to *chart.Chart) []string {
+	oldValues := flattenValues(from.Values, "")
+	newValues := flattenValues(to.Values, "")
+	version := to.Metadata.Version
+
+	var warnings, added []string
+	for _, key := range sortedKeys(oldValues) {
+		newValue, ok := newValues[key]
+		if !ok {
+			warnings = append(warnings, fmt.Sprintf("values key %s was removed in %s, releases that set it need to be updated", key, version))
+			continue
+		}
+		if !reflect.DeepEqual(oldValues[key], newValue) {
+			warnings = append(warnings, fmt.Sprintf("default of values key %s changed from %v to %v in %s", key, oldValues[key], newValue, version))
+		}
+	}
+	for _, key := range sortedKeys(newValues) {
+		if _, ok := oldValues[key]; !ok {
+			added = append(added, key)
+		}
+	}
+	if len(added) > 0 {
+		warnings = append(warnings, fmt.Sprintf("values keys added in %s: %s", version, strings.Join(added, ", ")))
+	}
+	return warnings
+}
+
+// flattenValues maps the dotted path of every value that is not a map to the value
+func flattenValues(values map[string]interface{}, prefix string) map[string]interface{} {
+	flat := map[string]interface{}{}
+	for k, v := range values {
+		key := prefix + k
+		if nested, ok := v.(map[string]interface{}); ok && len(nested) > 0 {
+			for nk, nv := range flattenValues(nested, key+".") {
+				flat[nk] = nv
+			}
+			continue
+		}
+		flat[key] = v
+	}
+	return flat
+}
+
+// diffSchema describes changes to the values.schema.json of the chart
+func diffSchema(from, to *chart.Chart) []string {
+	version := to.Metadata.Version
+	switch {
+	case len(from.Schema) == 0 && len(to.Schema) > 0:
+		return []string{fmt.Sprintf("%s adds a values.schema.json, upgrades with values that do not match it will fail", version)}
+	case len(from.Schema) > 0 && len(to.Schema) == 0:
+		return []string{fmt.Sprintf("%s no longer ships a values.schema.json", version)}
+	case !bytes.Equal(from.Schema, to.Schema):
+		return []string{fmt.Sprintf("values.schema.json changed in %s, upgrades with values that do not match it will fail", version)}
+	}
+	return nil
+}
+
+// diffCRDs describes the CRDs that were added, changed or removed, which helm does not apply on upgrade
+func diffCRDs(from, to *chart.Chart) []string {
+	oldCRDs := chartCRDs(from)
+	newCRDs := chartCRDs(to)
+	version := to.Metadata.Version
+
+	var warnings []string
+	for _, name := range sortedKeys(newCRDs) {
+		old, ok := oldCRDs[name]
+		switch {
+		case !ok:
+			warnings = append(warnings, fmt.Sprintf("CRD %s was added in %s, helm does not install CRDs on upgrade so it must be applied manually", name, version))
+		case !bytes.Equal(old, newCRDs[name]):
+			warnings = append(warnings, fmt.Sprintf("CRD %s changed in %s, helm does not upgrade CRDs so it must be applied manually", name, version))
+		}
+	}
+	for _, name := range sortedKeys(oldCRDs) {
+		if _, ok := newCRDs[name]; !ok {
+			warnings = append(warnings, fmt.Sprintf("CRD %s is no longer shipped in %s", name, version))
+		}
+	}
+	return warnings
+}
+
+// chartCRDs maps the name of every CRD in the crds directory of a chart and its dependencies to its manifest
+func chartCRDs(c *chart.Chart) map[string][]byte {
+	crds := map[string][]byte{}
+	for _, obj := range c.CRDObjects() {
+		dec := yaml.NewDecoder(bytes.NewReader(obj.File.Data))
+		for {
+			var doc struct {
+				Metadata struct {
+					Name string `yaml:"name"`
+				} `yaml:"metadata"`
+			}
+			var node yaml.Node
+			if err := dec.Decode(&node); err != nil {
+				break
+			}
+			if err := node.Decode(&doc); err != nil || doc.Metadata.Name == "" {
+				continue
+			}
+			data, err := yaml.Marshal(&node)
+			if err != nil {
+				continue
+			}
+			crds[doc.Metadata.Name] = data
+		}
+	}
+	return crds
+}
+
+// templateAPIVersions returns the api group versions of the objects in the templates of a chart and its dependencies,
+// except for the core v1 api which every cluster serves
+func templateAPIVersions(c *chart.Chart) []string {
+	found := map[string]bool{}
+	var walk func(c *chart.Chart)
+	walk = func(c *chart.Chart) {
+		for _, t := range c.Templates {
+			for _, m := range apiVersionLine.FindAllSubmatch(t.Data, -1) {
+				if v := string(m[1]); v != "v1" {
+					found[v] = true
+				}
+			}
+		}
+		for _, dep := range c.Dependencies() {
+			walk(dep)
+		}
+	}
+	walk(c)
+	return sortedKeys(found)
+}
+
+// sortedKeys returns the keys of a map in order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	if len(keys) == 0 {
+		return nil
+	}
+	return keys
+}
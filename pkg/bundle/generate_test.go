@@ -0,0 +1,97 @@
+/*
+Copyright © 2021 FairwindsOps Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bundle
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+	"helm.sh/helm/v3/pkg/chart"
+)
+
+func TestGenerate(t *testing.T) {
+	crd := func(group string) *chart.File {
+		return &chart.File{Name: "crds/widgets.yaml", Data: []byte(`apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: widgets.example.com
+spec:
+  group: ` + group + `
+`)}
+	}
+	from := &chart.Chart{
+		Metadata: &chart.Metadata{Name: "widget", Version: "1.0.0", AppVersion: "2.0.0", KubeVersion: ">=1.20.0-0"},
+		Values: map[string]interface{}{
+			"replicas": 1,
+			"image":    map[string]interface{}{"tag": "2.0.0", "pullPolicy": "Always"},
+		},
+		Templates: []*chart.File{
+			{Name: "templates/deployment.yaml", Data: []byte("apiVersion: apps/v1\nkind: Deployment\n")},
+		},
+		Files: []*chart.File{crd("example.com")},
+	}
+	to := &chart.Chart{
+		Metadata: &chart.Metadata{Name: "widget", Version: "1.1.0", AppVersion: "2.1.0", KubeVersion: ">=1.23.0-0"},
+		Values: map[string]interface{}{
+			"replicas":  1,
+			"image":     map[string]interface{}{"tag": "2.1.0"},
+			"resources": map[string]interface{}{},
+		},
+		Templates: []*chart.File{
+			{Name: "templates/deployment.yaml", Data: []byte("apiVersion: apps/v1\nkind: Deployment\n")},
+			{Name: "templates/pdb.yaml", Data: []byte("{{- if .Values.pdb }}\napiVersion: \"policy/v1\"\nkind: PodDisruptionBudget\n{{- end }}\n")},
+			{Name: "templates/service.yaml", Data: []byte("apiVersion: v1\nkind: Service\n")},
+			{Name: "templates/hpa.yaml", Data: []byte("apiVersion: {{ include \"hpa.apiVersion\" . }}\nkind: HorizontalPodAutoscaler\n")},
+		},
+		Files:  []*chart.File{crd("widgets.example.com")},
+		Schema: []byte(`{"type": "object"}`),
+	}
+
+	got, err := Generate(from, to, "https://charts.example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, &Bundle{
+		Name:                  "widget",
+		Versions:              Versions{Start: "1.0.0", End: "1.1.0"},
+		Notes:                 "Upgrades widget from app version 2.0.0 to 2.1.0",
+		Source:                Source{Chart: "widget", Repository: "https://charts.example.com"},
+		CompatibleK8sVersions: K8sVersions{Constraint: ">=1.23.0-0"},
+		NecessaryAPIVersions:  []string{"apps/v1", "policy/v1"},
+		ValuesSchema:          `{"type": "object"}`,
+		Warnings: []string{
+			"values key image.pullPolicy was removed in 1.1.0, releases that set it need to be updated",
+			"default of values key image.tag changed from 2.0.0 to 2.1.0 in 1.1.0",
+			"values keys added in 1.1.0: resources",
+			"1.1.0 adds a values.schema.json, upgrades with values that do not match it will fail",
+			"CRD widgets.example.com changed in 1.1.0, helm does not upgrade CRDs so it must be applied manually",
+			`kubeVersion changed from ">=1.20.0-0" to ">=1.23.0-0" in 1.1.0`,
+		},
+	}, got)
+
+	data, err := yaml.Marshal(BundleConfig{TypeMeta: TypeMeta{APIVersion: LatestAPIVersion, Kind: Kind}, Addons: []*Bundle{got}})
+	assert.NoError(t, err)
+	file := filepath.Join(t.TempDir(), "generated.yaml")
+	assert.NoError(t, os.WriteFile(file, data, 0644))
+	problems, err := Lint([]string{file})
+	assert.NoError(t, err)
+	assert.Empty(t, problems, "generated bundles pass lint")
+
+	_, err = Generate(from, &chart.Chart{Metadata: &chart.Metadata{Name: "other", Version: "1.1.0"}}, "")
+	assert.Error(t, err)
+}
@@ -0,0 +1,104 @@
+/*
+Copyright © 2021 FairwindsOps Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bundle
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// readGit reads bundle spec files from a git repository, git::<repository>//<path>?ref=<ref>. path can be a file,
+// a directory or a glob within the repository and ref a branch, tag or commit, the default branch is read without it.
+func (l *Loader) readGit(ref string) ([]source, error) {
+	repository, path, revision, err := parseGitSource(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	dir, err := os.MkdirTemp("", "gonogo-git-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	if revision == "" {
+		revision = "HEAD"
+	}
+	for _, args := range [][]string{
+		{"init", "--quiet"},
+		{"fetch", "--quiet", "--depth", "1", "--", repository, revision},
+		{"checkout", "--quiet", "FETCH_HEAD"},
+	} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return nil, fmt.Errorf("%s: git %s failed: %v: %s", ref, args[0], err, strings.TrimSpace(string(out)))
+		}
+	}
+
+	local := filepath.Join(dir, filepath.FromSlash(path))
+	if rel, err := filepath.Rel(dir, local); err != nil || strings.HasPrefix(rel, "..") {
+		return nil, fmt.Errorf("%s: path %s is outside of the repository", ref, path)
+	}
+	sources, err := readLocal(local)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", ref, strings.ReplaceAll(err.Error(), dir+string(filepath.Separator), ""))
+	}
+	for i := range sources {
+		rel, _ := filepath.Rel(dir, sources[i].name)
+		sources[i].name = fmt.Sprintf("git::%s//%s", repository, filepath.ToSlash(rel))
+		if revision != "HEAD" {
+			sources[i].name += "?ref=" + url.QueryEscape(revision)
+		}
+	}
+	return sources, nil
+}
+
+// parseGitSource splits git::<repository>//<path>?ref=<ref> into its parts
+func parseGitSource(ref string) (repository, path, revision string, err error) {
+	rest := strings.TrimPrefix(ref, "git::")
+	if i := strings.LastIndex(rest, "?"); i >= 0 {
+		query, err := url.ParseQuery(rest[i+1:])
+		if err != nil {
+			return "", "", "", fmt.Errorf("invalid git source %s: %v", ref, err)
+		}
+		revision = query.Get("ref")
+		rest = rest[:i]
+	}
+
+	start := 0
+	if i := strings.Index(rest, "://"); i >= 0 {
+		start = i + len("://")
+	}
+	i := strings.Index(rest[start:], "//")
+	if i < 0 {
+		return "", "", "", fmt.Errorf("invalid git source %s, expected git::<repository>//<path>?ref=<ref>", ref)
+	}
+	repository, path = rest[:start+i], rest[start+i+2:]
+	if repository == "" || path == "" {
+		return "", "", "", fmt.Errorf("invalid git source %s, expected git::<repository>//<path>?ref=<ref>", ref)
+	}
+	// git would read them as options
+	if strings.HasPrefix(repository, "-") || strings.HasPrefix(revision, "-") {
+		return "", "", "", fmt.Errorf("invalid git source %s, the repository and ref can not start with -", ref)
+	}
+	return repository, path, revision, nil
+}
@@ -0,0 +1,361 @@
+/*
+Copyright © 2021 FairwindsOps Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bundle
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	mmsemver "github.com/Masterminds/semver/v3"
+	"github.com/blang/semver/v4"
+	"github.com/fairwindsops/insights-plugins/plugins/opa/pkg/rego"
+	"github.com/xeipuuv/gojsonschema"
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed bundle.schema.json
+var bundleSchema []byte
+
+var (
+	yamlLineRegexp     = regexp.MustCompile(`line (\d+)`)
+	apiVersionRegexp   = regexp.MustCompile(`^v[0-9]+((alpha|beta)[0-9]+)?$`)
+	resourceNameRegexp = regexp.MustCompile(`^[a-z0-9]([a-z0-9.-]*[a-z0-9])?$`)
+)
+
+// Schema returns the JSON Schema that describes the bundle spec file
+func Schema() []byte {
+	return bundleSchema
+}
+
+// LintError is a single problem found in a bundle spec file
+type LintError struct {
+	File    string `json:"file"`
+	Line    int    `json:"line"`
+	Column  int    `json:"column"`
+	Message string `json:"message"`
+}
+
+func (e LintError) Error() string {
+	return fmt.Sprintf("%s:%d:%d: %s", e.File, e.Line, e.Column, e.Message)
+}
+
+// Lint checks bundle spec files against the bundle schema and makes sure that every version, values schema,
+// opa check and resource path in them can be used. Problems in the files are returned as a list of LintErrors,
+// the error is only set when a file could not be read. The embedded bundles are linted when no files are supplied.
+func Lint(file []string) ([]LintError, error) {
+	return NewLoader(DefaultCacheDir()).Lint(file)
+}
+
+// Lint validates bundle spec files like the package level Lint, from any of the sources the Loader supports
+func (l *Loader) Lint(file []string) ([]LintError, error) {
+	sources, err := l.readSources(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var lintErrs []LintError
+	for _, src := range sources {
+		lintErrs = append(lintErrs, lintSource(src)...)
+	}
+
+	sort.SliceStable(lintErrs, func(i, j int) bool {
+		if lintErrs[i].File != lintErrs[j].File {
+			return lintErrs[i].File < lintErrs[j].File
+		}
+		return lintErrs[i].Line < lintErrs[j].Line
+	})
+	return lintErrs, nil
+}
+
+// linter collects the problems found in a single bundle spec file
+type linter struct {
+	src  source
+	root *yaml.Node
+	errs []LintError
+}
+
+// addf records a problem anchored to the yaml node found at path
+func (l *linter) addf(path []string, format string, args ...interface{}) {
+	line, column := 1, 1
+	if n := lookupNode(l.root, path); n != nil {
+		line, column = n.Line, n.Column
+	}
+	l.errs = append(l.errs, LintError{
+		File:    l.src.name,
+		Line:    line,
+		Column:  column,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// addYAMLError records a yaml parsing error, using the line number from the error message when there is one
+func (l *linter) addYAMLError(err error) {
+	line := 1
+	if m := yamlLineRegexp.FindStringSubmatch(err.Error()); m != nil {
+		line, _ = strconv.Atoi(m[1])
+	}
+	l.errs = append(l.errs, LintError{
+		File:    l.src.name,
+		Line:    line,
+		Column:  1,
+		Message: strings.TrimPrefix(err.Error(), "yaml: "),
+	})
+}
+
+func lintSource(src source) []LintError {
+	l := &linter{src: src, root: &yaml.Node{}}
+
+	if err := yaml.Unmarshal(src.data, l.root); err != nil {
+		l.addYAMLError(err)
+		return l.errs
+	}
+
+	var doc interface{}
+	if err := l.root.Decode(&doc); err != nil {
+		l.addYAMLError(err)
+		return l.errs
+	}
+	schemaValid := l.validateSchema(doc)
+
+	// the remaining checks only need the fields that decoded, type errors are already reported by the schema
+	var overlay Overlay
+	if err := l.root.Decode(&overlay); err != nil {
+		if schemaValid {
+			l.addYAMLError(err)
+		}
+		return l.errs
+	}
+
+	for i, addon := range overlay.Addons {
+		l.lintAddon([]string{"addons", strconv.Itoa(i)}, addon, false)
+	}
+	if mappingValue(lookupNode(l.root, nil), "kind") == KindOverlay {
+		for i, patch := range overlay.Patches {
+			l.lintPatch([]string{"patches", strconv.Itoa(i)}, patch)
+		}
+	}
+	return l.errs
+}
+
+// lintPatch checks the version constraint and merged fields of an overlay patch
+func (l *linter) lintPatch(path []string, patch *Patch) {
+	if patch.Versions != "" {
+		if _, err := mmsemver.NewConstraint(patch.Versions); err != nil {
+			l.addf(append(path, "versions"), "versions %q is not a valid constraint: %v", patch.Versions, err)
+		}
+	}
+	l.lintAddon(append(path, "merge"), &patch.Merge, true)
+}
+
+// validateSchema validates the decoded document against the bundle schema and returns true if it is valid
+func (l *linter) validateSchema(doc interface{}) bool {
+	// round trip through json so that the schema library sees the same types it would for a json document
+	b, err := json.Marshal(doc)
+	if err != nil {
+		l.addf(nil, "unable to convert bundle to json: %v", err)
+		return false
+	}
+
+	result, err := gojsonschema.Validate(gojsonschema.NewBytesLoader(bundleSchema), gojsonschema.NewBytesLoader(b))
+	if err != nil {
+		l.addf(nil, "unable to validate bundle against schema: %v", err)
+		return false
+	}
+
+	for _, re := range result.Errors() {
+		// the bundle and overlay schemas are chosen by kind, only report the errors of the chosen one
+		if re.Type() == "condition_then" || re.Type() == "condition_else" {
+			continue
+		}
+		var path []string
+		if field := re.Field(); field != gojsonschema.STRING_ROOT_SCHEMA_PROPERTY {
+			path = strings.Split(field, ".")
+		}
+		if re.Type() == "additional_property_not_allowed" {
+			path = append(path, fmt.Sprint(re.Details()["property"]))
+		}
+		l.addf(path, "%s: %s", re.Field(), re.Description())
+	}
+	return result.Valid()
+}
+
+// lintAddon checks the fields of a bundle. Partial bundles from overlay patches may leave the versions out.
+func (l *linter) lintAddon(path []string, addon *Bundle, partial bool) {
+	at := func(keys ...string) []string {
+		return append(append([]string{}, path...), keys...)
+	}
+
+	if !partial || addon.Versions != (Versions{}) {
+		l.lintVersions(at("versions"), addon.Versions)
+	}
+
+	minVer, minErr := l.parseK8sVersion(at("compatible_k8s_versions", "min"), addon.CompatibleK8sVersions.Min)
+	maxVer, maxErr := l.parseK8sVersion(at("compatible_k8s_versions", "max"), addon.CompatibleK8sVersions.Max)
+	if minErr == nil && maxErr == nil && addon.CompatibleK8sVersions.Min != "" && addon.CompatibleK8sVersions.Max != "" && minVer.GT(maxVer) {
+		l.addf(at("compatible_k8s_versions"), "compatible_k8s_versions.min %s is greater than compatible_k8s_versions.max %s", minVer, maxVer)
+	}
+
+	if c := addon.Match.AppVersion; c != "" {
+		if _, err := mmsemver.NewConstraint(c); err != nil {
+			l.addf(at("match", "app_version"), "match.app_version %q is not a valid constraint: %v", c, err)
+		}
+	}
+
+	if c := addon.CompatibleK8sVersions.Constraint; c != "" {
+		if _, err := mmsemver.NewConstraint(c); err != nil {
+			l.addf(at("compatible_k8s_versions", "constraint"), "compatible_k8s_versions.constraint %q is not a valid constraint: %v", c, err)
+		}
+	}
+
+	if strings.TrimSpace(addon.ValuesSchema) != "" {
+		if !json.Valid([]byte(addon.ValuesSchema)) {
+			l.addf(at("values_schema"), "values_schema is not valid json")
+		} else if _, err := gojsonschema.NewSchema(gojsonschema.NewStringLoader(addon.ValuesSchema)); err != nil {
+			l.addf(at("values_schema"), "values_schema is not a valid json schema: %v", err)
+		}
+	}
+
+	for i, check := range addon.OpaChecks {
+		if _, err := rego.GetRegoQuery(check, rego.NilDataFunction{}, nil).PrepareForEval(context.TODO()); err != nil {
+			l.addf(at("opa_checks", strconv.Itoa(i)), "opa_checks[%d] does not compile: %v", i, err)
+		}
+	}
+
+	for i, sc := range addon.StatusChecks {
+		for j, check := range sc.OpaChecks {
+			if _, err := rego.GetRegoQuery(check, rego.NilDataFunction{}, nil).PrepareForEval(context.TODO()); err != nil {
+				l.addf(at("status_checks", strconv.Itoa(i), "opa_checks", strconv.Itoa(j)), "status_checks[%d].opa_checks[%d] does not compile: %v", i, j, err)
+			}
+		}
+	}
+
+	for i, r := range addon.Resources {
+		if _, _, _, err := ParseResourcePath(r); err != nil {
+			l.addf(at("resources", strconv.Itoa(i)), "resources[%d]: %v", i, err)
+		}
+	}
+}
+
+// lintVersions checks that either from and to, or start and end are usable
+func (l *linter) lintVersions(path []string, v Versions) {
+	at := func(key string) []string {
+		return append(append([]string{}, path...), key)
+	}
+
+	if v.From != "" || v.To != "" {
+		if v.Start != "" || v.End != "" {
+			l.addf(path, "versions must set either from and to, or start and end")
+		}
+		if _, err := mmsemver.NewConstraint(v.From); err != nil {
+			l.addf(at("from"), "versions.from %q is not a valid constraint: %v", v.From, err)
+		}
+		if _, err := mmsemver.NewVersion(v.To); err != nil {
+			l.addf(at("to"), "versions.to %q is not a valid version: %v", v.To, err)
+		}
+		return
+	}
+
+	start, startErr := mmsemver.NewVersion(v.Start)
+	if startErr != nil {
+		l.addf(at("start"), "versions.start %q is not a valid version: %v", v.Start, startErr)
+	}
+	end, endErr := mmsemver.NewVersion(v.End)
+	if endErr != nil {
+		l.addf(at("end"), "versions.end %q is not a valid version: %v", v.End, endErr)
+	}
+	if startErr == nil && endErr == nil && !start.LessThan(end) {
+		l.addf(path, "versions.start %s must be lower than versions.end %s", start, end)
+	}
+}
+
+// parseK8sVersion parses an optional kubernetes version from the bundle and records a problem if it is invalid
+func (l *linter) parseK8sVersion(path []string, v string) (semver.Version, error) {
+	if v == "" {
+		return semver.Version{}, nil
+	}
+	ver, err := semver.ParseTolerant(v)
+	if err != nil {
+		l.addf(path, "%s %q is not a valid kubernetes version: %v", strings.Join(path[len(path)-2:], "."), v, err)
+	}
+	return ver, err
+}
+
+// ParseResourcePath splits a resource defined in a bundle in the form group/version/resource
+// or version/resource for the core group into its parts
+func ParseResourcePath(path string) (group, version, resource string, err error) {
+	parts := strings.Split(path, "/")
+	switch len(parts) {
+	case 3:
+		group, version, resource = parts[0], parts[1], parts[2]
+		if !resourceNameRegexp.MatchString(group) {
+			return "", "", "", fmt.Errorf("%q has an invalid api group %q", path, group)
+		}
+	case 2:
+		version, resource = parts[0], parts[1]
+	default:
+		return "", "", "", fmt.Errorf("%q must be in the form group/version/resource or version/resource", path)
+	}
+	if !apiVersionRegexp.MatchString(version) {
+		return "", "", "", fmt.Errorf("%q has an invalid api version %q", path, version)
+	}
+	if !resourceNameRegexp.MatchString(resource) {
+		return "", "", "", fmt.Errorf("%q has an invalid resource name %q", path, resource)
+	}
+	return group, version, resource, nil
+}
+
+// lookupNode walks a yaml document along path and returns the deepest node it can find.
+// Mapping keys resolve to the key node so that problems point at the line the key is on.
+func lookupNode(root *yaml.Node, path []string) *yaml.Node {
+	n := root
+	if n.Kind == yaml.DocumentNode && len(n.Content) > 0 {
+		n = n.Content[0]
+	}
+	for i, p := range path {
+		switch n.Kind {
+		case yaml.MappingNode:
+			found := false
+			for j := 0; j+1 < len(n.Content); j += 2 {
+				if n.Content[j].Value == p {
+					if i == len(path)-1 {
+						return n.Content[j]
+					}
+					n, found = n.Content[j+1], true
+					break
+				}
+			}
+			if !found {
+				return n
+			}
+		case yaml.SequenceNode:
+			idx, err := strconv.Atoi(p)
+			if err != nil || idx < 0 || idx >= len(n.Content) {
+				return n
+			}
+			n = n.Content[idx]
+		default:
+			return n
+		}
+	}
+	return n
+}
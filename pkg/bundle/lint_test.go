@@ -0,0 +1,152 @@
+/*
+Copyright © 2021 FairwindsOps Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bundle
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLint(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    []string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "embedded bundles are valid",
+			file: []string{},
+			want: nil,
+		},
+		{
+			name: "valid bundle",
+			file: []string{"testdata/lint_valid.yaml"},
+			want: nil,
+		},
+		{
+			name: "invalid bundle",
+			file: []string{"testdata/lint_invalid.yaml"},
+			want: []string{
+				`testdata/lint_invalid.yaml:4:5: versions.start "latest" is not a valid version: Invalid Semantic Version`,
+				`testdata/lint_invalid.yaml:8:3: addons.0: Additional property compatible_k8s_version is not allowed`,
+				`testdata/lint_invalid.yaml:11:3: versions.start 3.9.1 must be lower than versions.end 3.5.0`,
+				`testdata/lint_invalid.yaml:16:3: compatible_k8s_versions.min 1.24.0 is greater than compatible_k8s_versions.max 1.23.0`,
+				`testdata/lint_invalid.yaml:19:3: values_schema is not valid json`,
+				`testdata/lint_invalid.yaml:21:5: resources[0]: "v1/secrets/extra/parts" must be in the form group/version/resource or version/resource`,
+				`testdata/lint_invalid.yaml:26:5: versions.from ">= banana" is not a valid constraint: improper constraint: >= banana`,
+				`testdata/lint_invalid.yaml:31:5: compatible_k8s_versions.constraint "banana" is not a valid constraint: improper constraint: banana`,
+				`testdata/lint_invalid.yaml:33:3: versions must set either from and to, or start and end`,
+				`testdata/lint_invalid.yaml:46:5: match.app_version "banana" is not a valid constraint: improper constraint: banana`,
+				`testdata/lint_invalid.yaml:47:5: addons.4.match: Additional property namespace is not allowed`,
+			},
+		},
+		{
+			name: "valid overlay",
+			file: []string{"testdata/overlay.yaml"},
+			want: nil,
+		},
+		{
+			name: "invalid overlay",
+			file: []string{"testdata/overlay_invalid.yaml"},
+			want: []string{
+				`testdata/overlay_invalid.yaml:5:3: versions ">= banana" is not a valid constraint: improper constraint: >= banana`,
+				`testdata/overlay_invalid.yaml:8:5: patches.0.disable: Additional property notes is not allowed`,
+			},
+		},
+		{
+			name: "unsupported bundle version",
+			file: []string{"testdata/bundle_unknown_version.yaml"},
+			want: []string{
+				`testdata/bundle_unknown_version.yaml:1:1: apiVersion: apiVersion must be one of the following: "gonogo.fairwinds.com/v1alpha1"`,
+			},
+		},
+		{
+			name: "file is not valid syntax",
+			file: []string{"testdata/invalid_bundle.yaml"},
+			want: []string{
+				`testdata/invalid_bundle.yaml:1:1: (root): Invalid type. Expected: object, given: string`,
+			},
+		},
+		{
+			name:    "file does not exist",
+			file:    []string{"farglebargle"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Lint(tt.file)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+
+			var msgs []string
+			for _, e := range got {
+				msgs = append(msgs, e.Error())
+			}
+			for _, w := range tt.want {
+				assert.Contains(t, msgs, w)
+			}
+			if tt.want == nil {
+				assert.Empty(t, msgs)
+			}
+		})
+	}
+}
+
+func TestLintOpaChecks(t *testing.T) {
+	got, err := Lint([]string{"testdata/lint_invalid.yaml"})
+	assert.NoError(t, err)
+	found := false
+	for _, e := range got {
+		if e.Line == 23 {
+			found = true
+			assert.Contains(t, e.Message, "opa_checks[0] does not compile")
+		}
+	}
+	assert.True(t, found, "expected an error for the opa check on line 23")
+}
+
+func TestParseResourcePath(t *testing.T) {
+	tests := []struct {
+		path    string
+		want    []string
+		wantErr bool
+	}{
+		{path: "apps/v1/deployments", want: []string{"apps", "v1", "deployments"}},
+		{path: "v1/secrets", want: []string{"", "v1", "secrets"}},
+		{path: "networking.k8s.io/v1beta1/ingresses", want: []string{"networking.k8s.io", "v1beta1", "ingresses"}},
+		{path: "secrets", wantErr: true},
+		{path: "apps/1/deployments", wantErr: true},
+		{path: "apps/v1/Deployments", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			g, v, r, err := ParseResourcePath(tt.path)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, []string{g, v, r})
+		})
+	}
+}
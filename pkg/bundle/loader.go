@@ -0,0 +1,425 @@
+/*
+Copyright © 2021 FairwindsOps Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bundle
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	multierror "github.com/hashicorp/go-multierror"
+	"k8s.io/klog"
+)
+
+// digestPin is a sha256 digest at the end of a bundle source that the content read from it must match
+var digestPin = regexp.MustCompile(`@(sha256:[a-f0-9]{64})$`)
+
+// Loader reads bundle spec files from local paths, directories and globs, stdin, http urls, oci registries
+// and git repositories. Remote sources are cached so that pinned sources are only downloaded once, and so that
+// unpinned sources can still be read when they can not be downloaded.
+type Loader struct {
+	CacheDir   string    // directory remote bundles are cached in, nothing is cached when it is empty
+	Stdin      io.Reader // read for the - source
+	HTTPClient *http.Client
+}
+
+// NewLoader returns a Loader that caches remote bundles in cacheDir and reads - from os.Stdin
+func NewLoader(cacheDir string) *Loader {
+	return &Loader{
+		CacheDir:   cacheDir,
+		Stdin:      os.Stdin,
+		HTTPClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// DefaultCacheDir is the directory remote bundles are cached in by default
+func DefaultCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "gonogo", "bundles")
+}
+
+// readSources reads the supplied bundle spec files, or the embedded default bundles when no files are supplied
+func (l *Loader) readSources(file []string) ([]source, error) {
+	var allErrs error = nil
+	var sources []source
+
+	if len(file) == 0 {
+		files, err := defaultBundle.ReadDir("bundles")
+		if err != nil {
+			return nil, fmt.Errorf("unable to process bundles: %v", err)
+		}
+
+		for _, file := range files {
+			name := filepath.Join("bundles", file.Name())
+			f, err := defaultBundle.ReadFile(name)
+			if err != nil {
+				allErrs = multierror.Append(allErrs, fmt.Errorf("unable to read file: %v", err))
+				continue
+			}
+			sources = append(sources, source{name: name, data: f})
+		}
+		return sources, allErrs
+	}
+
+	stdinRead := false
+	for _, ref := range file {
+		if ref == "-" {
+			if stdinRead {
+				allErrs = multierror.Append(allErrs, fmt.Errorf("stdin can only be read once"))
+				continue
+			}
+			stdinRead = true
+		}
+		s, err := l.read(ref)
+		if err != nil {
+			allErrs = multierror.Append(allErrs, fmt.Errorf("unable to read file: %v", err))
+			continue
+		}
+		sources = append(sources, s...)
+	}
+	return sources, allErrs
+}
+
+// read reads the bundle spec files of a single source. A source can end in @sha256:<digest> to pin its content,
+// which is the digest of the manifest for oci sources and the digest of the file for every other source.
+func (l *Loader) read(ref string) ([]source, error) {
+	pin := ""
+	if m := digestPin.FindStringSubmatch(ref); m != nil {
+		pin = m[1]
+		ref = strings.TrimSuffix(ref, "@"+pin)
+	}
+
+	verify := func(sources []source) error { return checkPin(ref, pin, sources) }
+	var sources []source
+	var err error
+	switch {
+	case ref == "-":
+		sources, err = l.readStdin()
+	case strings.HasPrefix(ref, "oci://"):
+		// the manifest digest is checked by readOCI before anything is cached
+		return l.cached(ref, pin, func() ([]source, error) { return l.readOCI(ref, pin) }, nil)
+	case strings.HasPrefix(ref, "git::"):
+		return l.cached(ref, pin, func() ([]source, error) { return l.readGit(ref) }, verify)
+	case strings.HasPrefix(ref, "https://"), strings.HasPrefix(ref, "http://"):
+		return l.cached(ref, pin, func() ([]source, error) { return l.readHTTP(ref) }, verify)
+	default:
+		sources, err = readLocal(ref)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := verify(sources); err != nil {
+		return nil, err
+	}
+	return sources, nil
+}
+
+// checkPin checks that the sources read from ref are a single file with the pinned digest, when there is one
+func checkPin(ref, pin string, sources []source) error {
+	if pin == "" {
+		return nil
+	}
+	if len(sources) != 1 {
+		return fmt.Errorf("%s: a digest can only pin a single file, found %d", ref, len(sources))
+	}
+	if got := sha256Digest(sources[0].data); got != pin {
+		return fmt.Errorf("%s: digest %s does not match pinned digest %s", ref, got, pin)
+	}
+	return nil
+}
+
+// readStdin reads a bundle spec file from stdin
+func (l *Loader) readStdin() ([]source, error) {
+	if l.Stdin == nil {
+		return nil, fmt.Errorf("stdin is not available")
+	}
+	data, err := io.ReadAll(l.Stdin)
+	if err != nil {
+		return nil, err
+	}
+	return []source{{name: "-", data: data}}, nil
+}
+
+// readHTTP downloads a bundle spec file
+func (l *Loader) readHTTP(url string) ([]source, error) {
+	client := l.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: unexpected status %s", url, resp.Status)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	return []source{{name: url, data: data}}, nil
+}
+
+// readLocal reads a bundle spec file, every .yaml and .yml file in a directory and its subdirectories,
+// or every file matching a glob where ** matches any number of directories
+func readLocal(path string) ([]source, error) {
+	var files []string
+	switch info, err := os.Stat(path); {
+	case err == nil && info.IsDir():
+		files = findBundleFiles(path)
+	case err == nil:
+		files = []string{path}
+	case strings.ContainsAny(path, "*?["):
+		files, err = globFiles(path)
+		if err != nil {
+			return nil, err
+		}
+		if len(files) == 0 {
+			return nil, fmt.Errorf("no files match %s", path)
+		}
+	default:
+		return nil, err
+	}
+
+	var sources []source
+	for _, f := range files {
+		data, err := os.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, source{name: f, data: data})
+	}
+	return sources, nil
+}
+
+// findBundleFiles returns every .yaml and .yml file in a directory and its subdirectories
+func findBundleFiles(dir string) []string {
+	var files []string
+	_ = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && isYAML(path) {
+			files = append(files, path)
+		}
+		return nil
+	})
+	return files
+}
+
+// globFiles returns the files that match a glob pattern where * and ? do not match /, and ** matches
+// any number of directories
+func globFiles(pattern string) ([]string, error) {
+	pattern = filepath.ToSlash(pattern)
+	root := "."
+	if i := strings.IndexAny(pattern, "*?["); i > 0 {
+		if j := strings.LastIndex(pattern[:i], "/"); j >= 0 {
+			root = pattern[:j]
+			if root == "" {
+				root = "/"
+			}
+		}
+	}
+
+	expr, err := globRegexp(pattern)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && expr.MatchString(filepath.ToSlash(path)) {
+			files = append(files, path)
+		}
+		return nil
+	})
+	sort.Strings(files)
+	return files, err
+}
+
+// globRegexp converts a glob pattern to a regular expression
+func globRegexp(pattern string) (*regexp.Regexp, error) {
+	pattern = strings.TrimPrefix(pattern, "./")
+	var expr strings.Builder
+	expr.WriteString("^(\\./)?")
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '*':
+			if strings.HasPrefix(pattern[i:], "**/") {
+				expr.WriteString("(.*/)?")
+				i += 2
+			} else if strings.HasPrefix(pattern[i:], "**") {
+				expr.WriteString(".*")
+				i++
+			} else {
+				expr.WriteString("[^/]*")
+			}
+		case '?':
+			expr.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(pattern[i:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("invalid glob %s", pattern)
+			}
+			expr.WriteString(pattern[i : i+end+1])
+			i += end
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	expr.WriteString("$")
+	return regexp.Compile(expr.String())
+}
+
+// cachedSource is an entry in the index of a cached remote source
+type cachedSource struct {
+	Name string `json:"name"`
+	File string `json:"file"`
+}
+
+// cached reads a remote source through the cache. Pinned sources are read from the cache when they are in it.
+// Other sources are always downloaded, and the cached copy is only used when downloading fails. When verify is
+// set, downloads are only cached once they pass it and cached copies that fail it are downloaded again.
+func (l *Loader) cached(ref, pin string, fetch func() ([]source, error), verify func([]source) error) ([]source, error) {
+	if verify == nil {
+		verify = func([]source) error { return nil }
+	}
+	if l.CacheDir == "" {
+		sources, err := fetch()
+		if err != nil {
+			return nil, err
+		}
+		if err := verify(sources); err != nil {
+			return nil, err
+		}
+		return sources, nil
+	}
+	key := ref
+	if pin != "" {
+		key += "@" + pin
+	}
+	dir := filepath.Join(l.CacheDir, sha256Digest([]byte(key))[len("sha256:"):])
+
+	if pin != "" {
+		if sources, err := readCache(dir); err == nil {
+			if err := verify(sources); err == nil {
+				klog.V(3).Infof("using cached copy of %s", key)
+				return sources, nil
+			}
+			klog.Warningf("cached copy of %s is corrupt, downloading it again: %v", key, err)
+		}
+	}
+
+	sources, err := fetch()
+	if err == nil {
+		err = verify(sources)
+	}
+	if err != nil {
+		if pin == "" {
+			if cachedSources, cacheErr := readCache(dir); cacheErr == nil {
+				klog.Warningf("using cached copy of %s: %v", key, err)
+				return cachedSources, nil
+			}
+		}
+		return nil, err
+	}
+	if err := writeCache(dir, sources); err != nil {
+		klog.Warningf("unable to cache %s: %v", key, err)
+	}
+	return sources, nil
+}
+
+// readCache reads the sources cached in dir
+func readCache(dir string) ([]source, error) {
+	data, err := os.ReadFile(filepath.Join(dir, "index.json"))
+	if err != nil {
+		return nil, err
+	}
+	var index []cachedSource
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, err
+	}
+	var sources []source
+	for _, c := range index {
+		data, err := os.ReadFile(filepath.Join(dir, c.File))
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, source{name: c.Name, data: data})
+	}
+	return sources, nil
+}
+
+// writeCache replaces the sources cached in dir
+func writeCache(dir string, sources []source) error {
+	if err := os.MkdirAll(filepath.Dir(dir), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.MkdirTemp(filepath.Dir(dir), ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	var index []cachedSource
+	for i, s := range sources {
+		file := fmt.Sprintf("%d.yaml", i)
+		if err := os.WriteFile(filepath.Join(tmp, file), s.data, 0o644); err != nil {
+			return err
+		}
+		index = append(index, cachedSource{Name: s.name, File: file})
+	}
+	data, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(tmp, "index.json"), data, 0o644); err != nil {
+		return err
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+	return os.Rename(tmp, dir)
+}
+
+// sha256Digest returns the digest of data in the form sha256:<hex>
+func sha256Digest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// isYAML reports whether a file name has a yaml extension
+func isYAML(name string) bool {
+	ext := filepath.Ext(name)
+	return ext == ".yaml" || ext == ".yml"
+}
@@ -0,0 +1,261 @@
+/*
+Copyright © 2021 FairwindsOps Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bundle
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoaderLocal(t *testing.T) {
+	dir := t.TempDir()
+	data, err := os.ReadFile("testdata/bundle_v1alpha1.yaml")
+	assert.NoError(t, err)
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "nested", "deeper"), 0o755))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "a.yaml"), data, 0o644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "nested", "b.yml"), data, 0o644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "nested", "deeper", "c.yaml"), data, 0o644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "nested", "notes.txt"), []byte("not a bundle"), 0o644))
+
+	l := &Loader{Stdin: strings.NewReader(string(data))}
+	tests := []struct {
+		name    string
+		file    []string
+		want    int
+		wantErr bool
+	}{
+		{name: "file", file: []string{filepath.Join(dir, "a.yaml")}, want: 1},
+		{name: "directory", file: []string{dir}, want: 3},
+		{name: "glob", file: []string{filepath.Join(dir, "*.yaml")}, want: 1},
+		{name: "recursive glob", file: []string{filepath.Join(dir, "**", "*.y*ml")}, want: 3},
+		{name: "recursive glob in subdirectory", file: []string{filepath.Join(dir, "nested", "**", "*.yaml")}, want: 1},
+		{name: "glob without matches", file: []string{filepath.Join(dir, "**", "*.json")}, wantErr: true},
+		{name: "stdin", file: []string{"-"}, want: 1},
+		{name: "stdin twice", file: []string{"-", "-"}, wantErr: true},
+		{name: "pinned file", file: []string{filepath.Join(dir, "a.yaml") + "@" + sha256Digest(data)}, want: 1},
+		{name: "pin mismatch", file: []string{filepath.Join(dir, "a.yaml") + "@" + sha256Digest([]byte("other"))}, wantErr: true},
+		{name: "pinned directory", file: []string{dir + "@" + sha256Digest(data)}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l.Stdin = strings.NewReader(string(data))
+			got, err := l.ReadConfig(tt.file)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Len(t, got.Addons, tt.want)
+		})
+	}
+}
+
+func TestLoaderHTTP(t *testing.T) {
+	data, err := os.ReadFile("testdata/bundle_v1alpha1.yaml")
+	assert.NoError(t, err)
+	up := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !up || r.URL.Path != "/bundle.yaml" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write(data)
+	}))
+	defer server.Close()
+
+	l := &Loader{CacheDir: t.TempDir()}
+	got, err := l.ReadConfig([]string{server.URL + "/bundle.yaml"})
+	assert.NoError(t, err)
+	assert.Len(t, got.Addons, 1)
+
+	_, err = l.ReadConfig([]string{server.URL + "/missing.yaml"})
+	assert.Error(t, err)
+
+	pinned := server.URL + "/bundle.yaml@" + sha256Digest(data)
+	_, err = l.ReadConfig([]string{pinned})
+	assert.NoError(t, err)
+
+	up = false
+	got, err = l.ReadConfig([]string{server.URL + "/bundle.yaml"})
+	assert.NoError(t, err, "the cached copy is used when the server is down")
+	assert.Len(t, got.Addons, 1)
+	got, err = l.ReadConfig([]string{pinned})
+	assert.NoError(t, err, "pinned sources are read from the cache")
+	assert.Len(t, got.Addons, 1)
+
+	_, err = (&Loader{}).ReadConfig([]string{server.URL + "/bundle.yaml"})
+	assert.Error(t, err, "nothing is cached without a cache directory")
+}
+
+func TestLoaderHTTPPinnedMismatch(t *testing.T) {
+	data, err := os.ReadFile("testdata/bundle_v1alpha1.yaml")
+	assert.NoError(t, err)
+	wrong := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if wrong {
+			wrong = false
+			_, _ = w.Write([]byte("addons: []"))
+			return
+		}
+		_, _ = w.Write(data)
+	}))
+	defer server.Close()
+
+	cache := t.TempDir()
+	l := &Loader{CacheDir: cache}
+	pinned := server.URL + "/bundle.yaml@" + sha256Digest(data)
+	_, err = l.ReadConfig([]string{pinned})
+	assert.Error(t, err, "a download that does not match the pin fails")
+	got, err := l.ReadConfig([]string{pinned})
+	assert.NoError(t, err, "a download that does not match the pin is not cached")
+	assert.Len(t, got.Addons, 1)
+
+	files, err := filepath.Glob(filepath.Join(cache, "*", "*.yaml"))
+	assert.NoError(t, err)
+	assert.Len(t, files, 1)
+	assert.NoError(t, os.WriteFile(files[0], []byte("addons: []"), 0o644))
+	got, err = l.ReadConfig([]string{pinned})
+	assert.NoError(t, err, "a cached copy that does not match the pin is downloaded again")
+	assert.Len(t, got.Addons, 1)
+	cached, err := os.ReadFile(files[0])
+	assert.NoError(t, err)
+	assert.Equal(t, data, cached)
+}
+
+func TestLoaderOCI(t *testing.T) {
+	data, err := os.ReadFile("testdata/bundle_v1alpha1.yaml")
+	assert.NoError(t, err)
+	manifest, err := json.Marshal(map[string]interface{}{
+		"schemaVersion": 2,
+		"mediaType":     "application/vnd.oci.image.manifest.v1+json",
+		"layers": []ociDescriptor{
+			{MediaType: BundleMediaType, Digest: sha256Digest(data), Annotations: map[string]string{ociTitleAnnotation: "bundle.yaml"}},
+			{MediaType: "application/octet-stream", Digest: sha256Digest([]byte("readme")), Annotations: map[string]string{ociTitleAnnotation: "README.md"}},
+		},
+	})
+	assert.NoError(t, err)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "repository:bundles/addons:pull", r.URL.Query().Get("scope"))
+		_, _ = w.Write([]byte(`{"token": "secret"}`))
+	})
+	var registry *httptest.Server
+	mux.HandleFunc("/v2/bundles/addons/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="test"`, registry.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/v2/bundles/addons/manifests/v1", "/v2/bundles/addons/manifests/" + sha256Digest(manifest):
+			_, _ = w.Write(manifest)
+		case "/v2/bundles/addons/blobs/" + sha256Digest(data):
+			_, _ = w.Write(data)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	registry = httptest.NewServer(mux)
+	defer registry.Close()
+	host := strings.TrimPrefix(registry.URL, "http://")
+
+	l := &Loader{}
+	got, err := l.ReadConfig([]string{fmt.Sprintf("oci://%s/bundles/addons:v1", host)})
+	assert.NoError(t, err)
+	assert.Len(t, got.Addons, 1)
+
+	_, err = l.ReadConfig([]string{fmt.Sprintf("oci://%s/bundles/addons@%s", host, sha256Digest(manifest))})
+	assert.NoError(t, err)
+
+	_, err = l.ReadConfig([]string{fmt.Sprintf("oci://%s/bundles/addons:v2", host)})
+	assert.Error(t, err)
+}
+
+func TestLoaderGit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	data, err := os.ReadFile("testdata/bundle_v1alpha1.yaml")
+	assert.NoError(t, err)
+
+	repo := t.TempDir()
+	assert.NoError(t, os.MkdirAll(filepath.Join(repo, "bundles"), 0o755))
+	assert.NoError(t, os.WriteFile(filepath.Join(repo, "bundles", "addons.yaml"), data, 0o644))
+	for _, args := range [][]string{
+		{"init", "--quiet"},
+		{"add", "."},
+		{"-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "--quiet", "-m", "bundles"},
+		{"tag", "v1"},
+	} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = repo
+		out, err := cmd.CombinedOutput()
+		assert.NoError(t, err, string(out))
+	}
+
+	l := &Loader{}
+	for _, ref := range []string{
+		"git::file://" + repo + "//bundles?ref=v1",
+		"git::file://" + repo + "//bundles/addons.yaml",
+		"git::file://" + repo + "//bundles/*.yaml@" + sha256Digest(data),
+	} {
+		got, err := l.ReadConfig([]string{ref})
+		assert.NoError(t, err, ref)
+		if assert.NotNil(t, got, ref) {
+			assert.Len(t, got.Addons, 1, ref)
+		}
+	}
+
+	_, err = l.ReadConfig([]string{"git::file://" + repo + "//bundles?ref=v2"})
+	assert.Error(t, err)
+	_, err = l.ReadConfig([]string{"git::file://" + repo + "//../outside.yaml"})
+	assert.Error(t, err)
+}
+
+func TestParseSources(t *testing.T) {
+	host, name, tag, err := parseOCIReference("oci://ghcr.io/fairwindsops/bundles:v1")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"ghcr.io", "fairwindsops/bundles", "v1"}, []string{host, name, tag})
+	host, name, tag, err = parseOCIReference("oci://localhost:5000/bundles")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"localhost:5000", "bundles", "latest"}, []string{host, name, tag})
+	_, _, _, err = parseOCIReference("oci://ghcr.io")
+	assert.Error(t, err)
+
+	repo, path, ref, err := parseGitSource("git::https://github.com/fairwindsops/bundles.git//addons/metrics-server.yaml?ref=v1.2.0")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"https://github.com/fairwindsops/bundles.git", "addons/metrics-server.yaml", "v1.2.0"}, []string{repo, path, ref})
+	repo, path, ref, err = parseGitSource("git::git@github.com:fairwindsops/bundles.git//addons")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"git@github.com:fairwindsops/bundles.git", "addons", ""}, []string{repo, path, ref})
+	_, _, _, err = parseGitSource("git::https://github.com/fairwindsops/bundles.git")
+	assert.Error(t, err)
+	_, _, _, err = parseGitSource("git::https://github.com/fairwindsops/bundles.git//addons?ref=--upload-pack=touch%20/tmp/pwned")
+	assert.Error(t, err)
+	_, _, _, err = parseGitSource("git::--upload-pack=touch /tmp/pwned//addons")
+	assert.Error(t, err)
+}
@@ -0,0 +1,154 @@
+/*
+Copyright © 2021 FairwindsOps Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bundle
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	"helm.sh/helm/v3/pkg/chart"
+)
+
+// Match criteria names reported for releases that matched a bundle
+const (
+	MatchChart        = "chart"
+	MatchVersions     = "versions"
+	MatchHome         = "home"
+	MatchSources      = "sources"
+	MatchMaintainers  = "maintainers"
+	MatchAnnotations  = "annotations"
+	MatchAppVersion   = "app_version"
+	MatchReleaseNames = "release_names"
+	MatchNamespaces   = "namespaces"
+)
+
+// Match narrows down the releases a bundle applies to beyond the chart name and version.
+// Every criterion that is set must match. Patterns may use * and ? wildcards.
+type Match struct {
+	Home         []string          `yaml:"home,omitempty"`          // patterns for the chart home url
+	Sources      []string          `yaml:"sources,omitempty"`       // patterns for the chart source urls
+	Maintainers  []string          `yaml:"maintainers,omitempty"`   // patterns for the chart maintainer names, emails or urls
+	Annotations  map[string]string `yaml:"annotations,omitempty"`   // chart annotations that must be present, values are patterns
+	AppVersion   string            `yaml:"app_version,omitempty"`   // semver constraint for the chart appVersion
+	ReleaseNames []string          `yaml:"release_names,omitempty"` // patterns for the helm release name
+	Namespaces   []string          `yaml:"namespaces,omitempty"`    // patterns for the helm release namespace
+}
+
+// MatchRelease reports whether a release with the chart metadata, name and namespace is covered by the bundle.
+// The chart name and version always have to match, along with every criterion in Match that is set.
+// The names of the criteria that matched are returned.
+func (b *Bundle) MatchRelease(metadata *chart.Metadata, releaseName, namespace string) ([]string, bool, error) {
+	if metadata == nil || b.Source.Chart != metadata.Name {
+		return nil, false, nil
+	}
+
+	ok, err := b.Versions.Matches(metadata.Version)
+	if err != nil || !ok {
+		return nil, false, err
+	}
+
+	matched, ok, err := b.Match.Matches(metadata, releaseName, namespace)
+	if err != nil || !ok {
+		return nil, false, err
+	}
+	return append([]string{MatchChart, MatchVersions}, matched...), true, nil
+}
+
+// Matches reports whether a release with the chart metadata, name and namespace meets every criterion
+// that is set, and returns the names of the criteria that matched.
+func (m Match) Matches(metadata *chart.Metadata, releaseName, namespace string) ([]string, bool, error) {
+	var matched []string
+	check := func(name string, set, ok bool) bool {
+		if !set {
+			return true
+		}
+		if ok {
+			matched = append(matched, name)
+		}
+		return ok
+	}
+
+	if !check(MatchHome, len(m.Home) > 0, matchAny(m.Home, metadata.Home)) {
+		return nil, false, nil
+	}
+	if !check(MatchSources, len(m.Sources) > 0, matchAny(m.Sources, metadata.Sources...)) {
+		return nil, false, nil
+	}
+
+	var maintainers []string
+	for _, mt := range metadata.Maintainers {
+		maintainers = append(maintainers, mt.Name, mt.Email, mt.URL)
+	}
+	if !check(MatchMaintainers, len(m.Maintainers) > 0, matchAny(m.Maintainers, maintainers...)) {
+		return nil, false, nil
+	}
+
+	annotationsOK := true
+	for k, pattern := range m.Annotations {
+		v, ok := metadata.Annotations[k]
+		if !ok || !globMatch(pattern, v) {
+			annotationsOK = false
+			break
+		}
+	}
+	if !check(MatchAnnotations, len(m.Annotations) > 0, annotationsOK) {
+		return nil, false, nil
+	}
+
+	if m.AppVersion != "" {
+		c, err := semver.NewConstraint(m.AppVersion)
+		if err != nil {
+			return nil, false, err
+		}
+		v, err := semver.NewVersion(metadata.AppVersion)
+		if err != nil || !check(MatchAppVersion, true, c.Check(v)) {
+			return nil, false, nil
+		}
+	}
+
+	if !check(MatchReleaseNames, len(m.ReleaseNames) > 0, matchAny(m.ReleaseNames, releaseName)) {
+		return nil, false, nil
+	}
+	if !check(MatchNamespaces, len(m.Namespaces) > 0, matchAny(m.Namespaces, namespace)) {
+		return nil, false, nil
+	}
+
+	sort.Strings(matched)
+	return matched, true, nil
+}
+
+// matchAny reports whether any of the values matches any of the patterns
+func matchAny(patterns []string, values ...string) bool {
+	for _, p := range patterns {
+		for _, v := range values {
+			if v != "" && globMatch(p, v) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// globMatch matches a value against a pattern where * matches any characters, including /, and ? any single character
+func globMatch(pattern, value string) bool {
+	expr := regexp.QuoteMeta(pattern)
+	expr = strings.ReplaceAll(expr, `\*`, ".*")
+	expr = strings.ReplaceAll(expr, `\?`, ".")
+	return regexp.MustCompile("^" + expr + "$").MatchString(value)
+}
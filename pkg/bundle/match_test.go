@@ -0,0 +1,141 @@
+/*
+Copyright © 2021 FairwindsOps Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bundle
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"helm.sh/helm/v3/pkg/chart"
+)
+
+func TestMatchRelease(t *testing.T) {
+	upstream := &chart.Metadata{
+		Name:        "metrics-server",
+		Version:     "3.8.2",
+		AppVersion:  "0.6.1",
+		Home:        "https://github.com/kubernetes-sigs/metrics-server",
+		Sources:     []string{"https://github.com/kubernetes-sigs/metrics-server"},
+		Maintainers: []*chart.Maintainer{{Name: "stevehipwell", URL: "https://github.com/stevehipwell"}},
+		Annotations: map[string]string{"artifacthub.io/license": "Apache-2.0"},
+	}
+	bitnami := &chart.Metadata{
+		Name:        "metrics-server",
+		Version:     "3.8.2",
+		AppVersion:  "0.6.1",
+		Home:        "https://bitnami.com",
+		Sources:     []string{"https://github.com/bitnami/charts/tree/main/bitnami/metrics-server"},
+		Maintainers: []*chart.Maintainer{{Name: "VMware, Inc.", URL: "https://github.com/bitnami/charts"}},
+	}
+	versions := Versions{Start: "3.5.0", End: "3.9.1"}
+
+	tests := []struct {
+		name      string
+		bundle    Bundle
+		metadata  *chart.Metadata
+		release   string
+		namespace string
+		want      []string
+		wantOK    bool
+	}{
+		{
+			name:     "chart name and version only",
+			bundle:   Bundle{Source: Source{Chart: "metrics-server"}, Versions: versions},
+			metadata: bitnami,
+			want:     []string{MatchChart, MatchVersions},
+			wantOK:   true,
+		},
+		{
+			name:     "different chart name",
+			bundle:   Bundle{Source: Source{Chart: "cert-manager"}, Versions: versions},
+			metadata: upstream,
+			wantOK:   false,
+		},
+		{
+			name:     "version out of range",
+			bundle:   Bundle{Source: Source{Chart: "metrics-server"}, Versions: Versions{Start: "3.9.1", End: "3.10.0"}},
+			metadata: upstream,
+			wantOK:   false,
+		},
+		{
+			name: "sources match upstream",
+			bundle: Bundle{Source: Source{Chart: "metrics-server"}, Versions: versions, Match: Match{
+				Sources: []string{"https://github.com/kubernetes-sigs/metrics-server*"},
+			}},
+			metadata: upstream,
+			want:     []string{MatchChart, MatchVersions, MatchSources},
+			wantOK:   true,
+		},
+		{
+			name: "sources do not match bitnami",
+			bundle: Bundle{Source: Source{Chart: "metrics-server"}, Versions: versions, Match: Match{
+				Sources: []string{"https://github.com/kubernetes-sigs/metrics-server*"},
+			}},
+			metadata: bitnami,
+			wantOK:   false,
+		},
+		{
+			name: "every criterion",
+			bundle: Bundle{Source: Source{Chart: "metrics-server"}, Versions: versions, Match: Match{
+				Home:         []string{"https://github.com/kubernetes-sigs/*"},
+				Maintainers:  []string{"stevehipwell"},
+				Annotations:  map[string]string{"artifacthub.io/license": "Apache-*"},
+				AppVersion:   "~0.6",
+				ReleaseNames: []string{"metrics-server", "ms-?"},
+				Namespaces:   []string{"kube-system"},
+			}},
+			metadata:  upstream,
+			release:   "ms-1",
+			namespace: "kube-system",
+			want:      []string{MatchChart, MatchVersions, MatchAnnotations, MatchAppVersion, MatchHome, MatchMaintainers, MatchNamespaces, MatchReleaseNames},
+			wantOK:    true,
+		},
+		{
+			name: "app version out of range",
+			bundle: Bundle{Source: Source{Chart: "metrics-server"}, Versions: versions, Match: Match{
+				AppVersion: ">=0.7.0",
+			}},
+			metadata: upstream,
+			wantOK:   false,
+		},
+		{
+			name: "missing annotation",
+			bundle: Bundle{Source: Source{Chart: "metrics-server"}, Versions: versions, Match: Match{
+				Annotations: map[string]string{"artifacthub.io/license": "*"},
+			}},
+			metadata: bitnami,
+			wantOK:   false,
+		},
+		{
+			name: "namespace does not match",
+			bundle: Bundle{Source: Source{Chart: "metrics-server"}, Versions: versions, Match: Match{
+				Namespaces: []string{"monitoring"},
+			}},
+			metadata:  upstream,
+			namespace: "kube-system",
+			wantOK:    false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok, err := tt.bundle.MatchRelease(tt.metadata, tt.release, tt.namespace)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantOK, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
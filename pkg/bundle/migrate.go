@@ -0,0 +1,219 @@
+/*
+Copyright © 2021 FairwindsOps Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bundle
+
+import (
+	"bytes"
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// APIVersionLegacy is the implicit version of bundle spec files that have no apiVersion
+	APIVersionLegacy = ""
+	// APIVersionV1Alpha1 is the first versioned bundle spec format
+	APIVersionV1Alpha1 = "gonogo.fairwinds.com/v1alpha1"
+	// LatestAPIVersion is the version bundles are converted to when they are read or migrated
+	LatestAPIVersion = APIVersionV1Alpha1
+	// Kind is the kind of bundle spec documents
+	Kind = "Bundle"
+	// KindOverlay is the kind of documents that change bundles from other files
+	KindOverlay = "BundleOverlay"
+)
+
+// migration converts a bundle document from one apiVersion to the next
+type migration struct {
+	from    string
+	to      string
+	migrate func(doc *yaml.Node) error
+}
+
+// migrations is the ordered chain of conversions between bundle spec versions.
+// A new bundle version only needs a migration from the version before it.
+var migrations = []migration{
+	{from: APIVersionLegacy, to: APIVersionV1Alpha1, migrate: migrateLegacyToV1Alpha1},
+}
+
+// migrateLegacyToV1Alpha1 adds the apiVersion and kind header, the addons list is unchanged
+func migrateLegacyToV1Alpha1(doc *yaml.Node) error {
+	setMappingValue(doc, "kind", Kind)
+	setMappingValue(doc, "apiVersion", APIVersionV1Alpha1)
+	return nil
+}
+
+// Migrate converts a bundle spec document to the latest apiVersion. Comments and the order of keys are kept.
+// The returned bool is false when the document is already at the latest version and was not changed.
+func Migrate(data []byte) ([]byte, bool, error) {
+	doc, err := parseDocument(data)
+	if err != nil {
+		return nil, false, err
+	}
+
+	changed, err := migrateDocument(doc)
+	if err != nil || !changed {
+		return data, false, err
+	}
+
+	literalFoldedScalars(doc.root)
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(doc.root); err != nil {
+		return nil, false, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, false, err
+	}
+	return buf.Bytes(), true, nil
+}
+
+// literalFoldedScalars switches folded scalars to the literal style. The yaml encoder does not always
+// fold a string back to the same value, which would change opa checks written in the folded style.
+func literalFoldedScalars(n *yaml.Node) {
+	if n.Kind == yaml.ScalarNode && n.Style&yaml.FoldedStyle != 0 {
+		n.Style = n.Style&^yaml.FoldedStyle | yaml.LiteralStyle
+	}
+	for _, c := range n.Content {
+		literalFoldedScalars(c)
+	}
+}
+
+// document is a parsed bundle spec file
+type document struct {
+	root    *yaml.Node
+	mapping *yaml.Node
+}
+
+// parseDocument parses a bundle spec file and makes sure that its top level is a mapping
+func parseDocument(data []byte) (*document, error) {
+	root := &yaml.Node{}
+	if err := yaml.Unmarshal(data, root); err != nil {
+		return nil, err
+	}
+	if root.Kind != yaml.DocumentNode || len(root.Content) == 0 || root.Content[0].Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("bundle must be a yaml mapping with an addons key")
+	}
+	return &document{root: root, mapping: root.Content[0]}, nil
+}
+
+// typeMeta returns the apiVersion and kind of the document. Documents without either are legacy bundles.
+func (d *document) typeMeta() (TypeMeta, error) {
+	tm := TypeMeta{
+		APIVersion: mappingValue(d.mapping, "apiVersion"),
+		Kind:       mappingValue(d.mapping, "kind"),
+	}
+	if tm.APIVersion == APIVersionLegacy && tm.Kind == "" {
+		return TypeMeta{APIVersion: APIVersionLegacy, Kind: Kind}, nil
+	}
+	if tm.Kind != Kind && tm.Kind != KindOverlay {
+		return TypeMeta{}, fmt.Errorf("unsupported kind %q, expected %s or %s", tm.Kind, Kind, KindOverlay)
+	}
+	return tm, nil
+}
+
+// migrateDocument runs every migration needed to bring the document to the latest version
+func migrateDocument(d *document) (bool, error) {
+	tm, err := d.typeMeta()
+	if err != nil {
+		return false, err
+	}
+	current := tm.APIVersion
+
+	// overlays were introduced with v1alpha1 and have no older versions to migrate from
+	if tm.Kind == KindOverlay {
+		if current != APIVersionV1Alpha1 {
+			return false, fmt.Errorf("unsupported apiVersion %q for %s", current, KindOverlay)
+		}
+		return false, nil
+	}
+
+	changed := false
+	for current != LatestAPIVersion {
+		found := false
+		for _, m := range migrations {
+			if m.from != current {
+				continue
+			}
+			if err := m.migrate(d.mapping); err != nil {
+				return false, fmt.Errorf("unable to migrate bundle from %q to %s: %v", current, m.to, err)
+			}
+			current, found, changed = m.to, true, true
+			break
+		}
+		if !found {
+			return false, fmt.Errorf("unsupported apiVersion %q", current)
+		}
+	}
+	return changed, nil
+}
+
+// decodeDocument reads a bundle spec file of any supported version into the latest BundleConfig,
+// or an overlay file into an Overlay. Only one of the two is returned.
+func decodeDocument(data []byte) (*BundleConfig, *Overlay, error) {
+	doc, err := parseDocument(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err := migrateDocument(doc); err != nil {
+		return nil, nil, err
+	}
+
+	if mappingValue(doc.mapping, "kind") == KindOverlay {
+		overlay := &Overlay{}
+		if err := doc.root.Decode(overlay); err != nil {
+			return nil, nil, err
+		}
+		return nil, overlay, nil
+	}
+
+	config := &BundleConfig{}
+	if err := doc.root.Decode(config); err != nil {
+		return nil, nil, err
+	}
+	return config, nil, nil
+}
+
+// mappingValue returns the scalar value for key in a yaml mapping or an empty string
+func mappingValue(mapping *yaml.Node, key string) string {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i+1].Value
+		}
+	}
+	return ""
+}
+
+// setMappingValue sets key to a scalar value, adding the key to the top of the mapping if it is missing
+func setMappingValue(mapping *yaml.Node, key, value string) {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			mapping.Content[i+1].SetString(value)
+			return
+		}
+	}
+	k := &yaml.Node{}
+	k.SetString(key)
+	v := &yaml.Node{}
+	v.SetString(value)
+	if len(mapping.Content) > 0 {
+		// keep comments at the top of the file above the new key
+		k.HeadComment, mapping.Content[0].HeadComment = mapping.Content[0].HeadComment, ""
+	}
+	mapping.Content = append([]*yaml.Node{k, v}, mapping.Content...)
+}
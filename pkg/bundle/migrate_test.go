@@ -0,0 +1,90 @@
+/*
+Copyright © 2021 FairwindsOps Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bundle
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMigrate(t *testing.T) {
+	tests := []struct {
+		name        string
+		file        string
+		wantChanged bool
+		wantErr     bool
+	}{
+		{
+			name:        "legacy bundle",
+			file:        "testdata/bundle_read_check.yaml",
+			wantChanged: true,
+		},
+		{
+			name:        "legacy bundle with folded opa checks",
+			file:        "testdata/lint_valid.yaml",
+			wantChanged: true,
+		},
+		{
+			name:        "latest bundle",
+			file:        "testdata/bundle_v1alpha1.yaml",
+			wantChanged: false,
+		},
+		{
+			name:    "unknown apiVersion",
+			file:    "testdata/bundle_unknown_version.yaml",
+			wantErr: true,
+		},
+		{
+			name:    "file is not valid syntax",
+			file:    "testdata/invalid_bundle.yaml",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := os.ReadFile(tt.file)
+			assert.NoError(t, err)
+
+			got, changed, err := Migrate(data)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantChanged, changed)
+
+			migrated, _, err := decodeDocument(got)
+			assert.NoError(t, err)
+			assert.Equal(t, LatestAPIVersion, migrated.APIVersion)
+			assert.Equal(t, Kind, migrated.Kind)
+
+			original, _, err := decodeDocument(data)
+			assert.NoError(t, err)
+			assert.Equal(t, original, migrated)
+		})
+	}
+}
+
+func TestMigrateKeepsComments(t *testing.T) {
+	data := []byte("# maintained by the platform team\naddons:\n# metrics\n- name: metrics-server\n")
+	got, changed, err := Migrate(data)
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, "# maintained by the platform team\napiVersion: gonogo.fairwinds.com/v1alpha1\nkind: Bundle\naddons:\n  # metrics\n  - name: metrics-server\n", string(got))
+}
@@ -0,0 +1,293 @@
+/*
+Copyright © 2021 FairwindsOps Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bundle
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// BundleMediaType is the media type of the layers that hold bundle spec files in oci artifacts
+const BundleMediaType = "application/vnd.fairwinds.gonogo.bundle.v1+yaml"
+
+// ociTitleAnnotation is the annotation oras and other clients use for the file name of a layer
+const ociTitleAnnotation = "org.opencontainers.image.title"
+
+// manifestMediaTypes are the manifest formats accepted from registries
+var manifestMediaTypes = []string{
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.oci.artifact.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+}
+
+// challengeParam matches the parameters of a WWW-Authenticate header
+var challengeParam = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+type ociDescriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+type ociManifest struct {
+	Layers []ociDescriptor `json:"layers"`
+	Blobs  []ociDescriptor `json:"blobs"` // artifact manifests list their files as blobs
+}
+
+// ociRepository reads manifests and blobs from a repository in an oci registry
+type ociRepository struct {
+	client *http.Client
+	scheme string
+	host   string
+	name   string
+	token  string
+}
+
+// readOCI reads the bundle spec files in an oci artifact, oci://registry/repository:tag. The layers with the
+// bundle media type or a yaml file name are read. When pin is set it is the digest of the manifest to read.
+func (l *Loader) readOCI(ref, pin string) ([]source, error) {
+	host, name, tag, err := parseOCIReference(ref)
+	if err != nil {
+		return nil, err
+	}
+	client := l.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	repo := &ociRepository{client: client, scheme: "https", host: host, name: name}
+	if isLocalHost(host) {
+		repo.scheme = "http"
+	}
+
+	reference := tag
+	if pin != "" {
+		reference = pin
+	}
+	data, err := repo.get("manifests/"+reference, manifestMediaTypes...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", ref, err)
+	}
+	if pin != "" && sha256Digest(data) != pin {
+		return nil, fmt.Errorf("%s: manifest digest %s does not match pinned digest %s", ref, sha256Digest(data), pin)
+	}
+	var manifest ociManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("%s: invalid manifest: %v", ref, err)
+	}
+
+	var sources []source
+	for _, layer := range append(manifest.Layers, manifest.Blobs...) {
+		title := layer.Annotations[ociTitleAnnotation]
+		if layer.MediaType != BundleMediaType && !isYAML(title) {
+			continue
+		}
+		blob, err := repo.get("blobs/" + layer.Digest)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", ref, err)
+		}
+		if sha256Digest(blob) != layer.Digest {
+			return nil, fmt.Errorf("%s: blob digest does not match %s", ref, layer.Digest)
+		}
+		name := ref
+		if title != "" {
+			name = ref + "/" + title
+		}
+		sources = append(sources, source{name: name, data: blob})
+	}
+	if len(sources) == 0 {
+		return nil, fmt.Errorf("%s: no layers with media type %s or a yaml file name", ref, BundleMediaType)
+	}
+	return sources, nil
+}
+
+// parseOCIReference splits oci://registry/repository:tag into its parts, the tag defaults to latest
+func parseOCIReference(ref string) (host, name, tag string, err error) {
+	rest := strings.TrimPrefix(ref, "oci://")
+	i := strings.Index(rest, "/")
+	if i <= 0 || i == len(rest)-1 {
+		return "", "", "", fmt.Errorf("invalid oci reference %s, expected oci://registry/repository:tag", ref)
+	}
+	host, name, tag = rest[:i], rest[i+1:], "latest"
+	if j := strings.LastIndex(name, ":"); j > strings.LastIndex(name, "/") {
+		name, tag = name[:j], name[j+1:]
+	}
+	return host, name, tag, nil
+}
+
+// isLocalHost reports whether a registry runs on the local machine, those are reached over plain http
+func isLocalHost(host string) bool {
+	h := host
+	if i := strings.LastIndex(host, ":"); i > 0 && !strings.HasSuffix(host, "]") {
+		h = host[:i]
+	}
+	return h == "localhost" || h == "127.0.0.1" || h == "[::1]"
+}
+
+// get reads a manifest or blob, authenticating when the registry asks for it
+func (r *ociRepository) get(path string, accept ...string) ([]byte, error) {
+	u := fmt.Sprintf("%s://%s/v2/%s/%s", r.scheme, r.host, r.name, path)
+	resp, err := r.do(u, accept)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusUnauthorized && r.token == "" {
+		resp.Body.Close()
+		if err := r.authenticate(resp.Header.Get("WWW-Authenticate")); err != nil {
+			return nil, err
+		}
+		resp, err = r.do(u, accept)
+		if err != nil {
+			return nil, err
+		}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unable to get %s: unexpected status %s", u, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+func (r *ociRepository) do(u string, accept []string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(accept) > 0 {
+		req.Header.Set("Accept", strings.Join(accept, ", "))
+	}
+	switch {
+	case strings.HasPrefix(r.token, "Basic "):
+		req.Header.Set("Authorization", r.token)
+	case r.token != "":
+		req.Header.Set("Authorization", "Bearer "+r.token)
+	}
+	return r.client.Do(req)
+}
+
+// authenticate answers a WWW-Authenticate challenge with the credentials from the docker config, if there
+// are any, or anonymously
+func (r *ociRepository) authenticate(challenge string) error {
+	user, password := registryCredentials(r.host)
+	basic := ""
+	if user != "" || password != "" {
+		basic = "Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+password))
+	}
+
+	if strings.HasPrefix(challenge, "Basic") {
+		if basic == "" {
+			return fmt.Errorf("registry %s requires credentials", r.host)
+		}
+		r.token = basic
+		return nil
+	}
+	if !strings.HasPrefix(challenge, "Bearer") {
+		return fmt.Errorf("registry %s asked for unsupported authentication %q", r.host, challenge)
+	}
+
+	params := map[string]string{}
+	for _, m := range challengeParam.FindAllStringSubmatch(challenge, -1) {
+		params[m[1]] = m[2]
+	}
+	if params["realm"] == "" {
+		return fmt.Errorf("registry %s did not send a token realm", r.host)
+	}
+	q := url.Values{}
+	if params["service"] != "" {
+		q.Set("service", params["service"])
+	}
+	scope := params["scope"]
+	if scope == "" {
+		scope = fmt.Sprintf("repository:%s:pull", r.name)
+	}
+	q.Set("scope", scope)
+
+	req, err := http.NewRequest(http.MethodGet, params["realm"]+"?"+q.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	if basic != "" {
+		req.Header.Set("Authorization", basic)
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unable to get a token for %s: unexpected status %s", r.host, resp.Status)
+	}
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return err
+	}
+	r.token = token.Token
+	if r.token == "" {
+		r.token = token.AccessToken
+	}
+	if r.token == "" {
+		return fmt.Errorf("registry %s did not return a token", r.host)
+	}
+	return nil
+}
+
+// registryCredentials returns the user name and password for a registry from the docker config file
+func registryCredentials(host string) (string, string) {
+	dir := os.Getenv("DOCKER_CONFIG")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", ""
+		}
+		dir = filepath.Join(home, ".docker")
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "config.json"))
+	if err != nil {
+		return "", ""
+	}
+	var config struct {
+		Auths map[string]struct {
+			Auth string `json:"auth"`
+		} `json:"auths"`
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return "", ""
+	}
+	for _, key := range []string{host, "https://" + host, "http://" + host} {
+		entry, ok := config.Auths[key]
+		if !ok {
+			continue
+		}
+		decoded, err := base64.StdEncoding.DecodeString(entry.Auth)
+		if err != nil {
+			return "", ""
+		}
+		user, password, _ := strings.Cut(string(decoded), ":")
+		return user, password
+	}
+	return "", ""
+}
@@ -0,0 +1,161 @@
+/*
+Copyright © 2021 FairwindsOps Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bundle
+
+import (
+	"fmt"
+	"sort"
+
+	"helm.sh/helm/v3/pkg/chart"
+)
+
+// Origins of bundles, a bundle from an origin later in the list takes precedence over earlier ones
+const (
+	OriginEmbedded = "embedded" // bundles embedded in gonogo
+	OriginChart    = "chart"    // bundles shipped in the chart that is upgraded to
+	OriginUser     = "user"     // bundle files given by the user
+)
+
+// ChartBundleFile is the file in a chart that ships bundles for upgrading to that chart version
+const ChartBundleFile = "gonogo.yaml"
+
+// ChartBundleAnnotation is the Chart.yaml annotation that ships bundles for upgrading to that chart version
+const ChartBundleAnnotation = "gonogo.fairwinds.com/bundle"
+
+// Bundle fields whose origin is recorded when bundles are merged
+const (
+	FieldValuesSchema          = "values_schema"
+	FieldCompatibleK8sVersions = "compatible_k8s_versions"
+	FieldNecessaryAPIVersions  = "necessary_api_versions"
+	FieldOpaChecks             = "opa_checks"
+	FieldWarnings              = "warnings"
+)
+
+// precedence orders the origins, bundles without an origin have the lowest precedence
+func precedence(origin string) int {
+	switch origin {
+	case OriginEmbedded:
+		return 1
+	case OriginChart:
+		return 2
+	case OriginUser:
+		return 3
+	}
+	return 0
+}
+
+// ChartBundles reads the bundles a chart ships for upgrading to it, from the gonogo.yaml file in the chart and
+// the gonogo.fairwinds.com/bundle annotation in Chart.yaml. Both hold a bundle file. The name and source chart
+// of the bundles default to the name of the chart, and the versions default to upgrading from any lower version
+// to the version of the chart.
+func ChartBundles(c *chart.Chart) ([]*Bundle, error) {
+	if c == nil || c.Metadata == nil {
+		return nil, nil
+	}
+
+	var docs []source
+	for _, f := range c.Files {
+		if f.Name == ChartBundleFile {
+			docs = append(docs, source{name: fmt.Sprintf("%s/%s", c.Metadata.Name, ChartBundleFile), data: f.Data})
+		}
+	}
+	if a, ok := c.Metadata.Annotations[ChartBundleAnnotation]; ok {
+		docs = append(docs, source{name: fmt.Sprintf("%s annotation %s", c.Metadata.Name, ChartBundleAnnotation), data: []byte(a)})
+	}
+
+	var bundles []*Bundle
+	for _, doc := range docs {
+		config, overlay, err := decodeDocument(doc.data)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read %s: %v", doc.name, err)
+		}
+		if overlay != nil {
+			return nil, fmt.Errorf("unable to read %s: charts can not ship overlays", doc.name)
+		}
+		for _, b := range config.Addons {
+			if b.Name == "" {
+				b.Name = c.Metadata.Name
+			}
+			if b.Source.Chart == "" {
+				b.Source.Chart = c.Metadata.Name
+			}
+			if b.Versions == (Versions{}) {
+				b.Versions = Versions{From: "< " + c.Metadata.Version, To: c.Metadata.Version}
+			}
+			b.Origin = OriginChart
+			bundles = append(bundles, b)
+		}
+	}
+	return bundles, nil
+}
+
+// Merge combines bundles for the same upgrade into one in order of the precedence of their origins.
+// Fields set in bundles with a higher precedence replace those with a lower one, except for lists which
+// are combined. The origin of each check is recorded and can be looked up with OriginOf.
+func Merge(bundles ...*Bundle) *Bundle {
+	if len(bundles) == 0 {
+		return nil
+	}
+	sorted := append([]*Bundle{}, bundles...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return precedence(sorted[i].Origin) < precedence(sorted[j].Origin)
+	})
+
+	merged := *sorted[0]
+	merged.origins = map[string]string{}
+	merged.recordOrigins(sorted[0])
+	for _, b := range sorted[1:] {
+		merged = mergeBundle(merged, *b)
+		merged.recordOrigins(b)
+		merged.Origin = b.Origin
+	}
+	return &merged
+}
+
+// recordOrigins records b as the origin of the checks it sets
+func (b *Bundle) recordOrigins(from *Bundle) {
+	if from.ValuesSchema != "" {
+		b.origins[FieldValuesSchema] = from.Origin
+	}
+	if from.CompatibleK8sVersions != (K8sVersions{}) {
+		b.origins[FieldCompatibleK8sVersions] = from.Origin
+	}
+	record := func(field string, values []string) {
+		for _, v := range values {
+			b.origins[field+":"+v] = from.Origin
+		}
+	}
+	record(FieldNecessaryAPIVersions, from.NecessaryAPIVersions)
+	record(FieldOpaChecks, from.OpaChecks)
+	record(FieldWarnings, from.Warnings)
+	for _, sc := range from.StatusChecks {
+		record(FieldOpaChecks, sc.OpaChecks)
+		record(FieldWarnings, sc.Warnings)
+	}
+}
+
+// OriginOf returns the origin of a check in the bundle. value is the entry for fields that hold lists
+// and is ignored for other fields.
+func (b *Bundle) OriginOf(field, value string) string {
+	if o, ok := b.origins[field+":"+value]; ok {
+		return o
+	}
+	if o, ok := b.origins[field]; ok {
+		return o
+	}
+	return b.Origin
+}
@@ -0,0 +1,127 @@
+/*
+Copyright © 2021 FairwindsOps Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bundle
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"helm.sh/helm/v3/pkg/chart"
+)
+
+func TestChartBundles(t *testing.T) {
+	c := &chart.Chart{
+		Metadata: &chart.Metadata{
+			Name:    "widget",
+			Version: "2.0.0",
+			Annotations: map[string]string{
+				ChartBundleAnnotation: `addons:
+- warnings:
+  - widgets are now called gadgets
+`,
+			},
+		},
+		Files: []*chart.File{
+			{Name: "README.md", Data: []byte("# widget")},
+			{Name: ChartBundleFile, Data: []byte(`apiVersion: gonogo.fairwinds.com/v1alpha1
+kind: Bundle
+addons:
+  - name: widget-from-1
+    versions:
+      from: ~1
+      to: 2.0.0
+    source:
+      chart: widget
+    compatible_k8s_versions:
+      min: "1.25"
+`)},
+		},
+	}
+
+	got, err := ChartBundles(c)
+	assert.NoError(t, err)
+	assert.Equal(t, []*Bundle{
+		{
+			Name:                  "widget-from-1",
+			Versions:              Versions{From: "~1", To: "2.0.0"},
+			Source:                Source{Chart: "widget"},
+			CompatibleK8sVersions: K8sVersions{Min: "1.25"},
+			Origin:                OriginChart,
+		},
+		{
+			Name:     "widget",
+			Versions: Versions{From: "< 2.0.0", To: "2.0.0"},
+			Source:   Source{Chart: "widget"},
+			Warnings: []string{"widgets are now called gadgets"},
+			Origin:   OriginChart,
+		},
+	}, got)
+
+	c.Files = []*chart.File{{Name: ChartBundleFile, Data: []byte("apiVersion: gonogo.fairwinds.com/v1alpha1\nkind: BundleOverlay\n")}}
+	_, err = ChartBundles(c)
+	assert.Error(t, err, "charts can not ship overlays")
+}
+
+func TestMerge(t *testing.T) {
+	embedded := &Bundle{
+		Name:                  "widget",
+		Versions:              Versions{Start: "1.0.0", End: "2.0.0"},
+		Notes:                 "embedded notes",
+		CompatibleK8sVersions: K8sVersions{Min: "1.20"},
+		OpaChecks:             []string{"embedded check", "shared check"},
+		Warnings:              []string{"embedded warning"},
+		Origin:                OriginEmbedded,
+	}
+	user := &Bundle{
+		Name:         "widget",
+		Versions:     Versions{Start: "1.0.0", End: "2.0.0"},
+		ValuesSchema: "{}",
+		OpaChecks:    []string{"user check"},
+		Origin:       OriginUser,
+	}
+	fromChart := &Bundle{
+		Name:                  "widget",
+		Versions:              Versions{From: "< 2.0.0", To: "2.0.0"},
+		Notes:                 "chart notes",
+		CompatibleK8sVersions: K8sVersions{Min: "1.25"},
+		OpaChecks:             []string{"shared check", "chart check"},
+		Origin:                OriginChart,
+	}
+
+	got := Merge(user, embedded, fromChart)
+	assert.Equal(t, OriginUser, got.Origin)
+	assert.Equal(t, "chart notes", got.Notes)
+	assert.Equal(t, Versions{Start: "1.0.0", End: "2.0.0"}, got.Versions, "user versions take precedence")
+	assert.Equal(t, K8sVersions{Min: "1.25"}, got.CompatibleK8sVersions)
+	assert.Equal(t, []string{"embedded check", "shared check", "chart check", "user check"}, got.OpaChecks)
+
+	for _, tc := range []struct {
+		field, value, want string
+	}{
+		{FieldOpaChecks, "embedded check", OriginEmbedded},
+		{FieldOpaChecks, "shared check", OriginChart},
+		{FieldOpaChecks, "user check", OriginUser},
+		{FieldWarnings, "embedded warning", OriginEmbedded},
+		{FieldCompatibleK8sVersions, "", OriginChart},
+		{FieldValuesSchema, "", OriginUser},
+	} {
+		assert.Equal(t, tc.want, got.OriginOf(tc.field, tc.value), "%s %s", tc.field, tc.value)
+	}
+
+	assert.Equal(t, OriginEmbedded, embedded.OriginOf(FieldOpaChecks, "embedded check"), "unmerged bundles report their own origin")
+	assert.Nil(t, Merge())
+}
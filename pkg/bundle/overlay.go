@@ -0,0 +1,284 @@
+/*
+Copyright © 2021 FairwindsOps Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bundle
+
+import (
+	"reflect"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/open-policy-agent/opa/ast"
+	"k8s.io/klog"
+)
+
+// Overlay adds to and changes the bundles read from other files, usually the embedded bundles,
+// so that they do not need to be copied to be customized
+type Overlay struct {
+	TypeMeta `yaml:",inline"`
+	Patches  []*Patch  `yaml:"patches,omitempty"` // changes to existing bundles
+	Addons   []*Bundle `yaml:"addons,omitempty"`  // bundles added to the catalog
+}
+
+// Patch changes every bundle with the same name whose target version satisfies Versions
+type Patch struct {
+	Name     string  `yaml:"name"`               // name of the bundles to patch
+	Versions string  `yaml:"versions,omitempty"` // semver constraint for the target version of the bundles to patch
+	Merge    Bundle  `yaml:"merge,omitempty"`    // fields merged into the bundles
+	Disable  Disable `yaml:"disable,omitempty"`  // parts of the bundles to remove
+}
+
+// Disable lists the parts of a bundle that a patch removes
+type Disable struct {
+	Addon     bool     `yaml:"addon,omitempty"`      // remove the whole bundle
+	OpaChecks []string `yaml:"opa_checks,omitempty"` // names of rules, opa checks that define them are removed
+	Warnings  []string `yaml:"warnings,omitempty"`   // patterns for warnings to remove
+}
+
+// applyOverlays adds the bundles of every overlay to the addons and then applies their patches in order
+func applyOverlays(addons []*Bundle, overlays []*Overlay) ([]*Bundle, error) {
+	for _, o := range overlays {
+		addons = append(addons, o.Addons...)
+	}
+
+	for _, o := range overlays {
+		for _, p := range o.Patches {
+			var err error
+			addons, err = p.apply(addons)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return addons, nil
+}
+
+// ApplyPatches applies the patches of the overlays the config was read with to b again. It is used for bundles of
+// the config that are merged with others after it was read, such as those shipped in charts, so that the changes
+// of the user still take precedence. Nil is returned when the patches disable b.
+func (c *BundleConfig) ApplyPatches(b *Bundle) (*Bundle, error) {
+	addons := []*Bundle{b}
+	for _, o := range c.overlays {
+		for _, p := range o.Patches {
+			var err error
+			addons, err = p.apply(addons)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	if len(addons) == 0 {
+		return nil, nil
+	}
+	return addons[0], nil
+}
+
+// apply patches every matching bundle and returns the bundles that were not disabled
+func (p *Patch) apply(addons []*Bundle) ([]*Bundle, error) {
+	var constraint *semver.Constraints
+	if p.Versions != "" {
+		var err error
+		constraint, err = semver.NewConstraint(p.Versions)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var result []*Bundle
+	for _, addon := range addons {
+		if !p.matches(addon, constraint) {
+			result = append(result, addon)
+			continue
+		}
+		if p.Disable.Addon {
+			klog.V(3).Infof("overlay disabled bundle %s for %s", addon.Name, addon.Versions.Target())
+			continue
+		}
+		klog.V(3).Infof("overlay patched bundle %s for %s", addon.Name, addon.Versions.Target())
+		merged := mergeBundle(*addon, p.Merge)
+		merged.OpaChecks = removeOpaChecks(merged.OpaChecks, p.Disable.OpaChecks)
+		merged.Warnings = removeMatching(merged.Warnings, p.Disable.Warnings)
+		merged.StatusChecks = removeStatusChecks(merged.StatusChecks, p.Disable)
+		result = append(result, &merged)
+	}
+	return result, nil
+}
+
+// matches reports whether the patch applies to a bundle
+func (p *Patch) matches(addon *Bundle, constraint *semver.Constraints) bool {
+	if addon.Name != p.Name {
+		return false
+	}
+	if constraint == nil {
+		return true
+	}
+	v, err := semver.NewVersion(addon.Versions.Target())
+	return err == nil && constraint.Check(v)
+}
+
+// mergeBundle merges patch into base. Fields set in the patch replace those in base,
+// except for lists which are appended to, and the name which can not be changed.
+func mergeBundle(base, patch Bundle) Bundle {
+	if patch.Versions != (Versions{}) {
+		base.Versions = patch.Versions
+	}
+	if patch.Notes != "" {
+		base.Notes = patch.Notes
+	}
+	if patch.Source.Chart != "" {
+		base.Source.Chart = patch.Source.Chart
+	}
+	if patch.Source.Repository != "" {
+		base.Source.Repository = patch.Source.Repository
+	}
+	if !patch.Match.isZero() {
+		base.Match = patch.Match
+	}
+	if patch.CompatibleK8sVersions.Min != "" {
+		base.CompatibleK8sVersions.Min = patch.CompatibleK8sVersions.Min
+	}
+	if patch.CompatibleK8sVersions.Max != "" {
+		base.CompatibleK8sVersions.Max = patch.CompatibleK8sVersions.Max
+	}
+	if patch.CompatibleK8sVersions.Constraint != "" {
+		base.CompatibleK8sVersions.Constraint = patch.CompatibleK8sVersions.Constraint
+	}
+	if patch.ValuesSchema != "" {
+		base.ValuesSchema = patch.ValuesSchema
+	}
+	base.Warnings = appendMissing(base.Warnings, patch.Warnings)
+	base.NecessaryAPIVersions = appendMissing(base.NecessaryAPIVersions, patch.NecessaryAPIVersions)
+	base.OpaChecks = appendMissing(base.OpaChecks, patch.OpaChecks)
+	base.Resources = appendMissing(base.Resources, patch.Resources)
+	statusChecks := append([]StatusCheck{}, base.StatusChecks...)
+	for _, sc := range patch.StatusChecks {
+		if !containsStatusCheck(statusChecks, sc) {
+			statusChecks = append(statusChecks, sc)
+		}
+	}
+	base.StatusChecks = nil
+	if len(statusChecks) > 0 {
+		base.StatusChecks = statusChecks
+	}
+	return base
+}
+
+// containsStatusCheck reports whether checks has a status check equal to sc, so that patches applied again do not
+// add it twice
+func containsStatusCheck(checks []StatusCheck, sc StatusCheck) bool {
+	for _, c := range checks {
+		if reflect.DeepEqual(c, sc) {
+			return true
+		}
+	}
+	return false
+}
+
+// isZero reports whether no match criteria are set
+func (m Match) isZero() bool {
+	return len(m.Home) == 0 && len(m.Sources) == 0 && len(m.Maintainers) == 0 && len(m.Annotations) == 0 &&
+		m.AppVersion == "" && len(m.ReleaseNames) == 0 && len(m.Namespaces) == 0
+}
+
+// appendMissing returns a new list with the values of add that are not in base appended to it
+func appendMissing(base, add []string) []string {
+	result := append([]string{}, base...)
+	for _, a := range add {
+		found := false
+		for _, b := range result {
+			if a == b {
+				found = true
+				break
+			}
+		}
+		if !found {
+			result = append(result, a)
+		}
+	}
+	if len(result) == 0 {
+		return base
+	}
+	return result
+}
+
+// removeMatching returns the values that do not match any of the patterns
+func removeMatching(values, patterns []string) []string {
+	if len(patterns) == 0 {
+		return values
+	}
+	var result []string
+	for _, v := range values {
+		if !matchAny(patterns, v) {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+// removeStatusChecks removes the disabled warnings and opa checks from the status checks
+func removeStatusChecks(checks []StatusCheck, disable Disable) []StatusCheck {
+	if len(checks) == 0 {
+		return checks
+	}
+	result := make([]StatusCheck, 0, len(checks))
+	for _, sc := range checks {
+		sc.Warnings = removeMatching(sc.Warnings, disable.Warnings)
+		sc.OpaChecks = removeOpaChecks(sc.OpaChecks, disable.OpaChecks)
+		result = append(result, sc)
+	}
+	return result
+}
+
+// removeOpaChecks returns the opa checks that do not define any of the rules
+func removeOpaChecks(checks, rules []string) []string {
+	if len(rules) == 0 {
+		return checks
+	}
+	var result []string
+	for _, check := range checks {
+		if !definesRule(check, rules) {
+			result = append(result, check)
+		}
+	}
+	return result
+}
+
+// definesRule reports whether a rego module defines a rule with any of the names
+func definesRule(check string, rules []string) bool {
+	for _, name := range OpaCheckRules(check) {
+		for _, r := range rules {
+			if name == r {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// OpaCheckRules returns the names of the rules defined in a rego module, they identify opa checks in overlays
+func OpaCheckRules(check string) []string {
+	module, err := ast.ParseModule("fairwinds", check)
+	if err != nil || module == nil {
+		return nil
+	}
+	var names []string
+	for _, rule := range module.Rules {
+		name := rule.Head.Name.String()
+		if len(names) == 0 || names[len(names)-1] != name {
+			names = append(names, name)
+		}
+	}
+	return names
+}
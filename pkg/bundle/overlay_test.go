@@ -0,0 +1,185 @@
+/*
+Copyright © 2021 FairwindsOps Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bundle
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadConfigOverlay(t *testing.T) {
+	base, err := ReadBaseConfig([]string{"testdata/overlay.yaml"})
+	assert.NoError(t, err)
+	embedded, err := ReadConfig(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, embedded.Addons, base.Addons, "only overlays were given so the embedded bundles are the base")
+
+	got, err := ReadConfig([]string{"testdata/overlay.yaml"})
+	assert.NoError(t, err)
+	assert.Len(t, got.Addons, len(embedded.Addons)+1)
+
+	var lbc, certManager *Bundle
+	for _, a := range got.Addons {
+		switch a.Name {
+		case "aws-load-balancer-controller":
+			lbc = a
+		case "cert-manager":
+			certManager = a
+		}
+	}
+	assert.NotNil(t, certManager)
+	assert.NotNil(t, lbc)
+	assert.Empty(t, lbc.OpaChecks)
+	assert.Equal(t, []string{
+		"The new controller image is not compatible with manifests from earlier releases. Editing the deployment image tag will not work. You must helm upgrade or deploy new manifests.",
+		"Acme: ask #platform before upgrading",
+	}, lbc.Warnings)
+}
+
+func TestReadConfigOverlayWithBundles(t *testing.T) {
+	got, err := ReadConfig([]string{"testdata/bundle_v1alpha1.yaml", "testdata/overlay.yaml"})
+	assert.NoError(t, err)
+
+	var names []string
+	for _, a := range got.Addons {
+		names = append(names, a.Name)
+	}
+	assert.Equal(t, []string{"metrics-server", "cert-manager"}, names, "bundle files replace the embedded bundles")
+}
+
+func TestPatchApply(t *testing.T) {
+	check := "package Fairwinds\nfirst[actionItem] {\n  input.kind == \"Pod\"\n  actionItem := {}\n}\n"
+	addons := func() []*Bundle {
+		return []*Bundle{
+			{Name: "cert-manager", Versions: Versions{Start: "1.5.0", End: "1.6.0"}, Warnings: []string{"old"}, OpaChecks: []string{check}},
+			{Name: "cert-manager", Versions: Versions{Start: "1.6.0", End: "1.7.0"}, Warnings: []string{"old"}},
+			{Name: "ingress-nginx", Versions: Versions{Start: "4.0.0", End: "4.1.0"}},
+		}
+	}
+
+	tests := []struct {
+		name  string
+		patch Patch
+		check func(t *testing.T, got []*Bundle)
+	}{
+		{
+			name:  "merge into every version",
+			patch: Patch{Name: "cert-manager", Merge: Bundle{Name: "ignored", Notes: "new notes", Warnings: []string{"old", "new"}}},
+			check: func(t *testing.T, got []*Bundle) {
+				assert.Len(t, got, 3)
+				for _, a := range got[:2] {
+					assert.Equal(t, "cert-manager", a.Name)
+					assert.Equal(t, "new notes", a.Notes)
+					assert.Equal(t, []string{"old", "new"}, a.Warnings)
+				}
+				assert.Empty(t, got[2].Notes)
+			},
+		},
+		{
+			name:  "version range",
+			patch: Patch{Name: "cert-manager", Versions: ">=1.7.0", Merge: Bundle{Notes: "new notes"}},
+			check: func(t *testing.T, got []*Bundle) {
+				assert.Empty(t, got[0].Notes)
+				assert.Equal(t, "new notes", got[1].Notes)
+			},
+		},
+		{
+			name:  "disable opa check by rule name",
+			patch: Patch{Name: "cert-manager", Disable: Disable{OpaChecks: []string{"first"}}},
+			check: func(t *testing.T, got []*Bundle) {
+				assert.Empty(t, got[0].OpaChecks)
+			},
+		},
+		{
+			name:  "disable warnings by pattern",
+			patch: Patch{Name: "cert-manager", Disable: Disable{Warnings: []string{"o*"}}},
+			check: func(t *testing.T, got []*Bundle) {
+				assert.Empty(t, got[0].Warnings)
+			},
+		},
+		{
+			name:  "disable addon",
+			patch: Patch{Name: "cert-manager", Versions: "1.6.0", Disable: Disable{Addon: true}},
+			check: func(t *testing.T, got []*Bundle) {
+				assert.Len(t, got, 2)
+				assert.Equal(t, "1.7.0", got[0].Versions.End)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.patch.apply(addons())
+			assert.NoError(t, err)
+			tt.check(t, got)
+		})
+	}
+}
+
+func TestApplyPatchesToChartBundles(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "bundle.yaml"), []byte(`apiVersion: gonogo.fairwinds.com/v1alpha1
+kind: Bundle
+addons:
+- name: widget
+  versions:
+    start: 1.0.0
+    end: 2.0.0
+  source:
+    chart: widget
+`), 0o644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "overlay.yaml"), []byte(`apiVersion: gonogo.fairwinds.com/v1alpha1
+kind: BundleOverlay
+patches:
+- name: widget
+  merge:
+    values_schema: '{"type":"object"}'
+  disable:
+    opa_checks:
+    - noisy
+    warnings:
+    - "chart*"
+`), 0o644))
+	config, err := ReadConfig([]string{filepath.Join(dir, "bundle.yaml"), filepath.Join(dir, "overlay.yaml")})
+	assert.NoError(t, err)
+	assert.Len(t, config.Addons, 1)
+
+	noisy := "package fairwinds\nnoisy[actionItem] {\n  input.kind == \"Pod\"\n  actionItem := {}\n}\n"
+	kept := "package fairwinds\nkept[actionItem] {\n  input.kind == \"Pod\"\n  actionItem := {}\n}\n"
+	fromChart := &Bundle{
+		Name:         "widget",
+		Versions:     Versions{From: "< 2.0.0", To: "2.0.0"},
+		ValuesSchema: `{"type":"object","required":["image"]}`,
+		OpaChecks:    []string{noisy, kept},
+		Warnings:     []string{"chart warning"},
+		Origin:       OriginChart,
+	}
+	merged := Merge(config.Addons[0], fromChart)
+	assert.Equal(t, []string{noisy, kept}, merged.OpaChecks, "chart bundles bring back what the overlay disabled")
+
+	got, err := config.ApplyPatches(merged)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{kept}, got.OpaChecks)
+	assert.Empty(t, got.Warnings)
+	assert.Equal(t, `{"type":"object"}`, got.ValuesSchema)
+
+	again, err := config.ApplyPatches(got)
+	assert.NoError(t, err)
+	assert.Equal(t, got, again, "patches applied again change nothing")
+}
@@ -0,0 +1,117 @@
+/*
+Copyright © 2021 FairwindsOps Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bundle
+
+import (
+	"fmt"
+
+	"github.com/Masterminds/semver/v3"
+	"helm.sh/helm/v3/pkg/chart"
+)
+
+// TargetLatest plans an upgrade to the highest chart version the bundles can reach
+const TargetLatest = "latest"
+
+// Hop is a single upgrade step described by one bundle
+type Hop struct {
+	From      string
+	To        string
+	Bundle    *Bundle
+	MatchedBy []string
+}
+
+// PlanUpgrade chains bundles for the chart of a release and returns the shortest list of hops that upgrades
+// the installed chart version to target. Every hop is a bundle whose versions match the version reached by
+// the hop before it. The match criteria of each bundle are evaluated against the installed chart metadata
+// with only the version changed.
+func PlanUpgrade(addons []*Bundle, metadata *chart.Metadata, releaseName, namespace, target string) ([]Hop, error) {
+	installed, err := semver.NewVersion(metadata.Version)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse installed chart version %s: %v", metadata.Version, err)
+	}
+
+	var targetVer *semver.Version
+	if target != TargetLatest {
+		targetVer, err = semver.NewVersion(target)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse target version %s: %v", target, err)
+		}
+		if !installed.LessThan(targetVer) {
+			return nil, fmt.Errorf("installed version %s is not lower than target version %s", installed, targetVer)
+		}
+	}
+
+	// breadth first search so that the first path found to a version is the one with the fewest hops
+	type node struct {
+		version *semver.Version
+		raw     string
+	}
+	prev := map[string]Hop{}
+	visited := map[string]*semver.Version{installed.String(): installed}
+	queue := []node{{version: installed, raw: metadata.Version}}
+
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+
+		md := *metadata
+		md.Version = current.raw
+		for _, addon := range addons {
+			matchedBy, ok, err := addon.MatchRelease(&md, releaseName, namespace)
+			if err != nil || !ok {
+				continue
+			}
+			next, err := semver.NewVersion(addon.Versions.Target())
+			if err != nil || !current.version.LessThan(next) {
+				continue
+			}
+			if _, seen := visited[next.String()]; seen {
+				continue
+			}
+			visited[next.String()] = next
+			prev[next.String()] = Hop{From: current.raw, To: addon.Versions.Target(), Bundle: addon, MatchedBy: matchedBy}
+			queue = append(queue, node{version: next, raw: addon.Versions.Target()})
+		}
+	}
+
+	if targetVer == nil {
+		for _, v := range visited {
+			if targetVer == nil || targetVer.LessThan(v) {
+				targetVer = v
+			}
+		}
+		if targetVer.Equal(installed) {
+			return nil, fmt.Errorf("no bundle upgrades %s from version %s", metadata.Name, metadata.Version)
+		}
+	}
+
+	if _, ok := prev[targetVer.String()]; !ok {
+		return nil, fmt.Errorf("no upgrade path for %s from version %s to %s", metadata.Name, metadata.Version, target)
+	}
+
+	var hops []Hop
+	for v := targetVer.String(); v != installed.String(); {
+		hop := prev[v]
+		hops = append([]Hop{hop}, hops...)
+		from, err := semver.NewVersion(hop.From)
+		if err != nil {
+			return nil, err
+		}
+		v = from.String()
+	}
+	return hops, nil
+}
@@ -0,0 +1,98 @@
+/*
+Copyright © 2021 FairwindsOps Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bundle
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"helm.sh/helm/v3/pkg/chart"
+)
+
+func TestPlanUpgrade(t *testing.T) {
+	addons := []*Bundle{
+		{Name: "one", Source: Source{Chart: "cert-manager"}, Versions: Versions{Start: "1.5.0", End: "1.6.0"}},
+		{Name: "two", Source: Source{Chart: "cert-manager"}, Versions: Versions{Start: "1.6.0", End: "1.7.0"}},
+		{Name: "three", Source: Source{Chart: "cert-manager"}, Versions: Versions{Start: "1.7.0", End: "1.8.0"}},
+		{Name: "skip", Source: Source{Chart: "cert-manager"}, Versions: Versions{From: "~1.6", To: "1.8.0"}},
+		{Name: "other", Source: Source{Chart: "ingress-nginx"}, Versions: Versions{Start: "1.0.0", End: "9.0.0"}},
+	}
+
+	tests := []struct {
+		name      string
+		installed string
+		target    string
+		want      []string
+		wantErr   bool
+	}{
+		{
+			name:      "single hop",
+			installed: "1.5.2",
+			target:    "1.6.0",
+			want:      []string{"one"},
+		},
+		{
+			name:      "shortest path skips a hop",
+			installed: "1.5.2",
+			target:    "1.8.0",
+			want:      []string{"one", "skip"},
+		},
+		{
+			name:      "latest",
+			installed: "1.6.1",
+			target:    TargetLatest,
+			want:      []string{"skip"},
+		},
+		{
+			name:      "target not reachable",
+			installed: "1.5.2",
+			target:    "1.9.0",
+			wantErr:   true,
+		},
+		{
+			name:      "target lower than installed",
+			installed: "1.7.2",
+			target:    "1.6.0",
+			wantErr:   true,
+		},
+		{
+			name:      "no bundle for installed version",
+			installed: "1.4.0",
+			target:    TargetLatest,
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hops, err := PlanUpgrade(addons, &chart.Metadata{Name: "cert-manager", Version: tt.installed}, "cert-manager", "cert-manager", tt.target)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+
+			var got []string
+			from := tt.installed
+			for _, hop := range hops {
+				got = append(got, hop.Bundle.Name)
+				assert.Equal(t, from, hop.From)
+				from = hop.To
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
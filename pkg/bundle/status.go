@@ -0,0 +1,48 @@
+/*
+Copyright © 2021 FairwindsOps Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bundle
+
+// StatusCheck holds checks that only apply to releases in one of Statuses, such as failed or pending-upgrade
+type StatusCheck struct {
+	Statuses  []string `yaml:"statuses"`             // helm release statuses the checks apply to
+	Warnings  []string `yaml:"warnings,omitempty"`   // strings of warning messages
+	OpaChecks []string `yaml:"opa_checks,omitempty"` // embedded rego code
+}
+
+// ForStatus returns the bundle with the warnings and opa checks of the status checks that apply to a release
+// in status added to its own. The bundle is returned unchanged when none apply.
+func (b *Bundle) ForStatus(status string) *Bundle {
+	var applied []StatusCheck
+	for _, sc := range b.StatusChecks {
+		for _, s := range sc.Statuses {
+			if s == status {
+				applied = append(applied, sc)
+				break
+			}
+		}
+	}
+	if len(applied) == 0 {
+		return b
+	}
+
+	result := *b
+	for _, sc := range applied {
+		result.Warnings = appendMissing(result.Warnings, sc.Warnings)
+		result.OpaChecks = appendMissing(result.OpaChecks, sc.OpaChecks)
+	}
+	return &result
+}
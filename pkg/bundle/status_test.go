@@ -0,0 +1,67 @@
+/*
+Copyright © 2021 FairwindsOps Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bundle
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestForStatus(t *testing.T) {
+	b := &Bundle{
+		Name:      "cert-manager",
+		Warnings:  []string{"read the release notes"},
+		OpaChecks: []string{"package a"},
+		StatusChecks: []StatusCheck{
+			{Statuses: []string{"failed"}, Warnings: []string{"check the webhook"}},
+			{Statuses: []string{"failed", "pending-upgrade"}, Warnings: []string{"read the release notes", "delete the stuck job"}, OpaChecks: []string{"package b"}},
+		},
+		Origin: OriginUser,
+	}
+
+	tests := []struct {
+		status        string
+		wantWarnings  []string
+		wantOpaChecks []string
+	}{
+		{status: "deployed", wantWarnings: []string{"read the release notes"}, wantOpaChecks: []string{"package a"}},
+		{status: "failed", wantWarnings: []string{"read the release notes", "check the webhook", "delete the stuck job"}, wantOpaChecks: []string{"package a", "package b"}},
+		{status: "pending-upgrade", wantWarnings: []string{"read the release notes", "delete the stuck job"}, wantOpaChecks: []string{"package a", "package b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.status, func(t *testing.T) {
+			got := b.ForStatus(tt.status)
+			assert.Equal(t, tt.wantWarnings, got.Warnings)
+			assert.Equal(t, tt.wantOpaChecks, got.OpaChecks)
+		})
+	}
+	assert.Equal(t, []string{"read the release notes"}, b.Warnings, "the bundle is not changed")
+}
+
+func TestStatusChecksOrigin(t *testing.T) {
+	embedded := &Bundle{Name: "a", Origin: OriginEmbedded}
+	chart := &Bundle{Name: "a", Origin: OriginChart, StatusChecks: []StatusCheck{{Statuses: []string{"failed"}, Warnings: []string{"roll back first"}}}}
+
+	got := Merge(embedded, chart).ForStatus("failed")
+	assert.Equal(t, []string{"roll back first"}, got.Warnings)
+	assert.Equal(t, OriginChart, got.OriginOf(FieldWarnings, "roll back first"))
+
+	disabled, err := (&Patch{Name: "a", Disable: Disable{Warnings: []string{"roll back*"}}}).apply([]*Bundle{got})
+	assert.NoError(t, err)
+	assert.Empty(t, disabled[0].StatusChecks[0].Warnings)
+}
@@ -0,0 +1,127 @@
+/*
+Copyright © 2021 FairwindsOps Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bundle
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+)
+
+// Constraint returns the constraint that installed chart versions must satisfy.
+// Bundles using start and end are converted to the equivalent ">= start, < end" constraint.
+func (v Versions) Constraint() (*semver.Constraints, error) {
+	if v.From != "" {
+		return semver.NewConstraint(v.From)
+	}
+	if v.Start == "" || v.End == "" {
+		return nil, fmt.Errorf("versions must set either from and to, or start and end")
+	}
+	return semver.NewConstraint(fmt.Sprintf(">= %s, < %s", v.Start, v.End))
+}
+
+// String returns the range of chart versions as a constraint
+func (v Versions) String() string {
+	if v.From != "" {
+		return v.From
+	}
+	return fmt.Sprintf(">= %s, < %s", v.Start, v.End)
+}
+
+// Target returns the chart version that the bundle upgrades to
+func (v Versions) Target() string {
+	if v.From != "" {
+		return v.To
+	}
+	return v.End
+}
+
+// Matches reports whether an installed chart version satisfies the bundle versions. Pre-release versions
+// only match constraints that include a pre-release, unless Prerelease is set in which case they are
+// also compared as their release version, e.g. 1.5.0-rc.1 as 1.5.0. Bundles using start and end compare
+// pre-release versions by semver precedence like they always did, so 1.5.0-rc.1 is between 1.4.0 and 1.5.0.
+func (v Versions) Matches(version string) (bool, error) {
+	c, err := v.Constraint()
+	if err != nil {
+		return false, err
+	}
+	ver, err := semver.NewVersion(version)
+	if err != nil {
+		return false, err
+	}
+	if v.From == "" {
+		return v.inRange(ver)
+	}
+	if c.Check(ver) {
+		return true, nil
+	}
+	if v.Prerelease && ver.Prerelease() != "" {
+		return c.Check(releaseVersion(ver)), nil
+	}
+	return false, nil
+}
+
+// inRange reports whether a version is at least Start and lower than End
+func (v Versions) inRange(ver *semver.Version) (bool, error) {
+	start, err := semver.NewVersion(v.Start)
+	if err != nil {
+		return false, fmt.Errorf("invalid start version %s: %w", v.Start, err)
+	}
+	end, err := semver.NewVersion(v.End)
+	if err != nil {
+		return false, fmt.Errorf("invalid end version %s: %w", v.End, err)
+	}
+	return ver.Compare(start) >= 0 && ver.Compare(end) < 0, nil
+}
+
+// AllowsCluster reports whether a kubernetes version satisfies Constraint. Vendor suffixes
+// such as -eks-2d98532 are ignored. A bundle without a constraint allows every version.
+func (k K8sVersions) AllowsCluster(version string) (bool, error) {
+	if k.Constraint == "" {
+		return true, nil
+	}
+	c, err := semver.NewConstraint(k.Constraint)
+	if err != nil {
+		return false, err
+	}
+	ver, err := semver.NewVersion(version)
+	if err != nil {
+		return false, err
+	}
+	return c.Check(releaseVersion(ver)), nil
+}
+
+// String returns the supported kubernetes versions as a constraint, or an empty string when every version is supported
+func (k K8sVersions) String() string {
+	var parts []string
+	if k.Min != "" {
+		parts = append(parts, ">= "+k.Min)
+	}
+	if k.Max != "" {
+		parts = append(parts, "<= "+k.Max)
+	}
+	if k.Constraint != "" {
+		parts = append(parts, k.Constraint)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// releaseVersion strips the pre-release and metadata from a version
+func releaseVersion(v *semver.Version) *semver.Version {
+	return semver.New(v.Major(), v.Minor(), v.Patch(), "", "")
+}
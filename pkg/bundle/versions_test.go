@@ -0,0 +1,155 @@
+/*
+Copyright © 2021 FairwindsOps Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bundle
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVersionsMatches(t *testing.T) {
+	tests := []struct {
+		name     string
+		versions Versions
+		version  string
+		want     bool
+		wantErr  bool
+	}{
+		{
+			name:     "start and end inclusive start",
+			versions: Versions{Start: "1.4.5", End: "1.5.4"},
+			version:  "1.4.5",
+			want:     true,
+		},
+		{
+			name:     "start and end exclusive end",
+			versions: Versions{Start: "1.4.5", End: "1.5.4"},
+			version:  "1.5.4",
+			want:     false,
+		},
+		{
+			name:     "start and end are not strict versions",
+			versions: Versions{Start: "1.26", End: "1.27"},
+			version:  "v1.26.3",
+			want:     true,
+		},
+		{
+			name:     "start and end match pre-releases",
+			versions: Versions{Start: "5.10.2", End: "5.10.14"},
+			version:  "5.10.5-rc.1",
+			want:     true,
+		},
+		{
+			name:     "start and end match a pre-release of end",
+			versions: Versions{Start: "5.10.2", End: "5.10.14"},
+			version:  "5.10.14-rc.1",
+			want:     true,
+		},
+		{
+			name:     "constraint with or",
+			versions: Versions{From: ">=1.4.5 <1.6.0 || ~1.7", To: "1.8.0"},
+			version:  "1.7.3",
+			want:     true,
+		},
+		{
+			name:     "constraint excluding a version",
+			versions: Versions{From: ">=1.0.0 <2.0.0, !=1.4.2", To: "2.0.0"},
+			version:  "1.4.2",
+			want:     false,
+		},
+		{
+			name:     "pre-release without opt-in",
+			versions: Versions{From: ">=1.4.5 <1.6.0", To: "1.6.0"},
+			version:  "1.5.0-rc.1",
+			want:     false,
+		},
+		{
+			name:     "pre-release with opt-in",
+			versions: Versions{From: ">=1.4.5 <1.6.0", To: "1.6.0", Prerelease: true},
+			version:  "1.5.0-rc.1",
+			want:     true,
+		},
+		{
+			name:     "pre-release in constraint",
+			versions: Versions{From: ">=1.5.0-0 <1.6.0-0", To: "1.6.0"},
+			version:  "1.5.0-rc.1",
+			want:     true,
+		},
+		{
+			name:     "invalid constraint",
+			versions: Versions{From: ">= banana", To: "1.6.0"},
+			version:  "1.5.0",
+			wantErr:  true,
+		},
+		{
+			name:     "missing versions",
+			versions: Versions{Start: "1.5.0"},
+			version:  "1.5.0",
+			wantErr:  true,
+		},
+		{
+			name:     "invalid chart version",
+			versions: Versions{Start: "1.4.5", End: "1.5.4"},
+			version:  "not-a-version",
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.versions.Matches(tt.version)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestVersionsTarget(t *testing.T) {
+	assert.Equal(t, "1.5.4", Versions{Start: "1.4.5", End: "1.5.4"}.Target())
+	assert.Equal(t, "1.8.0", Versions{From: "~1.7", To: "1.8.0"}.Target())
+}
+
+func TestVersionsString(t *testing.T) {
+	assert.Equal(t, ">= 1.4.5, < 1.5.4", Versions{Start: "1.4.5", End: "1.5.4"}.String())
+	assert.Equal(t, "~1.7", Versions{From: "~1.7", To: "1.8.0"}.String())
+	assert.Equal(t, ">= 1.19, <= 1.27", K8sVersions{Min: "1.19", Max: "1.27"}.String())
+	assert.Equal(t, "", K8sVersions{}.String())
+}
+
+func TestK8sVersionsAllowsCluster(t *testing.T) {
+	tests := []struct {
+		name       string
+		constraint string
+		version    string
+		want       bool
+	}{
+		{name: "no constraint", constraint: "", version: "v1.27.3", want: true},
+		{name: "vendor suffix is ignored", constraint: ">=1.23 <1.28", version: "v1.27.3-eks-2d98532", want: true},
+		{name: "outside constraint", constraint: ">=1.23 <1.28", version: "v1.28.1", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := K8sVersions{Constraint: tt.constraint}.AllowsCluster(tt.version)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
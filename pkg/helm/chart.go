@@ -0,0 +1,76 @@
+// Copyright 2021 FairwindsOps, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package helm
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/cli"
+	"helm.sh/helm/v3/pkg/getter"
+	"helm.sh/helm/v3/pkg/registry"
+	"helm.sh/helm/v3/pkg/repo"
+)
+
+// LoadChart loads a version of a chart the way helm does. ref is a chart archive or directory, a repo/chart
+// name from the local helm repositories, a chart name in repoURL, or an oci:// reference. A local chart must have
+// the version asked for, when one is given.
+func LoadChart(ref, repoURL, version string) (*chart.Chart, error) {
+	if _, err := os.Stat(ref); err == nil && repoURL == "" {
+		ch, err := loader.Load(ref)
+		if err != nil {
+			return nil, err
+		}
+		if version != "" && ch.Metadata.Version != version {
+			return nil, fmt.Errorf("chart %s has version %s, not %s", ref, ch.Metadata.Version, version)
+		}
+		return ch, nil
+	}
+
+	settings := cli.New()
+	registryClient, err := registry.NewClient(registry.ClientOptCredentialsFile(settings.RegistryConfig))
+	if err != nil {
+		return nil, fmt.Errorf("unable to create registry client: %v", err)
+	}
+	show := action.NewShowWithConfig(action.ShowChart, &action.Configuration{RegistryClient: registryClient})
+	show.RepoURL = repoURL
+	show.Version = version
+	path, err := show.LocateChart(ref, settings)
+	if err != nil {
+		return nil, fmt.Errorf("unable to find chart %s version %s: %v", ref, version, err)
+	}
+	return loader.Load(path)
+}
+
+// LoadRepositoryIndex downloads the index of a helm repository into the helm repository cache
+func LoadRepositoryIndex(repoURL string) (*repo.IndexFile, error) {
+	settings := cli.New()
+	// the index is cached under the name of the repository, so name it after the url
+	name := fmt.Sprintf("gonogo-%x", sha256.Sum256([]byte(repoURL)))[:23]
+	r, err := repo.NewChartRepository(&repo.Entry{Name: name, URL: repoURL}, getter.All(settings))
+	if err != nil {
+		return nil, err
+	}
+	r.CachePath = settings.RepositoryCache
+	path, err := r.DownloadIndexFile()
+	if err != nil {
+		return nil, fmt.Errorf("unable to download the index of %s: %v", repoURL, err)
+	}
+	return repo.LoadIndexFile(path)
+}
@@ -0,0 +1,50 @@
+// Copyright 2021 FairwindsOps, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package helm
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadChartLocal(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "mychart")
+	assert.NoError(t, os.MkdirAll(dir, 0o755))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "Chart.yaml"), []byte("apiVersion: v2\nname: mychart\nversion: 1.0.0\n"), 0o644))
+
+	tests := []struct {
+		name    string
+		version string
+		wantErr bool
+	}{
+		{name: "no version", version: ""},
+		{name: "same version", version: "1.0.0"},
+		{name: "other version", version: "2.0.0", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ch, err := LoadChart(dir, "", tt.version)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, "1.0.0", ch.Metadata.Version)
+		})
+	}
+}
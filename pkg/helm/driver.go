@@ -0,0 +1,164 @@
+// Copyright 2021 FairwindsOps, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package helm
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	driverv3 "helm.sh/helm/v3/pkg/storage/driver"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog"
+)
+
+// Helm storage drivers that releases can be read from
+const (
+	DriverSecret    = "secret"
+	DriverConfigMap = "configmap"
+	DriverSQL       = "sql"
+	// DriverAuto reads releases from Secrets, ConfigMaps or both, depending on where helm release objects are found
+	DriverAuto = "auto"
+)
+
+// helmOwnerSelector selects the Secrets and ConfigMaps helm stores releases in
+const helmOwnerSelector = "owner=helm"
+
+// DefaultDriver returns the storage driver configured for helm with HELM_DRIVER
+func DefaultDriver() string {
+	if d := os.Getenv("HELM_DRIVER"); d != "" {
+		return d
+	}
+	return DriverSecret
+}
+
+// driverNames returns the names of the storage drivers to read releases with, along with why they were chosen.
+// scopes are the namespaces to look for helm release objects in when the driver is detected.
+func (h *Helm) driverNames(scopes []string) ([]string, string, error) {
+	switch driverName(h.Driver) {
+	case DriverSecret:
+		return []string{DriverSecret}, "reading helm releases from Secrets", nil
+	case DriverConfigMap:
+		return []string{DriverConfigMap}, "reading helm releases from ConfigMaps", nil
+	case DriverSQL:
+		return []string{DriverSQL}, "reading helm releases from the SQL database", nil
+	case DriverAuto:
+		return h.detectDrivers(scopes)
+	}
+	return nil, "", fmt.Errorf("unknown helm driver %s, use one of secret, configmap, sql or auto", h.Driver)
+}
+
+// newDriver returns a storage driver that reads releases in a namespace, or every namespace when it is empty
+func (h *Helm) newDriver(name, namespace string) (driverv3.Driver, error) {
+	switch name {
+	case DriverSecret:
+		return driverv3.NewSecrets(h.Kube.Client.CoreV1().Secrets(namespace)), nil
+	case DriverConfigMap:
+		return driverv3.NewConfigMaps(h.Kube.Client.CoreV1().ConfigMaps(namespace)), nil
+	case DriverSQL:
+		connection := h.SQLConnectionString
+		if connection == "" {
+			connection = os.Getenv("HELM_DRIVER_SQL_CONNECTION_STRING")
+		}
+		if connection == "" {
+			return nil, fmt.Errorf("the sql helm driver needs a connection string, set HELM_DRIVER_SQL_CONNECTION_STRING")
+		}
+		d, err := driverv3.NewSQL(connection, klog.V(5).Infof, namespace)
+		if err != nil {
+			return nil, fmt.Errorf("unable to connect to the helm sql storage: %v", err)
+		}
+		return d, nil
+	}
+	return nil, fmt.Errorf("unknown helm driver %s", name)
+}
+
+// detectDrivers looks for the Secrets and ConfigMaps that helm stores releases in and returns the drivers for the kinds found
+func (h *Helm) detectDrivers(scopes []string) ([]string, string, error) {
+	secrets := h.hasHelmObjects(DriverSecret, scopes)
+	configMaps := h.hasHelmObjects(DriverConfigMap, scopes)
+
+	switch {
+	case secrets && configMaps:
+		return []string{DriverSecret, DriverConfigMap}, "found Secrets and ConfigMaps labeled owner=helm, reading helm releases from both", nil
+	case configMaps:
+		return []string{DriverConfigMap}, "found ConfigMaps labeled owner=helm, reading helm releases from ConfigMaps", nil
+	case secrets:
+		return []string{DriverSecret}, "found Secrets labeled owner=helm, reading helm releases from Secrets", nil
+	}
+	return []string{DriverSecret},
+		"found no Secrets or ConfigMaps labeled owner=helm, reading helm releases from Secrets, use --helm-driver=sql if releases are stored in a database", nil
+}
+
+// hasHelmObjects reports whether there are Secrets or ConfigMaps, depending on the driver, that hold helm releases
+// in any of the namespaces. Objects that can not be listed are treated as missing.
+func (h *Helm) hasHelmObjects(driver string, scopes []string) bool {
+	opts := metav1.ListOptions{LabelSelector: helmOwnerSelector, Limit: 1}
+	for _, ns := range scopes {
+		var found int
+		var err error
+		switch driver {
+		case DriverConfigMap:
+			var list *v1.ConfigMapList
+			list, err = h.Kube.Client.CoreV1().ConfigMaps(ns).List(context.TODO(), opts)
+			if err == nil {
+				found = len(list.Items)
+			}
+		default:
+			var list *v1.SecretList
+			list, err = h.Kube.Client.CoreV1().Secrets(ns).List(context.TODO(), opts)
+			if err == nil {
+				found = len(list.Items)
+			}
+		}
+		if err != nil {
+			klog.V(3).Infof("unable to look for helm releases with the %s driver%s: %v", driver, inNamespace(ns), err)
+			continue
+		}
+		if found > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// warnOtherDriver warns when no releases were found with the configured driver but helm objects of the other kind exist
+func (h *Helm) warnOtherDriver(scopes []string) {
+	var other, kind string
+	switch driverName(h.Driver) {
+	case DriverSecret:
+		other, kind = DriverConfigMap, "ConfigMaps"
+	case DriverConfigMap:
+		other, kind = DriverSecret, "Secrets"
+	default:
+		return
+	}
+	if !h.hasHelmObjects(other, scopes) {
+		return
+	}
+	klog.Warningf("no helm releases were found with the %s driver, but there are %s labeled owner=helm. Use --helm-driver=%s or --helm-driver=auto",
+		driverName(h.Driver), kind, other)
+}
+
+// driverName returns the canonical name of a helm driver
+func driverName(driver string) string {
+	switch driver {
+	case "", "secret", "secrets":
+		return DriverSecret
+	case "configmap", "configmaps":
+		return DriverConfigMap
+	}
+	return driver
+}
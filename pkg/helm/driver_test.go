@@ -0,0 +1,89 @@
+// Copyright 2021 FairwindsOps, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package helm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/release"
+	driverv3 "helm.sh/helm/v3/pkg/storage/driver"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func testRelease(name string) *release.Release {
+	return &release.Release{
+		Name:      name,
+		Namespace: "default",
+		Version:   1,
+		Info:      &release.Info{Status: release.StatusDeployed},
+		Chart:     &chart.Chart{Metadata: &chart.Metadata{Name: name, Version: "1.0.0"}},
+	}
+}
+
+func TestGetReleasesVersionThreeDrivers(t *testing.T) {
+	tests := []struct {
+		name       string
+		driver     string
+		secrets    []string
+		configMaps []string
+		want       []string
+		wantErr    bool
+	}{
+		{name: "secrets by default", secrets: []string{"a"}, configMaps: []string{"b"}, want: []string{"a"}},
+		{name: "secrets", driver: "secrets", secrets: []string{"a"}, configMaps: []string{"b"}, want: []string{"a"}},
+		{name: "configmaps", driver: DriverConfigMap, secrets: []string{"a"}, configMaps: []string{"b"}, want: []string{"b"}},
+		{name: "auto with configmaps", driver: DriverAuto, configMaps: []string{"b"}, want: []string{"b"}},
+		{name: "auto with both", driver: DriverAuto, secrets: []string{"a"}, configMaps: []string{"b"}, want: []string{"a", "b"}},
+		{name: "auto with none", driver: DriverAuto},
+		{name: "sql without connection string", driver: DriverSQL, wantErr: true},
+		{name: "unknown driver", driver: "memory", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("HELM_DRIVER_SQL_CONNECTION_STRING", "")
+			client := fake.NewSimpleClientset(&v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default"}})
+			for _, name := range tt.secrets {
+				assert.NoError(t, driverv3.NewSecrets(client.CoreV1().Secrets("default")).Create("sh.helm.release.v1."+name+".v1", testRelease(name)))
+			}
+			for _, name := range tt.configMaps {
+				assert.NoError(t, driverv3.NewConfigMaps(client.CoreV1().ConfigMaps("default")).Create("sh.helm.release.v1."+name+".v1", testRelease(name)))
+			}
+
+			h := &Helm{Kube: &kube{Client: client}, Driver: tt.driver}
+			err := h.GetReleasesVersionThree()
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			var got []string
+			for _, r := range h.Releases {
+				got = append(got, r.Name)
+			}
+			assert.ElementsMatch(t, tt.want, got)
+		})
+	}
+}
+
+func TestDefaultDriver(t *testing.T) {
+	t.Setenv("HELM_DRIVER", "")
+	assert.Equal(t, DriverSecret, DefaultDriver())
+	t.Setenv("HELM_DRIVER", "configmap")
+	assert.Equal(t, DriverConfigMap, DefaultDriver())
+}
@@ -0,0 +1,68 @@
+// Copyright 2021 FairwindsOps, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package helm
+
+import (
+	"fmt"
+	"os"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Fleet lists the clusters to check together
+type Fleet struct {
+	Clusters []FleetCluster `json:"clusters"`
+}
+
+// FleetCluster is a cluster of a fleet, reached through a kubeconfig context
+type FleetCluster struct {
+	// Name is the name of the cluster in the report, the context when it is empty
+	Name string `json:"name,omitempty"`
+	// Context is the kubeconfig context of the cluster, the current context when it is empty
+	Context string `json:"context,omitempty"`
+	// Kubeconfig is the kubeconfig file with the context, KUBECONFIG and the default location are read when it is empty
+	Kubeconfig string `json:"kubeconfig,omitempty"`
+}
+
+// ReadFleet reads a fleet file
+func ReadFleet(path string) (*Fleet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	fleet := &Fleet{}
+	if err := yaml.UnmarshalStrict(data, fleet); err != nil {
+		return nil, fmt.Errorf("unable to read fleet file %s: %w", path, err)
+	}
+
+	names := map[string]bool{}
+	for i := range fleet.Clusters {
+		c := &fleet.Clusters[i]
+		if c.Name == "" {
+			c.Name = c.Context
+		}
+		if c.Name == "" {
+			return nil, fmt.Errorf("cluster %d of fleet file %s needs a name or a context", i+1, path)
+		}
+		if names[c.Name] {
+			return nil, fmt.Errorf("cluster %s is listed twice in fleet file %s", c.Name, path)
+		}
+		names[c.Name] = true
+	}
+	if len(fleet.Clusters) == 0 {
+		return nil, fmt.Errorf("fleet file %s has no clusters", path)
+	}
+	return fleet, nil
+}
@@ -0,0 +1,111 @@
+// Copyright 2021 FairwindsOps, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package helm
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+const testKubeconfig = `
+apiVersion: v1
+kind: Config
+clusters:
+- name: prod
+  cluster:
+    server: https://prod.example.com
+- name: staging
+  cluster:
+    server: https://staging.example.com
+contexts:
+- name: staging
+  context:
+    cluster: staging
+    user: admin
+- name: prod
+  context:
+    cluster: prod
+    user: admin
+current-context: staging
+users:
+- name: admin
+  user:
+    token: secret
+`
+
+func TestNewHelmForContext(t *testing.T) {
+	kubeconfig := filepath.Join(t.TempDir(), "config")
+	assert.NoError(t, os.WriteFile(kubeconfig, []byte(testKubeconfig), 0600))
+
+	contexts, err := KubeContexts(kubeconfig)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"prod", "staging"}, contexts)
+
+	prod, err := NewHelmForContext(kubeconfig, "prod")
+	assert.NoError(t, err)
+	staging, err := NewHelmForContext(kubeconfig, "staging")
+	assert.NoError(t, err)
+	assert.NotSame(t, prod.Kube, staging.Kube)
+
+	_, err = NewHelmForContext(kubeconfig, "missing")
+	assert.Error(t, err)
+}
+
+func TestReadFleet(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		want    []FleetCluster
+		wantErr bool
+	}{
+		{
+			name: "names default to the context",
+			file: "clusters:\n- context: prod\n- name: eu\n  context: prod-eu\n  kubeconfig: /etc/eu.yaml\n",
+			want: []FleetCluster{{Name: "prod", Context: "prod"}, {Name: "eu", Context: "prod-eu", Kubeconfig: "/etc/eu.yaml"}},
+		},
+		{name: "no clusters", file: "clusters: []\n", wantErr: true},
+		{name: "no name", file: "clusters:\n- kubeconfig: /etc/eu.yaml\n", wantErr: true},
+		{name: "duplicate", file: "clusters:\n- context: prod\n- name: prod\n", wantErr: true},
+		{name: "unknown field", file: "clusters:\n- contxt: prod\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "fleet.yaml")
+			assert.NoError(t, os.WriteFile(path, []byte(tt.file), 0644))
+			got, err := ReadFleet(path)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got.Clusters)
+		})
+	}
+}
+
+func TestNewHelmForConfig(t *testing.T) {
+	h, err := NewHelmForConfig(&rest.Config{Host: "https://cluster.example.com"})
+	assert.NoError(t, err)
+	assert.NotNil(t, h.Kube.Client)
+	assert.NotNil(t, h.Dynamic.Client)
+
+	_, err = NewHelmForConfig(&rest.Config{Host: "https://cluster.example.com", ExecProvider: &api.ExecConfig{}, AuthProvider: &api.AuthProviderConfig{}})
+	assert.Error(t, err)
+}
@@ -0,0 +1,465 @@
+// Copyright 2021 FairwindsOps, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package helm
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/strvals"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/klog"
+)
+
+// Providers that releases are discovered from
+const (
+	ProviderHelm   = "helm"   // helm storage
+	ProviderFlux   = "flux"   // Flux HelmRelease objects
+	ProviderArgoCD = "argocd" // Argo CD Application objects
+)
+
+// fluxHelmReleases are the versions of the Flux HelmRelease resource, newest first
+var fluxHelmReleases = []schema.GroupVersionResource{
+	{Group: "helm.toolkit.fluxcd.io", Version: "v2", Resource: "helmreleases"},
+	{Group: "helm.toolkit.fluxcd.io", Version: "v2beta2", Resource: "helmreleases"},
+	{Group: "helm.toolkit.fluxcd.io", Version: "v2beta1", Resource: "helmreleases"},
+}
+
+// argoApplications is the Argo CD Application resource
+var argoApplications = schema.GroupVersionResource{Group: "argoproj.io", Version: "v1alpha1", Resource: "applications"}
+
+// AllProviders returns every provider releases can be discovered from
+func AllProviders() []string {
+	return []string{ProviderHelm, ProviderFlux, ProviderArgoCD}
+}
+
+// providers returns the providers to discover releases from, helm storage when none are set
+func (h *Helm) providers() []string {
+	if len(h.Providers) == 0 {
+		return []string{ProviderHelm}
+	}
+	return h.Providers
+}
+
+// useProvider reports whether releases are discovered from a provider
+func (h *Helm) useProvider(provider string) bool {
+	for _, p := range h.providers() {
+		if p == provider {
+			return true
+		}
+	}
+	return false
+}
+
+// ProviderOf returns the provider a release was discovered from
+func (h *Helm) ProviderOf(namespace, name string) string {
+	if p, ok := h.discovered[namespace+"/"+name]; ok {
+		return p
+	}
+	return ProviderHelm
+}
+
+// discoverGitOps returns the releases of the Flux HelmRelease and Argo CD Application objects in the namespaces in
+// scope that are not in known, which are the releases read from helm storage. Resources that are not installed in
+// the cluster or can not be read for lack of permissions are skipped.
+func (h *Helm) discoverGitOps(scopes []string, known []*release.Release) ([]*release.Release, error) {
+	seen := map[string]bool{}
+	for _, r := range known {
+		seen[releaseKey(r)] = true
+	}
+	if h.discovered == nil {
+		h.discovered = map[string]string{}
+	}
+
+	var result []*release.Release
+	add := func(provider string, objs []unstructured.Unstructured, convert func(unstructured.Unstructured) (*release.Release, error)) {
+		for _, obj := range objs {
+			rel, err := convert(obj)
+			if err != nil {
+				klog.Warningf("ignoring %s %s/%s: %v", obj.GetKind(), obj.GetNamespace(), obj.GetName(), err)
+				continue
+			}
+			if rel == nil || seen[releaseKey(rel)] {
+				continue
+			}
+			seen[releaseKey(rel)] = true
+			h.discovered[releaseKey(rel)] = provider
+			result = append(result, rel)
+		}
+	}
+
+	if h.useProvider(ProviderFlux) {
+		for _, gvr := range fluxHelmReleases {
+			objs, found, err := h.listProviderObjects(gvr, scopes)
+			if err != nil {
+				return nil, err
+			}
+			if found {
+				lookup := h.clusterLookup()
+				add(ProviderFlux, objs, func(obj unstructured.Unstructured) (*release.Release, error) {
+					return fluxRelease(obj, lookup)
+				})
+				break
+			}
+		}
+	}
+	if h.useProvider(ProviderArgoCD) {
+		objs, _, err := h.listProviderObjects(argoApplications, scopes)
+		if err != nil {
+			return nil, err
+		}
+		add(ProviderArgoCD, objs, argoRelease)
+	}
+	return result, nil
+}
+
+// listProviderObjects lists the objects of a resource in the namespaces in scope. found is false when the resource
+// is not installed in the cluster or can not be read.
+func (h *Helm) listProviderObjects(gvr schema.GroupVersionResource, scopes []string) ([]unstructured.Unstructured, bool, error) {
+	var result []unstructured.Unstructured
+	for _, ns := range scopes {
+		objs, err := h.GetClusterObjects(gvr.Group, gvr.Version, gvr.Resource, ns)
+		switch {
+		case err == nil:
+			result = append(result, objs...)
+		case apierrors.IsNotFound(err):
+			klog.V(3).Infof("%s is not installed, not looking for releases in it", resourceKey(gvr))
+			return nil, false, nil
+		case IsAccessError(err):
+			klog.Warningf("unable to look for releases in %s%s: %v", resourceKey(gvr), inNamespace(ns), err)
+		default:
+			return nil, false, fmt.Errorf("unable to list %s%s: %w", resourceKey(gvr), inNamespace(ns), err)
+		}
+	}
+	return result, true, nil
+}
+
+// declaration is a release declared to a gitops tool. Version may be a constraint until it is resolved.
+type declaration struct {
+	name        string
+	namespace   string
+	chart       string
+	version     string
+	repository  string // url of the helm repository of the chart, when it is known
+	values      map[string]interface{}
+	status      release.Status
+	description string
+}
+
+// release returns the release of a declaration, which has no manifest. The version has to be resolved.
+func (d *declaration) release() (*release.Release, error) {
+	if _, err := semver.NewVersion(d.version); err != nil {
+		return nil, fmt.Errorf("unable to find the chart version of %s, %q is not a version", d.chart, d.version)
+	}
+	return &release.Release{
+		Name:      d.name,
+		Namespace: d.namespace,
+		Version:   1,
+		Info:      &release.Info{Status: d.status, Description: d.description},
+		Chart:     &chart.Chart{Metadata: &chart.Metadata{Name: d.chart, Version: d.version}},
+		Config:    d.values,
+	}, nil
+}
+
+// fluxRelease reconstructs the release of a Flux HelmRelease. The chart version is the last one Flux applied,
+// or the version in the spec when it has not applied any. Values from ConfigMaps and Secrets are read with lookup.
+func fluxRelease(obj unstructured.Unstructured, lookup objectLookup) (*release.Release, error) {
+	d, err := fluxDeclaration(obj, lookup)
+	if err != nil {
+		return nil, err
+	}
+	return d.release()
+}
+
+// fluxDeclaration reads a Flux HelmRelease. Values from ConfigMaps and Secrets are read with lookup when it is set.
+func fluxDeclaration(obj unstructured.Unstructured, lookup objectLookup) (*declaration, error) {
+	chartName, _, _ := unstructured.NestedString(obj.Object, "spec", "chart", "spec", "chart")
+	if chartName == "" {
+		return nil, fmt.Errorf("only HelmReleases with spec.chart are supported")
+	}
+
+	d := &declaration{
+		name:        obj.GetName(),
+		namespace:   obj.GetNamespace(),
+		chart:       chartName,
+		status:      release.StatusDeployed,
+		description: "Reconciled by Flux",
+	}
+	if target, _, _ := unstructured.NestedString(obj.Object, "spec", "targetNamespace"); target != "" {
+		d.namespace = target
+		d.name = target + "-" + d.name
+	}
+	if releaseName, _, _ := unstructured.NestedString(obj.Object, "spec", "releaseName"); releaseName != "" {
+		d.name = releaseName
+	}
+
+	d.version, _, _ = unstructured.NestedString(obj.Object, "spec", "chart", "spec", "version")
+	if history, _, _ := unstructured.NestedSlice(obj.Object, "status", "history"); len(history) > 0 {
+		if latest, ok := history[0].(map[string]interface{}); ok {
+			if v, ok := latest["chartVersion"].(string); ok && v != "" {
+				d.version = v
+			}
+		}
+	} else if v, _, _ := unstructured.NestedString(obj.Object, "status", "lastAppliedRevision"); v != "" {
+		d.version = v
+	}
+
+	values := map[string]interface{}{}
+	if lookup != nil {
+		var err error
+		values, err = fluxValuesFrom(obj, lookup)
+		if err != nil {
+			return nil, err
+		}
+		if ref, _, _ := unstructured.NestedStringMap(obj.Object, "spec", "chart", "spec", "sourceRef"); ref["kind"] == "HelmRepository" {
+			ns := ref["namespace"]
+			if ns == "" {
+				ns = obj.GetNamespace()
+			}
+			if repo, ok, _ := lookup("HelmRepository", ns, ref["name"]); ok {
+				d.repository, _, _ = unstructured.NestedString(repo.Object, "spec", "url")
+			}
+		}
+	}
+	inline, _, err := unstructured.NestedMap(obj.Object, "spec", "values")
+	if err != nil {
+		return nil, fmt.Errorf("invalid spec.values: %w", err)
+	}
+	d.values = chartutil.CoalesceTables(inline, values)
+
+	conditions, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	for _, c := range conditions {
+		cond, ok := c.(map[string]interface{})
+		if !ok || cond["type"] != "Ready" {
+			continue
+		}
+		if msg, ok := cond["message"].(string); ok {
+			d.description = msg
+		}
+		if cond["status"] == "False" {
+			d.status = release.StatusFailed
+		}
+	}
+	return d, nil
+}
+
+// objectLookup finds an object by kind, namespace and name. found is false when there is no such object, the error
+// is that of reading it.
+type objectLookup func(kind, namespace, name string) (obj unstructured.Unstructured, found bool, err error)
+
+// clusterLookup returns an objectLookup of the ConfigMaps and Secrets in the cluster, the objects of a namespace
+// are listed once
+func (h *Helm) clusterLookup() objectLookup {
+	listed := map[string][]unstructured.Unstructured{}
+	return func(kind, namespace, name string) (unstructured.Unstructured, bool, error) {
+		var resource string
+		switch kind {
+		case "ConfigMap":
+			resource = "configmaps"
+		case "Secret":
+			resource = "secrets"
+		default:
+			return unstructured.Unstructured{}, false, nil
+		}
+		key := resource + "/" + namespace
+		objs, ok := listed[key]
+		if !ok {
+			var err error
+			objs, err = h.GetClusterObjects("", "v1", resource, namespace)
+			if err != nil {
+				return unstructured.Unstructured{}, false, err
+			}
+			listed[key] = objs
+		}
+		for _, obj := range objs {
+			if obj.GetName() == name {
+				obj.SetKind(kind)
+				return obj, true, nil
+			}
+		}
+		return unstructured.Unstructured{}, false, nil
+	}
+}
+
+// fluxValuesFrom merges the values of the ConfigMaps and Secrets in spec.valuesFrom of a Flux HelmRelease in order
+func fluxValuesFrom(obj unstructured.Unstructured, lookup objectLookup) (map[string]interface{}, error) {
+	values := map[string]interface{}{}
+	from, _, _ := unstructured.NestedSlice(obj.Object, "spec", "valuesFrom")
+	for _, f := range from {
+		ref, ok := f.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		kind, _ := ref["kind"].(string)
+		name, _ := ref["name"].(string)
+		key, _ := ref["valuesKey"].(string)
+		if key == "" {
+			key = "values.yaml"
+		}
+		targetPath, _ := ref["targetPath"].(string)
+		optional, _ := ref["optional"].(bool)
+
+		src, ok, err := lookup(kind, obj.GetNamespace(), name)
+		if err != nil {
+			if IsAccessError(err) {
+				klog.Warningf("ignoring values from %s %s/%s of HelmRelease %s/%s: %v", kind, obj.GetNamespace(), name, obj.GetNamespace(), obj.GetName(), err)
+				continue
+			}
+			return nil, fmt.Errorf("unable to read %s %s/%s in valuesFrom: %w", kind, obj.GetNamespace(), name, err)
+		}
+		var data string
+		if ok {
+			data, ok = objectData(src, key)
+		}
+		if !ok {
+			if optional {
+				continue
+			}
+			return nil, fmt.Errorf("%s %s/%s with key %s in valuesFrom was not found", kind, obj.GetNamespace(), name, key)
+		}
+
+		if targetPath != "" {
+			if err := strvals.ParseIntoString(fmt.Sprintf("%s=%s", targetPath, data), values); err != nil {
+				return nil, fmt.Errorf("invalid targetPath %s: %w", targetPath, err)
+			}
+			continue
+		}
+		v, err := chartutil.ReadValues([]byte(data))
+		if err != nil {
+			return nil, fmt.Errorf("invalid values in %s %s/%s: %w", kind, obj.GetNamespace(), name, err)
+		}
+		values = chartutil.CoalesceTables(v, values)
+	}
+	return values, nil
+}
+
+// objectData returns a key of the data of a ConfigMap or Secret
+func objectData(obj unstructured.Unstructured, key string) (string, bool) {
+	if v, ok, _ := unstructured.NestedString(obj.Object, "stringData", key); ok {
+		return v, true
+	}
+	v, ok, _ := unstructured.NestedString(obj.Object, "data", key)
+	if !ok || obj.GetKind() != "Secret" {
+		return v, ok
+	}
+	decoded, err := base64.StdEncoding.DecodeString(v)
+	if err != nil {
+		return "", false
+	}
+	return string(decoded), true
+}
+
+// argoRelease reconstructs the release of an Argo CD Application of a chart from a helm repository.
+// nil is returned for applications of other sources.
+func argoRelease(obj unstructured.Unstructured) (*release.Release, error) {
+	d, err := argoDeclaration(obj)
+	if err != nil || d == nil {
+		return nil, err
+	}
+	return d.release()
+}
+
+// argoDeclaration reads an Argo CD Application of a chart from a helm repository, nil is returned for applications
+// of other sources. The version is the one Argo CD last synced, or the one in the spec when it has not synced.
+func argoDeclaration(obj unstructured.Unstructured) (*declaration, error) {
+	source, _, _ := unstructured.NestedMap(obj.Object, "spec", "source")
+	single := source != nil
+	if !single {
+		sources, _, _ := unstructured.NestedSlice(obj.Object, "spec", "sources")
+		for _, s := range sources {
+			if m, ok := s.(map[string]interface{}); ok && m["chart"] != nil {
+				source = m
+				break
+			}
+		}
+	}
+	chartName, _, _ := unstructured.NestedString(source, "chart")
+	if chartName == "" {
+		klog.V(3).Infof("Application %s/%s is not of a chart from a helm repository", obj.GetNamespace(), obj.GetName())
+		return nil, nil
+	}
+
+	d := &declaration{
+		name:        obj.GetName(),
+		namespace:   obj.GetNamespace(),
+		chart:       chartName,
+		status:      release.StatusDeployed,
+		description: "Synced by Argo CD",
+	}
+	d.repository, _, _ = unstructured.NestedString(source, "repoURL")
+	d.version, _, _ = unstructured.NestedString(source, "targetRevision")
+	if revision, _, _ := unstructured.NestedString(obj.Object, "status", "sync", "revision"); single && revision != "" {
+		d.version = revision
+	}
+	if name, _, _ := unstructured.NestedString(source, "helm", "releaseName"); name != "" {
+		d.name = name
+	}
+	if namespace, _, _ := unstructured.NestedString(obj.Object, "spec", "destination", "namespace"); namespace != "" {
+		d.namespace = namespace
+	}
+
+	var err error
+	d.values, err = argoValues(source)
+	if err != nil {
+		return nil, err
+	}
+
+	if health, _, _ := unstructured.NestedString(obj.Object, "status", "health", "status"); health == "Degraded" {
+		d.status = release.StatusFailed
+		d.description = "Argo CD reports the application as degraded"
+	}
+	if msg, _, _ := unstructured.NestedString(obj.Object, "status", "operationState", "message"); msg != "" {
+		d.description = msg
+	}
+	return d, nil
+}
+
+// argoValues merges the values, valuesObject and parameters of an Argo CD helm source, in that order
+func argoValues(source map[string]interface{}) (map[string]interface{}, error) {
+	values := map[string]interface{}{}
+	if s, _, _ := unstructured.NestedString(source, "helm", "values"); strings.TrimSpace(s) != "" {
+		v, err := chartutil.ReadValues([]byte(s))
+		if err != nil {
+			return nil, fmt.Errorf("invalid helm values: %w", err)
+		}
+		values = v
+	}
+	if obj, _, _ := unstructured.NestedMap(source, "helm", "valuesObject"); obj != nil {
+		values = chartutil.CoalesceTables(obj, values)
+	}
+	params, _, _ := unstructured.NestedSlice(source, "helm", "parameters")
+	for _, p := range params {
+		param, ok := p.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		set := fmt.Sprintf("%v=%v", param["name"], param["value"])
+		parse := strvals.ParseInto
+		if force, _ := param["forceString"].(bool); force {
+			parse = strvals.ParseIntoString
+		}
+		if err := parse(set, values); err != nil {
+			return nil, fmt.Errorf("invalid helm parameter %s: %w", param["name"], err)
+		}
+	}
+	return values, nil
+}
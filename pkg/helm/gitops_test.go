@@ -0,0 +1,266 @@
+// Copyright 2021 FairwindsOps, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package helm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"helm.sh/helm/v3/pkg/release"
+	driverv3 "helm.sh/helm/v3/pkg/storage/driver"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"sigs.k8s.io/yaml"
+)
+
+func testObject(t *testing.T, manifest string) unstructured.Unstructured {
+	obj := map[string]interface{}{}
+	assert.NoError(t, yaml.Unmarshal([]byte(manifest), &obj))
+	return unstructured.Unstructured{Object: obj}
+}
+
+const fluxCertManager = `
+apiVersion: helm.toolkit.fluxcd.io/v2
+kind: HelmRelease
+metadata:
+  name: cert-manager
+  namespace: flux-system
+spec:
+  targetNamespace: cert-manager
+  chart:
+    spec:
+      chart: cert-manager
+      version: ">=1.7.0"
+  values:
+    installCRDs: true
+status:
+  history:
+  - chartVersion: v1.7.1
+  conditions:
+  - type: Ready
+    status: "False"
+    message: "Helm upgrade failed: timed out"
+`
+
+const argoIngress = `
+apiVersion: argoproj.io/v1alpha1
+kind: Application
+metadata:
+  name: ingress
+  namespace: argocd
+spec:
+  destination:
+    namespace: ingress-nginx
+  source:
+    repoURL: https://kubernetes.github.io/ingress-nginx
+    chart: ingress-nginx
+    targetRevision: 4.0.*
+    helm:
+      releaseName: ingress-nginx
+      values: |
+        controller:
+          replicaCount: 2
+          service:
+            type: LoadBalancer
+      valuesObject:
+        controller:
+          replicaCount: 3
+      parameters:
+      - name: controller.image.tag
+        value: "1.2"
+        forceString: true
+status:
+  sync:
+    revision: 4.0.18
+  health:
+    status: Healthy
+`
+
+const argoGitPath = `
+apiVersion: argoproj.io/v1alpha1
+kind: Application
+metadata:
+  name: app
+  namespace: argocd
+spec:
+  destination:
+    namespace: app
+  source:
+    repoURL: https://github.com/example/app
+    path: deploy
+    targetRevision: main
+`
+
+func TestFluxRelease(t *testing.T) {
+	rel, err := fluxRelease(testObject(t, fluxCertManager), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "cert-manager-cert-manager", rel.Name)
+	assert.Equal(t, "cert-manager", rel.Namespace)
+	assert.Equal(t, "cert-manager", rel.Chart.Metadata.Name)
+	assert.Equal(t, "v1.7.1", rel.Chart.Metadata.Version)
+	assert.Equal(t, map[string]interface{}{"installCRDs": true}, rel.Config)
+	assert.Equal(t, release.StatusFailed, rel.Info.Status)
+	assert.Equal(t, "Helm upgrade failed: timed out", rel.Info.Description)
+
+	obj := testObject(t, fluxCertManager)
+	unstructured.RemoveNestedField(obj.Object, "status")
+	assert.NoError(t, unstructured.SetNestedField(obj.Object, "cert-manager", "spec", "releaseName"))
+	_, err = fluxRelease(obj, nil)
+	assert.Error(t, err, "the version is a range and flux has not applied any")
+	assert.NoError(t, unstructured.SetNestedField(obj.Object, "1.7.0", "spec", "chart", "spec", "version"))
+	rel, err = fluxRelease(obj, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "cert-manager", rel.Name)
+	assert.Equal(t, "1.7.0", rel.Chart.Metadata.Version)
+	assert.Equal(t, release.StatusDeployed, rel.Info.Status)
+}
+
+func TestFluxReleaseValuesFrom(t *testing.T) {
+	obj := testObject(t, fluxCertManager)
+	assert.NoError(t, unstructured.SetNestedSlice(obj.Object, []interface{}{
+		map[string]interface{}{"kind": "ConfigMap", "name": "cert-manager-values"},
+		map[string]interface{}{"kind": "Secret", "name": "cert-manager-secrets", "valuesKey": "token", "targetPath": "webhook.token"},
+	}, "spec", "valuesFrom"))
+	configMap := testObject(t, `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: cert-manager-values
+  namespace: flux-system
+data:
+  values.yaml: "replicaCount: 2"
+`)
+	secret := testObject(t, `
+apiVersion: v1
+kind: Secret
+metadata:
+  name: cert-manager-secrets
+  namespace: flux-system
+data:
+  token: aHVudGVyMg==
+`)
+	listKinds := map[schema.GroupVersionResource]string{
+		{Version: "v1", Resource: "configmaps"}: "ConfigMapList",
+		{Version: "v1", Resource: "secrets"}:    "SecretList",
+	}
+
+	tests := []struct {
+		name   string
+		denied bool
+		want   map[string]interface{}
+	}{
+		{
+			name: "values read from the cluster",
+			want: map[string]interface{}{"installCRDs": true, "replicaCount": float64(2), "webhook": map[string]interface{}{"token": "hunter2"}},
+		},
+		{
+			name:   "secrets that can not be read are skipped",
+			denied: true,
+			want:   map[string]interface{}{"installCRDs": true, "replicaCount": float64(2)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), listKinds, &configMap, &secret)
+			if tt.denied {
+				dynamicClient.PrependReactor("list", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+					return true, nil, apierrors.NewForbidden(schema.GroupResource{Resource: "secrets"}, "", nil)
+				})
+			}
+			h := &Helm{Dynamic: &dynamicClientInstance{Client: dynamicClient}}
+			rel, err := fluxRelease(obj, h.clusterLookup())
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, rel.Config)
+		})
+	}
+
+	h := &Helm{Dynamic: &dynamicClientInstance{Client: dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), listKinds)}}
+	_, err := fluxRelease(obj, h.clusterLookup())
+	assert.Error(t, err, "the ConfigMap is not optional")
+}
+
+func TestArgoRelease(t *testing.T) {
+	rel, err := argoRelease(testObject(t, argoIngress))
+	assert.NoError(t, err)
+	assert.Equal(t, "ingress-nginx", rel.Name)
+	assert.Equal(t, "ingress-nginx", rel.Namespace)
+	assert.Equal(t, "ingress-nginx", rel.Chart.Metadata.Name)
+	assert.Equal(t, "4.0.18", rel.Chart.Metadata.Version)
+	assert.Equal(t, release.StatusDeployed, rel.Info.Status)
+	assert.Equal(t, map[string]interface{}{
+		"controller": map[string]interface{}{
+			"replicaCount": float64(3),
+			"service":      map[string]interface{}{"type": "LoadBalancer"},
+			"image":        map[string]interface{}{"tag": "1.2"},
+		},
+	}, rel.Config)
+
+	obj := testObject(t, argoIngress)
+	unstructured.RemoveNestedField(obj.Object, "status")
+	_, err = argoRelease(obj)
+	assert.Error(t, err, "the version is a range and argo cd has not synced")
+
+	rel, err = argoRelease(testObject(t, argoGitPath))
+	assert.NoError(t, err)
+	assert.Nil(t, rel, "applications of git paths are not releases of a chart")
+}
+
+func TestListRevisionsProviders(t *testing.T) {
+	client := fake.NewSimpleClientset(&v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "cert-manager"}})
+	native := testRelease("cert-manager-cert-manager")
+	native.Namespace = "cert-manager"
+	assert.NoError(t, driverv3.NewSecrets(client.CoreV1().Secrets("cert-manager")).Create("sh.helm.release.v1.cert-manager-cert-manager.v1", native))
+
+	flux := testObject(t, fluxCertManager)
+	argo := testObject(t, argoIngress)
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{
+			fluxHelmReleases[0]: "HelmReleaseList",
+			fluxHelmReleases[1]: "HelmReleaseList",
+			fluxHelmReleases[2]: "HelmReleaseList",
+			argoApplications:    "ApplicationList",
+		}, &flux, &argo)
+
+	tests := []struct {
+		name      string
+		providers []string
+		want      map[string]string
+	}{
+		{name: "helm storage by default", want: map[string]string{"cert-manager/cert-manager-cert-manager": ProviderHelm}},
+		{name: "every provider", providers: AllProviders(), want: map[string]string{
+			"cert-manager/cert-manager-cert-manager": ProviderHelm,
+			"ingress-nginx/ingress-nginx":            ProviderArgoCD,
+		}},
+		{name: "flux without helm storage", providers: []string{ProviderFlux}, want: map[string]string{"cert-manager/cert-manager-cert-manager": ProviderFlux}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &Helm{Kube: &kube{Client: client}, Dynamic: &dynamicClientInstance{Client: dynamicClient}, Providers: tt.providers}
+			assert.NoError(t, h.GetReleasesVersionThree())
+			got := map[string]string{}
+			for _, r := range h.Releases {
+				got[releaseKey(r)] = h.ProviderOf(r.Namespace, r.Name)
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -19,10 +19,10 @@ import (
 	"encoding/json"
 	"fmt"
 
+	"github.com/thoas/go-funk"
 	"helm.sh/helm/v3/pkg/release"
 	"helm.sh/helm/v3/pkg/releaseutil"
 	helmstoragev3 "helm.sh/helm/v3/pkg/storage"
-	driverv3 "helm.sh/helm/v3/pkg/storage/driver"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
@@ -36,53 +36,183 @@ type Helm struct {
 	Releases []*release.Release
 	Kube     *kube
 	Dynamic  *dynamicClientInstance
+	// Driver is the helm storage driver to read releases from, one of the Driver constants or the names helm
+	// accepts in HELM_DRIVER. Secrets are read when it is empty.
+	Driver string
+	// SQLConnectionString is the connection string for the sql driver, HELM_DRIVER_SQL_CONNECTION_STRING is used when it is empty
+	SQLConnectionString string
+	// Namespaces limits releases and cluster objects to these namespaces. Namespaces are not listed when it is set,
+	// so only permission to read in these namespaces is needed.
+	Namespaces []string
+	// NamespaceSelector limits releases and cluster objects to the namespaces that match this label selector
+	NamespaceSelector string
+	// ReleaseNames limits releases to these names, or namespace/name
+	ReleaseNames []string
+	// Providers are where releases are discovered from, any of the Provider constants. Only helm storage is read when it is empty.
+	Providers []string
+
+	// offline is set by NewOfflineHelm, releases and cluster facts are then given instead of read from a cluster
+	offline     bool
+	revisions   []*release.Release
+	kubeVersion *version.Info
+	apiVersions []string
+	objects     map[string][]unstructured.Unstructured
+
+	// files holds the file releases read from a repository were declared in, keyed by namespace/name
+	files map[string]string
+	// discovered holds the provider of the releases not read from helm storage, keyed by namespace/name
+	discovered map[string]string
+	// history holds every revision of the releases, keyed by namespace/name
+	history map[string][]*release.Release
+	// scopedNamespaces caches the namespaces in scope once they are resolved
+	scopedNamespaces []string
+	scopeResolved    bool
 }
 
-// NewHelm returns a basic helm struct
-func NewHelm() *Helm {
-	return &Helm{
-		Kube:    getKubeInstance(),
-		Dynamic: getDynamicInstance(),
+// GetReleasesVersionThree retrieves the latest revision of the helm 3 releases in the namespaces in scope from the
+// storage driver set in Driver, keeping those selected by ReleaseNames. Releases that failed or are stuck in a
+// pending state are included, uninstalled releases are not.
+func (h *Helm) GetReleasesVersionThree() error {
+	releases, err := h.ListRevisions()
+	if err != nil {
+		return err
+	}
+
+	h.history = map[string][]*release.Release{}
+	for _, r := range releaseutil.All(installed, h.selectedRelease).Filter(latestRevisions(releases)) {
+		rel, err := helmToRelease(r)
+		if err != nil {
+			return fmt.Errorf("error converting helm r '%s/%s' to internal object\n   %w", r.Namespace, r.Name, err)
+		}
+		h.Releases = append(h.Releases, rel)
+		h.history[releaseKey(r)] = nil
 	}
+
+	for _, r := range releases {
+		key := releaseKey(r)
+		if _, ok := h.history[key]; !ok {
+			continue
+		}
+		rel, err := helmToRelease(r)
+		if err != nil {
+			return fmt.Errorf("error converting helm r '%s/%s' revision %d to internal object\n   %w", r.Namespace, r.Name, r.Version, err)
+		}
+		h.history[key] = append(h.history[key], rel)
+	}
+	for _, revisions := range h.history {
+		releaseutil.SortByRevision(revisions)
+	}
+	return nil
 }
 
-// GetReleasesVersionThree retrieves helm 3 releases from Secrets
-func (h *Helm) GetReleasesVersionThree() error {
-	hs := driverv3.NewSecrets(h.Kube.Client.CoreV1().Secrets(""))
-	helmClient := helmstoragev3.Init(hs)
-	namespaces := h.GetNamespaces()
+// ListReleases reads the releases like GetReleasesVersionThree and returns them
+func (h *Helm) ListReleases() ([]*release.Release, error) {
+	h.Releases = nil
+	if err := h.GetReleasesVersionThree(); err != nil {
+		return nil, err
+	}
+	return h.Releases, nil
+}
 
-	releases, err := helmClient.ListDeployed()
+// ListRevisions returns every revision of the releases in the namespaces in scope from the storage driver set in
+// Driver and the other Providers, or of the releases given when offline
+func (h *Helm) ListRevisions() ([]*release.Release, error) {
+	namespaces, err := h.ScopedNamespaces()
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if h.offline {
+		return releaseutil.All(func(r *release.Release) bool {
+			return namespaces == nil || funk.ContainsString(namespaces, r.Namespace)
+		}).Filter(h.revisions), nil
+	}
+	scopes := namespaces
+	if scopes == nil {
+		scopes = []string{metav1.NamespaceAll}
+	}
+
+	var releases []*release.Release
+	if h.useProvider(ProviderHelm) {
+		releases, err = h.listStorage(scopes)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if h.useProvider(ProviderFlux) || h.useProvider(ProviderArgoCD) {
+		discovered, err := h.discoverGitOps(scopes, releases)
+		if err != nil {
+			return nil, err
+		}
+		releases = append(releases, discovered...)
+	}
+	return releases, nil
+}
+
+// listStorage returns every revision of the releases in helm storage in the namespaces in scope
+func (h *Helm) listStorage(scopes []string) ([]*release.Release, error) {
+	names, reason, err := h.driverNames(scopes)
+	if err != nil {
+		return nil, err
+	}
+	if h.Driver == DriverAuto {
+		klog.Info(reason)
+	} else {
+		klog.V(3).Info(reason)
 	}
-	for _, namespace := range namespaces.Items {
-		ns := namespace.Name
 
-		filteredReleases := h.deployedReleasesPerNamespace(ns, releases)
-		for _, r := range filteredReleases {
-			rel, err := helmToRelease(r)
+	var releases []*release.Release
+	for _, name := range names {
+		for _, ns := range scopes {
+			d, err := h.newDriver(name, ns)
+			if err != nil {
+				return nil, err
+			}
+			all, err := helmstoragev3.Init(d).ListReleases()
 			if err != nil {
-				return fmt.Errorf("error converting helm r '%s/%s' to internal object\n   %w", r.Namespace, r.Name, err)
+				return nil, fmt.Errorf("unable to list helm releases from %s%s: %w", d.Name(), inNamespace(ns), err)
 			}
-			h.Releases = append(h.Releases, rel)
+			releases = append(releases, all...)
 		}
 	}
-	return nil
+	if len(releases) == 0 {
+		h.warnOtherDriver(scopes)
+	}
+	return releases, nil
+}
+
+// History returns every revision of a release found by GetReleasesVersionThree, oldest first
+func (h *Helm) History(namespace, name string) []*release.Release {
+	return h.history[namespace+"/"+name]
 }
 
-func (h *Helm) deployedReleasesPerNamespace(namespace string, releases []*release.Release) []*release.Release {
-	return releaseutil.All(deployed, relNamespace(namespace)).Filter(releases)
+func releaseKey(rls *release.Release) string {
+	return rls.Namespace + "/" + rls.Name
 }
 
-func deployed(rls *release.Release) bool {
-	return rls.Info.Status == release.StatusDeployed
+// installed reports whether a release has not been uninstalled
+func installed(rls *release.Release) bool {
+	return rls.Info != nil && rls.Info.Status != release.StatusUninstalled
 }
 
-func relNamespace(ns string) releaseutil.FilterFunc {
-	return func(rls *release.Release) bool {
-		return rls.Namespace == ns
+// latestRevisions returns the latest revision of each release
+func latestRevisions(releases []*release.Release) []*release.Release {
+	latest := map[string]*release.Release{}
+	var keys []string
+	for _, r := range releases {
+		key := releaseKey(r)
+		l, ok := latest[key]
+		if !ok {
+			keys = append(keys, key)
+		}
+		if !ok || r.Version > l.Version {
+			latest[key] = r
+		}
+	}
+	result := make([]*release.Release, 0, len(keys))
+	for _, key := range keys {
+		result = append(result, latest[key])
 	}
+	return result
 }
 
 func helmToRelease(helmRelease interface{}) (*release.Release, error) {
@@ -100,17 +230,20 @@ func marshalToRelease(jsonRel []byte) (*release.Release, error) {
 	return ret, err
 }
 
-// GetNamespaces retrieves a list of namespaces for a cluster
-func (h *Helm) GetNamespaces() *v1.NamespaceList {
-	ns, err := h.Kube.Client.CoreV1().Namespaces().List(context.TODO(), metav1.ListOptions{})
+// GetNamespaces retrieves the namespaces of a cluster that match a label selector, or every namespace when it is empty
+func (h *Helm) GetNamespaces(selector string) (*v1.NamespaceList, error) {
+	ns, err := h.Kube.Client.CoreV1().Namespaces().List(context.TODO(), metav1.ListOptions{LabelSelector: selector})
 	if err != nil {
-		klog.Error(err)
+		return nil, fmt.Errorf("unable to list namespaces: %w", err)
 	}
-	return ns
+	return ns, nil
 }
 
 // GetClusterObjects returns a list of unstructured.Unstructured objects
 func (h *Helm) GetClusterObjects(group string, version string, resource string, namespace string) ([]unstructured.Unstructured, error) {
+	if h.offline {
+		return h.snapshotObjects(schema.GroupVersionResource{Group: group, Version: version, Resource: resource}, namespace)
+	}
 	resourceId := schema.GroupVersionResource{
 		Group:    group,
 		Version:  version,
@@ -118,16 +251,45 @@ func (h *Helm) GetClusterObjects(group string, version string, resource string,
 	}
 	list, err := h.Dynamic.Client.Resource(resourceId).Namespace(namespace).List(context.TODO(), metav1.ListOptions{})
 	if err != nil {
-		klog.Error(err)
+		return nil, err
 	}
 
 	return list.Items, nil
 }
 
+// GetClusterVersion returns the version of the cluster
 func (h *Helm) GetClusterVersion() (*version.Info, error) {
+	if h.offline {
+		if h.kubeVersion == nil {
+			return nil, fmt.Errorf("no kubernetes version given: %w", ErrNoCluster)
+		}
+		return h.kubeVersion, nil
+	}
 	serverVersion, err := h.Kube.Client.Discovery().ServerVersion()
 	if err != nil {
 		return nil, err
 	}
 	return serverVersion, nil
 }
+
+// GetAPIVersions returns the api group versions served by the cluster
+func (h *Helm) GetAPIVersions() ([]string, error) {
+	if h.offline {
+		if len(h.apiVersions) == 0 {
+			return nil, fmt.Errorf("no api versions given: %w", ErrNoCluster)
+		}
+		return h.apiVersions, nil
+	}
+	groups, err := h.Kube.Client.Discovery().ServerGroups()
+	if err != nil {
+		return nil, err
+	}
+
+	var groupVersions []string
+	for _, g := range groups.Groups {
+		for _, v := range g.Versions {
+			groupVersions = append(groupVersions, v.GroupVersion)
+		}
+	}
+	return groupVersions, nil
+}
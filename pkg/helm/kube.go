@@ -17,16 +17,15 @@ package helm
 import (
 	"context"
 	"fmt"
-	"os"
-	"sync"
+	"sort"
 
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
-	"k8s.io/klog/v2"
 
 	// This is required to auth to cloud providers (i.e. GKE)
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
 	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
 	"sigs.k8s.io/controller-runtime/pkg/client/config"
 
@@ -43,81 +42,86 @@ func (h *kube) GetData(ctx context.Context, group, kind string) ([]interface{},
 	return nil, nil
 }
 
-// getKubeInstance returns a Kubernetes interface
-func getKubeInstance() *kube {
-	var kubeClient *kube
-	once.Do(func() {
-
-		kubeClient = &kube{
-			Client: getKubeClient(),
-		}
-
-	})
-	return kubeClient
-}
-
 type dynamicClientInstance struct {
 	Client     dynamic.Interface
 	RESTMapper meta.RESTMapper
 }
 
-var once sync.Once
-var clientOnceDynamic sync.Once
-
-// getKubeClient returns a clientset instance
-func getKubeClient() *kubernetes.Clientset {
+// NewHelm returns a basic helm struct for the cluster of the current kubeconfig context
+func NewHelm() (*Helm, error) {
 	kubeConf, err := config.GetConfig()
 	if err != nil {
-		fmt.Println("Error getting kubeconfig:", err)
-		os.Exit(1)
+		return nil, fmt.Errorf("error getting kubeconfig: %w", err)
 	}
+	return NewHelmForConfig(kubeConf)
+}
+
+// NewHelmForConfig returns a helm struct for the cluster of a rest config
+func NewHelmForConfig(kubeConf *rest.Config) (*Helm, error) {
 	clientset, err := kubernetes.NewForConfig(kubeConf)
 	if err != nil {
-		fmt.Println("Error creating kubernetes client:", err)
-		os.Exit(1)
+		return nil, fmt.Errorf("error creating kubernetes client: %w", err)
+	}
+	dynamicClient, err := dynamic.NewForConfig(kubeConf)
+	if err != nil {
+		return nil, fmt.Errorf("error creating dynamic kubernetes client: %w", err)
+	}
+	httpClient, err := rest.HTTPClientFor(kubeConf)
+	if err != nil {
+		return nil, fmt.Errorf("error creating httpClient using kubeconfig: %w", err)
+	}
+	restmapper, err := apiutil.NewDynamicRESTMapper(kubeConf, httpClient)
+	if err != nil {
+		return nil, fmt.Errorf("error creating REST Mapper: %w", err)
 	}
-	return clientset
+	h := NewHelmForClients(clientset, dynamicClient)
+	h.Dynamic.RESTMapper = restmapper
+	return h, nil
 }
 
-// GetDynamicInstance returns a dynamic client instance
-func getDynamicInstance() *dynamicClientInstance {
-	var dynamicClient *dynamicClientInstance
-	clientOnceDynamic.Do(func() {
+// NewHelmForClients returns a helm struct that reads the cluster with the given clients, such as fake clients in tests
+func NewHelmForClients(client kubernetes.Interface, dynamicClient dynamic.Interface) *Helm {
+	return &Helm{
+		Kube:    &kube{Client: client},
+		Dynamic: &dynamicClientInstance{Client: dynamicClient},
+	}
+}
 
-		dynamicClient = &dynamicClientInstance{
-			Client:     getKubeClientDynamic(),
-			RESTMapper: getRESTMapper(),
-		}
-	})
-	return dynamicClient
+// CurrentNamespace returns the namespace of the current kubeconfig context, or default when the context has none
+func CurrentNamespace() (string, error) {
+	loader := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(clientcmd.NewDefaultClientConfigLoadingRules(), &clientcmd.ConfigOverrides{})
+	ns, _, err := loader.Namespace()
+	return ns, err
 }
 
-func getKubeClientDynamic() dynamic.Interface {
-	kubeConf, err := config.GetConfig()
+// NewHelmForContext returns a helm struct for the cluster of a kubeconfig context. The kubeconfig file is read from
+// kubeconfig, or from KUBECONFIG and the default location when it is empty.
+func NewHelmForContext(kubeconfig, context string) (*Helm, error) {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = kubeconfig
+	kubeConf, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, &clientcmd.ConfigOverrides{CurrentContext: context}).ClientConfig()
 	if err != nil {
-		klog.Fatalf("Error getting kubeconfig: %v", err)
+		return nil, fmt.Errorf("unable to load context %s: %w", context, err)
 	}
-	clientset, err := dynamic.NewForConfig(kubeConf)
+	h, err := NewHelmForConfig(kubeConf)
 	if err != nil {
-		klog.Fatalf("Error creating dynamic kubernetes client: %v", err)
+		return nil, fmt.Errorf("context %s: %w", context, err)
 	}
-	return clientset
+	return h, nil
 }
 
-func getRESTMapper() meta.RESTMapper {
-	kubeConf, err := config.GetConfig()
+// KubeContexts returns the names of the contexts in a kubeconfig file, read like with NewHelmForContext
+func KubeContexts(kubeconfig string) ([]string, error) {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = kubeconfig
+	conf, err := rules.Load()
 	if err != nil {
-		klog.Fatalf("Error getting kubeconfig: %v", err)
+		return nil, fmt.Errorf("unable to read kubeconfig: %w", err)
 	}
-
-	httpClient, err := rest.HTTPClientFor(kubeConf)
-	if err != nil {
-		klog.Fatal("error creating httpClient using kubeconfig: %s", err.Error())
-	}
-
-	restmapper, err := apiutil.NewDynamicRESTMapper(kubeConf, httpClient)
-	if err != nil {
-		klog.Fatalf("Error creating REST Mapper: %v", err)
+	contexts := make([]string, 0, len(conf.Contexts))
+	for name := range conf.Contexts {
+		contexts = append(contexts, name)
 	}
-	return restmapper
+	sort.Strings(contexts)
+	return contexts, nil
 }
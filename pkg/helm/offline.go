@@ -0,0 +1,70 @@
+// Copyright 2021 FairwindsOps, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package helm
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/Masterminds/semver/v3"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/release"
+	"k8s.io/apimachinery/pkg/version"
+)
+
+// ErrNoCluster is returned for what can only be read from a cluster when running offline
+var ErrNoCluster = errors.New("not connected to a cluster")
+
+// NewOfflineHelm returns a Helm without kube clients. Its releases are the ones given instead of those read from
+// a cluster, and the cluster version and api versions are the declared ones. ErrNoCluster is returned when they
+// are empty, and for cluster objects.
+func NewOfflineHelm(releases []*release.Release, kubeVersion string, apiVersions []string) (*Helm, error) {
+	h := &Helm{
+		offline:     true,
+		revisions:   releases,
+		apiVersions: apiVersions,
+	}
+	if kubeVersion != "" {
+		v, err := semver.NewVersion(kubeVersion)
+		if err != nil {
+			return nil, fmt.Errorf("invalid kubernetes version %s: %w", kubeVersion, err)
+		}
+		h.kubeVersion = &version.Info{
+			Major:      strconv.FormatUint(v.Major(), 10),
+			Minor:      strconv.FormatUint(v.Minor(), 10),
+			GitVersion: "v" + v.String(),
+		}
+	}
+	return h, nil
+}
+
+// NewOfflineRelease returns a deployed release of a chart with the user supplied values and the manifests it renders to
+func NewOfflineRelease(name, namespace string, metadata *chart.Metadata, values map[string]interface{}, manifest string) *release.Release {
+	return &release.Release{
+		Name:      name,
+		Namespace: namespace,
+		Version:   1,
+		Info:      &release.Info{Status: release.StatusDeployed, Description: "Offline release"},
+		Chart:     &chart.Chart{Metadata: metadata},
+		Config:    values,
+		Manifest:  manifest,
+	}
+}
+
+// IsOffline reports whether the Helm reads from a cluster
+func (h *Helm) IsOffline() bool {
+	return h.offline
+}
@@ -0,0 +1,59 @@
+// Copyright 2021 FairwindsOps, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package helm
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/release"
+)
+
+func TestNewOfflineHelm(t *testing.T) {
+	releases := []*release.Release{
+		NewOfflineRelease("a", "default", &chart.Metadata{Name: "a", Version: "1.0.0"}, nil, ""),
+		NewOfflineRelease("b", "team", &chart.Metadata{Name: "b", Version: "1.0.0"}, nil, ""),
+	}
+
+	h, err := NewOfflineHelm(releases, "1.27.3", []string{"apps/v1"})
+	assert.NoError(t, err)
+	assert.True(t, h.IsOffline())
+	h.ReleaseNames = []string{"team/b"}
+	assert.NoError(t, h.GetReleasesVersionThree())
+	assert.Len(t, h.Releases, 1)
+	assert.Equal(t, "b", h.Releases[0].Name)
+
+	v, err := h.GetClusterVersion()
+	assert.NoError(t, err)
+	assert.Equal(t, "v1.27.3", v.String())
+	assert.Equal(t, "27", v.Minor)
+	apiVersions, err := h.GetAPIVersions()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"apps/v1"}, apiVersions)
+	_, err = h.GetClusterObjects("apps", "v1", "deployments", "")
+	assert.True(t, errors.Is(err, ErrNoCluster))
+
+	h, err = NewOfflineHelm(releases, "", nil)
+	assert.NoError(t, err)
+	_, err = h.GetClusterVersion()
+	assert.True(t, errors.Is(err, ErrNoCluster))
+	_, err = h.GetAPIVersions()
+	assert.True(t, errors.Is(err, ErrNoCluster))
+
+	_, err = NewOfflineHelm(releases, "latest", nil)
+	assert.Error(t, err)
+}
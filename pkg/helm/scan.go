@@ -0,0 +1,430 @@
+// Copyright 2021 FairwindsOps, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package helm
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/repo"
+	"helm.sh/helm/v3/pkg/strvals"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/klog"
+	"sigs.k8s.io/yaml"
+)
+
+// Providers of releases declared in a repository, besides Flux and Argo CD
+const (
+	ProviderHelmfile = "helmfile" // releases in a helmfile.yaml
+	ProviderChart    = "chart"    // dependencies in a Chart.yaml
+)
+
+// NewRepoHelm returns an offline Helm whose releases are those declared in the Flux HelmRelease, Argo CD Application,
+// helmfile.yaml and Chart.yaml files in a directory. Chart version constraints are resolved against the index of
+// the helm repository of the chart. The cluster version and api versions are the declared ones like with NewOfflineHelm.
+func NewRepoHelm(dir, kubeVersion string, apiVersions []string) (*Helm, error) {
+	h, err := NewOfflineHelm(nil, kubeVersion, apiVersions)
+	if err != nil {
+		return nil, err
+	}
+	s := &repoScanner{objects: map[string]unstructured.Unstructured{}, indexes: map[string]*repo.IndexFile{}}
+	if err := s.scan(dir); err != nil {
+		return nil, err
+	}
+
+	h.discovered = map[string]string{}
+	h.files = map[string]string{}
+	for _, d := range s.declarations {
+		if err := s.resolve(d.declaration); err != nil {
+			klog.Warningf("ignoring release %s in %s: %v", d.name, d.file, err)
+			continue
+		}
+		rel, err := d.release()
+		if err != nil {
+			klog.Warningf("ignoring release %s in %s: %v", d.name, d.file, err)
+			continue
+		}
+		key := releaseKey(rel)
+		if other, ok := h.files[key]; ok {
+			klog.Warningf("ignoring release %s in %s, it is also declared in %s", key, d.file, other)
+			continue
+		}
+		h.discovered[key] = d.provider
+		h.files[key] = d.file
+		h.revisions = append(h.revisions, rel)
+	}
+	klog.Infof("found %d releases declared in %s", len(h.revisions), dir)
+	return h, nil
+}
+
+// FileOf returns the file a release was declared in, when it was read from a repository
+func (h *Helm) FileOf(namespace, name string) string {
+	return h.files[namespace+"/"+name]
+}
+
+// repoScanner finds the releases declared in the files of a repository
+type repoScanner struct {
+	declarations []fileDeclaration
+	// objects are the kubernetes objects in the repository keyed by kind/namespace/name, to look up references
+	objects map[string]unstructured.Unstructured
+	indexes map[string]*repo.IndexFile
+}
+
+// fileDeclaration is a release declared in a file
+type fileDeclaration struct {
+	*declaration
+	file     string
+	provider string
+}
+
+// scan reads every yaml file in dir
+func (s *repoScanner) scan(dir string) error {
+	var flux, argo []fileObject
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			// chart templates are not yaml and vendored subcharts are read from the dependencies of their parent
+			if path != dir && (d.Name() == ".git" || d.Name() == "templates" || (d.Name() == "charts" && isChartDir(filepath.Dir(path)))) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		ext := filepath.Ext(path)
+		if ext != ".yaml" && ext != ".yml" {
+			return nil
+		}
+
+		switch {
+		case d.Name() == "Chart.yaml":
+			return s.scanChart(path)
+		case strings.HasPrefix(d.Name(), "helmfile.") || filepath.Base(filepath.Dir(path)) == "helmfile.d":
+			return s.scanHelmfile(path)
+		}
+
+		objs, err := readObjects(path)
+		if err != nil {
+			klog.V(3).Infof("skipping %s: %v", path, err)
+			return nil
+		}
+		for _, obj := range objs {
+			s.objects[objectKey(obj.GetKind(), obj.GetNamespace(), obj.GetName())] = obj
+			group := strings.Split(obj.GetAPIVersion(), "/")[0]
+			switch {
+			case obj.GetKind() == "HelmRelease" && group == fluxHelmReleases[0].Group:
+				flux = append(flux, fileObject{obj, path})
+			case obj.GetKind() == "Application" && group == argoApplications.Group:
+				argo = append(argo, fileObject{obj, path})
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("unable to scan %s: %w", dir, err)
+	}
+
+	for _, o := range flux {
+		if o.obj.GetNamespace() == "" {
+			o.obj.SetNamespace("default")
+		}
+		d, err := fluxDeclaration(o.obj, s.lookup)
+		if err != nil {
+			klog.Warningf("ignoring HelmRelease %s in %s: %v", o.obj.GetName(), o.file, err)
+			continue
+		}
+		s.declarations = append(s.declarations, fileDeclaration{d, o.file, ProviderFlux})
+	}
+	for _, o := range argo {
+		d, err := argoDeclaration(o.obj)
+		if err != nil {
+			klog.Warningf("ignoring Application %s in %s: %v", o.obj.GetName(), o.file, err)
+			continue
+		}
+		if d != nil {
+			s.declarations = append(s.declarations, fileDeclaration{d, o.file, ProviderArgoCD})
+		}
+	}
+	return nil
+}
+
+// fileObject is a kubernetes object read from a file
+type fileObject struct {
+	obj  unstructured.Unstructured
+	file string
+}
+
+func objectKey(kind, namespace, name string) string {
+	return kind + "/" + namespace + "/" + name
+}
+
+// lookup finds an object of the repository, objects without a namespace match any namespace
+func (s *repoScanner) lookup(kind, namespace, name string) (unstructured.Unstructured, bool, error) {
+	if obj, ok := s.objects[objectKey(kind, namespace, name)]; ok {
+		return obj, true, nil
+	}
+	obj, ok := s.objects[objectKey(kind, "", name)]
+	return obj, ok, nil
+}
+
+// readObjects reads the kubernetes objects in a yaml file with several documents
+func readObjects(path string) ([]unstructured.Unstructured, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var objs []unstructured.Unstructured
+	dec := utilyaml.NewYAMLOrJSONDecoder(f, 4096)
+	for {
+		var obj map[string]interface{}
+		err := dec.Decode(&obj)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		u := unstructured.Unstructured{Object: obj}
+		if obj != nil && u.GetKind() != "" && u.GetName() != "" {
+			objs = append(objs, u)
+		}
+	}
+	return objs, nil
+}
+
+// helmfile is the part of a helmfile.yaml that declares releases
+type helmfile struct {
+	Repositories []struct {
+		Name string `json:"name"`
+		URL  string `json:"url"`
+		OCI  bool   `json:"oci"`
+	} `json:"repositories"`
+	Releases []struct {
+		Name      string        `json:"name"`
+		Namespace string        `json:"namespace"`
+		Chart     string        `json:"chart"`
+		Version   string        `json:"version"`
+		Installed *bool         `json:"installed"`
+		Values    []interface{} `json:"values"`
+		Set       []struct {
+			Name  string      `json:"name"`
+			Value interface{} `json:"value"`
+		} `json:"set"`
+	} `json:"releases"`
+}
+
+// scanHelmfile reads the releases of a helmfile. Values files are read relative to the helmfile, templated
+// helmfiles and values files are not supported.
+func (s *repoScanner) scanHelmfile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var hf helmfile
+	for _, doc := range strings.Split(string(data), "\n---") {
+		var part helmfile
+		if err := yaml.Unmarshal([]byte(doc), &part); err != nil {
+			klog.Warningf("skipping %s, only helmfiles without templates are supported: %v", path, err)
+			return nil
+		}
+		hf.Repositories = append(hf.Repositories, part.Repositories...)
+		hf.Releases = append(hf.Releases, part.Releases...)
+	}
+
+	repos := map[string]string{}
+	for _, r := range hf.Repositories {
+		url := r.URL
+		if r.OCI {
+			url = "oci://" + strings.TrimPrefix(url, "oci://")
+		}
+		repos[r.Name] = url
+	}
+
+	dir := filepath.Dir(path)
+	for _, r := range hf.Releases {
+		if r.Installed != nil && !*r.Installed {
+			continue
+		}
+		d := &declaration{
+			name:        r.Name,
+			namespace:   r.Namespace,
+			version:     r.Version,
+			status:      release.StatusDeployed,
+			description: "Declared in helmfile",
+		}
+		if d.namespace == "" {
+			d.namespace = "default"
+		}
+
+		if local := filepath.Join(dir, r.Chart); isChartDir(local) {
+			c, err := chartutil.LoadChartfile(filepath.Join(local, "Chart.yaml"))
+			if err != nil {
+				klog.Warningf("ignoring release %s in %s: %v", r.Name, path, err)
+				continue
+			}
+			d.chart, d.version = c.Name, c.Version
+		} else if parts := strings.SplitN(r.Chart, "/", 2); len(parts) == 2 && repos[parts[0]] != "" {
+			d.repository, d.chart = repos[parts[0]], parts[1]
+		} else {
+			d.chart = r.Chart[strings.LastIndex(r.Chart, "/")+1:]
+		}
+
+		values := map[string]interface{}{}
+		for _, v := range r.Values {
+			var vals map[string]interface{}
+			switch val := v.(type) {
+			case string:
+				if strings.HasSuffix(val, ".gotmpl") {
+					klog.Warningf("values file %s of release %s in %s is a template and is not read", val, r.Name, path)
+					continue
+				}
+				vals, err = chartutil.ReadValuesFile(filepath.Join(dir, val))
+				if err != nil {
+					klog.Warningf("unable to read values of release %s in %s: %v", r.Name, path, err)
+					continue
+				}
+			case map[string]interface{}:
+				vals = val
+			}
+			values = chartutil.CoalesceTables(vals, values)
+		}
+		for _, set := range r.Set {
+			if err := strvals.ParseInto(fmt.Sprintf("%s=%v", set.Name, set.Value), values); err != nil {
+				klog.Warningf("ignoring set %s of release %s in %s: %v", set.Name, r.Name, path, err)
+			}
+		}
+		d.values = values
+		s.declarations = append(s.declarations, fileDeclaration{d, path, ProviderHelmfile})
+	}
+	return nil
+}
+
+// scanChart reads the dependencies of a Chart.yaml. The versions are taken from the Chart.lock when there is one,
+// the values from the values.yaml of the chart, and dependencies disabled by their condition are left out.
+func (s *repoScanner) scanChart(path string) error {
+	c, err := chartutil.LoadChartfile(path)
+	if err != nil {
+		klog.Warningf("skipping %s: %v", path, err)
+		return nil
+	}
+	if len(c.Dependencies) == 0 {
+		return nil
+	}
+	dir := filepath.Dir(path)
+
+	locked := map[string]string{}
+	if data, err := os.ReadFile(filepath.Join(dir, "Chart.lock")); err == nil {
+		var lock chart.Lock
+		if err := yaml.Unmarshal(data, &lock); err == nil {
+			for _, dep := range lock.Dependencies {
+				locked[dep.Name] = dep.Version
+			}
+		}
+	}
+	parentValues, err := chartutil.ReadValuesFile(filepath.Join(dir, "values.yaml"))
+	if err != nil {
+		parentValues = chartutil.Values{}
+	}
+
+	for _, dep := range c.Dependencies {
+		name := dep.Name
+		if dep.Alias != "" {
+			name = dep.Alias
+		}
+		if !dependencyEnabled(dep, parentValues) {
+			klog.V(3).Infof("dependency %s of %s is disabled", name, path)
+			continue
+		}
+
+		d := &declaration{
+			name:        c.Name + "/" + name,
+			chart:       dep.Name,
+			version:     dep.Version,
+			repository:  dep.Repository,
+			status:      release.StatusDeployed,
+			description: "Dependency of chart " + c.Name,
+		}
+		if v, ok := locked[dep.Name]; ok {
+			d.version = v
+		}
+		if strings.HasPrefix(dep.Repository, "file://") {
+			local, err := chartutil.LoadChartfile(filepath.Join(dir, strings.TrimPrefix(dep.Repository, "file://"), "Chart.yaml"))
+			if err != nil {
+				klog.Warningf("ignoring dependency %s of %s: %v", name, path, err)
+				continue
+			}
+			d.version, d.repository = local.Version, ""
+		}
+
+		values := map[string]interface{}{}
+		if sub, err := parentValues.Table(name); err == nil {
+			values = sub.AsMap()
+		}
+		if global, ok := parentValues["global"]; ok {
+			values["global"] = global
+		}
+		d.values = values
+		s.declarations = append(s.declarations, fileDeclaration{d, path, ProviderChart})
+	}
+	return nil
+}
+
+// isChartDir reports whether a directory holds a chart
+func isChartDir(dir string) bool {
+	_, err := os.Stat(filepath.Join(dir, "Chart.yaml"))
+	return err == nil
+}
+
+// resolve replaces the version constraint of a declaration with the highest version that satisfies it in the index
+// of the helm repository of the chart
+func (s *repoScanner) resolve(d *declaration) error {
+	if d.version != "" {
+		if _, err := semver.NewVersion(d.version); err == nil {
+			return nil
+		}
+	}
+	if d.repository == "" || !strings.HasPrefix(d.repository, "http") {
+		return fmt.Errorf("version %q of chart %s is not a version and the helm repository of the chart is not known", d.version, d.chart)
+	}
+
+	index, ok := s.indexes[d.repository]
+	if !ok {
+		var err error
+		index, err = LoadRepositoryIndex(d.repository)
+		if err != nil {
+			return err
+		}
+		s.indexes[d.repository] = index
+	}
+	cv, err := index.Get(d.chart, d.version)
+	if err != nil {
+		return fmt.Errorf("no version of chart %s in %s satisfies %q: %v", d.chart, d.repository, d.version, err)
+	}
+	klog.V(3).Infof("resolved version %q of chart %s to %s", d.version, d.chart, cv.Version)
+	d.version = cv.Version
+	return nil
+}
@@ -0,0 +1,198 @@
+// Copyright 2021 FairwindsOps, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package helm
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testIndex = `
+apiVersion: v1
+entries:
+  cert-manager:
+  - name: cert-manager
+    version: v1.8.0
+  - name: cert-manager
+    version: v1.7.2
+  ingress-nginx:
+  - name: ingress-nginx
+    version: 4.0.6
+  - name: ingress-nginx
+    version: 4.0.1
+`
+
+func writeRepo(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+	return dir
+}
+
+func TestNewRepoHelm(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(testIndex))
+	}))
+	defer server.Close()
+	t.Setenv("HELM_REPOSITORY_CACHE", t.TempDir())
+
+	dir := writeRepo(t, map[string]string{
+		"clusters/prod/cert-manager.yaml": `
+apiVersion: source.toolkit.fluxcd.io/v1beta2
+kind: HelmRepository
+metadata:
+  name: jetstack
+  namespace: flux-system
+spec:
+  url: ` + server.URL + `
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: cert-manager-values
+  namespace: flux-system
+data:
+  values.yaml: |
+    installCRDs: true
+    replicaCount: 1
+---
+apiVersion: helm.toolkit.fluxcd.io/v2
+kind: HelmRelease
+metadata:
+  name: cert-manager
+  namespace: flux-system
+spec:
+  targetNamespace: cert-manager
+  chart:
+    spec:
+      chart: cert-manager
+      version: ">=1.7.0 <1.8.0"
+      sourceRef:
+        kind: HelmRepository
+        name: jetstack
+  valuesFrom:
+  - kind: ConfigMap
+    name: cert-manager-values
+  values:
+    replicaCount: 2
+`,
+		// a repository has no status, so the version is resolved from the target revision
+		"apps/ingress.yaml": strings.Replace(strings.Split(argoIngress, "status:")[0], "https://kubernetes.github.io/ingress-nginx", server.URL, 1),
+		"helmfile.yaml": `
+repositories:
+- name: bitnami
+  url: https://charts.bitnami.com/bitnami
+releases:
+- name: redis
+  namespace: cache
+  chart: bitnami/redis
+  version: 17.0.1
+  values:
+  - values/redis.yaml
+  - architecture: standalone
+  set:
+  - name: auth.enabled
+    value: false
+- name: disabled
+  chart: bitnami/nginx
+  version: 1.0.0
+  installed: false
+`,
+		"values/redis.yaml": "architecture: replication\nreplica:\n  replicaCount: 3\n",
+		"umbrella/Chart.yaml": `
+apiVersion: v2
+name: platform
+version: 0.1.0
+dependencies:
+- name: ingress-nginx
+  alias: ingress
+  version: 4.0.*
+  repository: ` + server.URL + `
+- name: cert-manager
+  version: "~1.7"
+  repository: ` + server.URL + `
+  condition: certManager.enabled
+`,
+		"umbrella/Chart.lock": `
+dependencies:
+- name: ingress-nginx
+  version: 4.0.1
+  repository: ` + server.URL + `
+`,
+		"umbrella/values.yaml": `
+global:
+  domain: example.com
+ingress:
+  controller:
+    replicaCount: 3
+certManager:
+  enabled: false
+`,
+		"umbrella/templates/deployment.yaml": "{{ .Values.broken }",
+		"README.md":                          "not yaml",
+	})
+
+	h, err := NewRepoHelm(dir, "1.25.0", nil)
+	require.NoError(t, err)
+	assert.NoError(t, h.GetReleasesVersionThree())
+
+	got := map[string]string{}
+	for _, r := range h.Releases {
+		got[releaseKey(r)] = r.Chart.Metadata.Name + "@" + r.Chart.Metadata.Version
+	}
+	assert.Equal(t, map[string]string{
+		"cert-manager/cert-manager-cert-manager": "cert-manager@v1.7.2",
+		"ingress-nginx/ingress-nginx":            "ingress-nginx@4.0.6",
+		"cache/redis":                            "redis@17.0.1",
+		"/platform/ingress":                      "ingress-nginx@4.0.1",
+	}, got)
+
+	for _, r := range h.Releases {
+		switch releaseKey(r) {
+		case "cert-manager/cert-manager-cert-manager":
+			assert.Equal(t, map[string]interface{}{"installCRDs": true, "replicaCount": float64(2)}, r.Config)
+			assert.Equal(t, ProviderFlux, h.ProviderOf(r.Namespace, r.Name))
+			assert.Equal(t, filepath.Join(dir, "clusters/prod/cert-manager.yaml"), h.FileOf(r.Namespace, r.Name))
+		case "cache/redis":
+			assert.Equal(t, map[string]interface{}{
+				"architecture": "standalone",
+				"replica":      map[string]interface{}{"replicaCount": float64(3)},
+				"auth":         map[string]interface{}{"enabled": false},
+			}, r.Config)
+			assert.Equal(t, ProviderHelmfile, h.ProviderOf(r.Namespace, r.Name))
+			assert.Equal(t, filepath.Join(dir, "helmfile.yaml"), h.FileOf(r.Namespace, r.Name))
+		case "/platform/ingress":
+			assert.Equal(t, map[string]interface{}{
+				"controller": map[string]interface{}{"replicaCount": float64(3)},
+				"global":     map[string]interface{}{"domain": "example.com"},
+			}, r.Config)
+			assert.Equal(t, ProviderChart, h.ProviderOf(r.Namespace, r.Name))
+		}
+	}
+
+	v, err := h.GetClusterVersion()
+	assert.NoError(t, err)
+	assert.Equal(t, "v1.25.0", v.GitVersion)
+}
@@ -0,0 +1,80 @@
+// Copyright 2021 FairwindsOps, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package helm
+
+import (
+	"fmt"
+
+	"helm.sh/helm/v3/pkg/release"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog"
+)
+
+// ScopedNamespaces returns the namespaces that releases and cluster objects are read from, nil means every namespace.
+// They are the namespaces in Namespaces, or the namespaces that match NamespaceSelector.
+func (h *Helm) ScopedNamespaces() ([]string, error) {
+	if h.scopeResolved {
+		return h.scopedNamespaces, nil
+	}
+	if len(h.Namespaces) > 0 {
+		h.scopedNamespaces, h.scopeResolved = h.Namespaces, true
+		return h.scopedNamespaces, nil
+	}
+	if h.NamespaceSelector == "" {
+		h.scopeResolved = true
+		return nil, nil
+	}
+
+	list, err := h.GetNamespaces(h.NamespaceSelector)
+	if err != nil {
+		return nil, err
+	}
+	namespaces := []string{}
+	for _, ns := range list.Items {
+		namespaces = append(namespaces, ns.Name)
+	}
+	if len(namespaces) == 0 {
+		klog.Warningf("no namespaces match the selector %s", h.NamespaceSelector)
+	}
+	h.scopedNamespaces, h.scopeResolved = namespaces, true
+	return namespaces, nil
+}
+
+// selectedRelease reports whether a release is selected by ReleaseNames
+func (h *Helm) selectedRelease(rls *release.Release) bool {
+	if len(h.ReleaseNames) == 0 {
+		return true
+	}
+	for _, name := range h.ReleaseNames {
+		if name == rls.Name || name == fmt.Sprintf("%s/%s", rls.Namespace, rls.Name) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsAccessError reports whether an error was caused by missing permissions
+func IsAccessError(err error) bool {
+	return apierrors.IsForbidden(err) || apierrors.IsUnauthorized(err)
+}
+
+// inNamespace describes a namespace for messages, the empty namespace is every namespace
+func inNamespace(namespace string) string {
+	if namespace == metav1.NamespaceAll {
+		return ""
+	}
+	return " in namespace " + namespace
+}
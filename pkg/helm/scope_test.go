@@ -0,0 +1,127 @@
+// Copyright 2021 FairwindsOps, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package helm
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"helm.sh/helm/v3/pkg/release"
+	driverv3 "helm.sh/helm/v3/pkg/storage/driver"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestGetReleasesVersionThreeScope(t *testing.T) {
+	tests := []struct {
+		name       string
+		namespaces []string
+		selector   string
+		releases   []string
+		want       []string
+	}{
+		{name: "every namespace", want: []string{"default/a", "team/b", "other/c"}},
+		{name: "namespaces", namespaces: []string{"team", "other"}, want: []string{"team/b", "other/c"}},
+		{name: "selector", selector: "team=true", want: []string{"team/b"}},
+		{name: "selector without matches", selector: "team=false"},
+		{name: "release names", releases: []string{"a", "other/c", "default/c"}, want: []string{"default/a", "other/c"}},
+		{name: "namespaces and release names", namespaces: []string{"team"}, releases: []string{"a", "b"}, want: []string{"team/b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := fake.NewSimpleClientset(
+				&v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default"}},
+				&v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team", Labels: map[string]string{"team": "true"}}},
+				&v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "other"}},
+			)
+			for ns, name := range map[string]string{"default": "a", "team": "b", "other": "c"} {
+				rls := testRelease(name)
+				rls.Namespace = ns
+				assert.NoError(t, driverv3.NewSecrets(client.CoreV1().Secrets(ns)).Create("sh.helm.release.v1."+name+".v1", rls))
+			}
+
+			h := &Helm{Kube: &kube{Client: client}, Namespaces: tt.namespaces, NamespaceSelector: tt.selector, ReleaseNames: tt.releases}
+			assert.NoError(t, h.GetReleasesVersionThree())
+			var got []string
+			for _, r := range h.Releases {
+				got = append(got, r.Namespace+"/"+r.Name)
+			}
+			assert.ElementsMatch(t, tt.want, got)
+		})
+	}
+}
+
+func TestScopedNamespacesForbidden(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	client.PrependReactor("list", "namespaces", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewForbidden(schema.GroupResource{Resource: "namespaces"}, "", nil)
+	})
+
+	h := &Helm{Kube: &kube{Client: client}, NamespaceSelector: "team=true"}
+	_, err := h.ScopedNamespaces()
+	assert.Error(t, err)
+	assert.True(t, IsAccessError(err))
+
+	h = &Helm{Kube: &kube{Client: client}, Namespaces: []string{"team"}}
+	got, err := h.ScopedNamespaces()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"team"}, got)
+}
+
+func TestGetReleasesVersionThreeStatuses(t *testing.T) {
+	client := fake.NewSimpleClientset(&v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default"}})
+	secrets := driverv3.NewSecrets(client.CoreV1().Secrets("default"))
+	revisions := map[string][]release.Status{
+		"deployed":   {release.StatusDeployed},
+		"failed":     {release.StatusSuperseded, release.StatusDeployed, release.StatusFailed},
+		"pending":    {release.StatusDeployed, release.StatusPendingUpgrade},
+		"removed":    {release.StatusUninstalled},
+		"rolledback": {release.StatusSuperseded, release.StatusSuperseded, release.StatusDeployed},
+	}
+	for name, statuses := range revisions {
+		for i, status := range statuses {
+			rls := testRelease(name)
+			rls.Version = i + 1
+			rls.Info.Status = status
+			assert.NoError(t, secrets.Create(fmt.Sprintf("sh.helm.release.v1.%s.v%d", name, rls.Version), rls))
+		}
+	}
+
+	h := &Helm{Kube: &kube{Client: client}}
+	assert.NoError(t, h.GetReleasesVersionThree())
+	got := map[string]string{}
+	for _, r := range h.Releases {
+		got[fmt.Sprintf("%s.v%d", r.Name, r.Version)] = r.Info.Status.String()
+	}
+	assert.Equal(t, map[string]string{
+		"deployed.v1":   "deployed",
+		"failed.v3":     "failed",
+		"pending.v2":    "pending-upgrade",
+		"rolledback.v3": "deployed",
+	}, got)
+
+	var history []int
+	for _, r := range h.History("default", "failed") {
+		history = append(history, r.Version)
+	}
+	assert.Equal(t, []int{1, 2, 3}, history)
+	assert.Empty(t, h.History("default", "removed"))
+}
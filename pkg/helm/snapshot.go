@@ -0,0 +1,383 @@
+// Copyright 2021 FairwindsOps, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package helm
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/releaseutil"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/version"
+	"k8s.io/klog"
+	"sigs.k8s.io/yaml"
+)
+
+// Redacted replaces secret data in a redacted snapshot
+const Redacted = "REDACTED"
+
+// lastAppliedAnnotation holds a copy of an object applied with kubectl, including the data of Secrets
+const lastAppliedAnnotation = "kubectl.kubernetes.io/last-applied-configuration"
+
+// secretKeyRegexp matches the value keys that are redacted from release values
+var secretKeyRegexp = regexp.MustCompile(`(?i)(password|passwd|secret|token|api_?key|private_?key|credential|auth)`)
+
+// Snapshot is everything gonogo reads from a cluster, so that checks can be replayed without it
+type Snapshot struct {
+	Metadata    SnapshotMetadata
+	Version     *version.Info
+	APIVersions []string
+	Releases    []*release.Release                     // every revision of the releases
+	Objects     map[string][]unstructured.Unstructured // cluster objects keyed by resource, as group/version/resource or version/resource
+}
+
+// SnapshotMetadata describes how a snapshot was taken
+type SnapshotMetadata struct {
+	Created    time.Time `json:"created"`
+	Namespaces []string  `json:"namespaces,omitempty"` // namespaces in scope, every namespace when empty
+	Redacted   bool      `json:"redacted"`
+	Missing    []string  `json:"missing,omitempty"` // what could not be read, usually for lack of permissions
+	// Providers holds the provider of the releases not read from helm storage, keyed by namespace/name
+	Providers map[string]string `json:"providers,omitempty"`
+}
+
+// Snapshot reads the releases in scope selected by ReleaseNames along with their history, the cluster version,
+// the api versions and the objects of resources. What can not be read for lack of permissions is left out and
+// listed in the metadata. Secret data is redacted when redact is set.
+func (h *Helm) Snapshot(resources []schema.GroupVersionResource, redact bool) (*Snapshot, error) {
+	namespaces, err := h.ScopedNamespaces()
+	if err != nil {
+		return nil, err
+	}
+	s := &Snapshot{
+		Metadata: SnapshotMetadata{Created: time.Now().UTC(), Namespaces: namespaces, Redacted: redact},
+		Objects:  map[string][]unstructured.Unstructured{},
+	}
+
+	revisions, err := h.ListRevisions()
+	if err != nil {
+		return nil, err
+	}
+	selected := map[string]bool{}
+	for _, r := range latestRevisions(revisions) {
+		selected[releaseKey(r)] = h.selectedRelease(r)
+	}
+	s.Releases = releaseutil.All(func(r *release.Release) bool { return selected[releaseKey(r)] }).Filter(revisions)
+	for _, r := range s.Releases {
+		if p := h.ProviderOf(r.Namespace, r.Name); p != ProviderHelm {
+			if s.Metadata.Providers == nil {
+				s.Metadata.Providers = map[string]string{}
+			}
+			s.Metadata.Providers[releaseKey(r)] = p
+		}
+	}
+
+	missing := func(what string, err error) error {
+		if !IsAccessError(err) {
+			return err
+		}
+		klog.Warningf("leaving %s out of the snapshot: %v", what, err)
+		s.Metadata.Missing = append(s.Metadata.Missing, what)
+		return nil
+	}
+
+	s.Version, err = h.GetClusterVersion()
+	if err != nil {
+		if err := missing("version", err); err != nil {
+			return nil, err
+		}
+	}
+	s.APIVersions, err = h.GetAPIVersions()
+	if err != nil {
+		if err := missing("apiVersions", err); err != nil {
+			return nil, err
+		}
+	}
+
+	scopes := namespaces
+	if scopes == nil {
+		scopes = []string{metav1.NamespaceAll}
+	}
+	for _, gvr := range resources {
+		key := resourceKey(gvr)
+		s.Objects[key] = []unstructured.Unstructured{}
+		for _, ns := range scopes {
+			objs, err := h.GetClusterObjects(gvr.Group, gvr.Version, gvr.Resource, ns)
+			if err != nil {
+				if err := missing(key+inNamespace(ns), err); err != nil {
+					return nil, fmt.Errorf("unable to list %s%s: %w", key, inNamespace(ns), err)
+				}
+				continue
+			}
+			s.Objects[key] = append(s.Objects[key], objs...)
+		}
+	}
+
+	if redact {
+		s.redact()
+	}
+	return s, nil
+}
+
+// NewSnapshotHelm returns an offline Helm that replays a snapshot
+func NewSnapshotHelm(s *Snapshot) *Helm {
+	return &Helm{
+		offline:     true,
+		revisions:   s.Releases,
+		kubeVersion: s.Version,
+		apiVersions: s.APIVersions,
+		objects:     s.Objects,
+		discovered:  s.Metadata.Providers,
+	}
+}
+
+// resourceKey returns the form bundles use for a resource, group/version/resource or version/resource for the core group
+func resourceKey(gvr schema.GroupVersionResource) string {
+	if gvr.Group == "" {
+		return gvr.Version + "/" + gvr.Resource
+	}
+	return gvr.Group + "/" + gvr.Version + "/" + gvr.Resource
+}
+
+// snapshotObjects returns the objects of a resource in a namespace from the snapshot being replayed
+func (h *Helm) snapshotObjects(gvr schema.GroupVersionResource, namespace string) ([]unstructured.Unstructured, error) {
+	objs, ok := h.objects[resourceKey(gvr)]
+	if !ok {
+		return nil, fmt.Errorf("%s is not in the snapshot: %w", resourceKey(gvr), ErrNoCluster)
+	}
+	if namespace == metav1.NamespaceAll {
+		return objs, nil
+	}
+	var result []unstructured.Unstructured
+	for _, o := range objs {
+		if o.GetNamespace() == namespace {
+			result = append(result, o)
+		}
+	}
+	return result, nil
+}
+
+// redact replaces the data of Secrets in the release manifests and the cluster objects, and the release values
+// whose keys look like they hold secrets
+func (s *Snapshot) redact() {
+	for _, r := range s.Releases {
+		r.Manifest = redactManifest(r.Manifest)
+		for _, hook := range r.Hooks {
+			hook.Manifest = redactManifest(hook.Manifest)
+		}
+		redactValues(r.Config)
+		if r.Chart != nil {
+			redactValues(r.Chart.Values)
+		}
+	}
+	for _, objs := range s.Objects {
+		for _, o := range objs {
+			redactObject(o.Object)
+		}
+	}
+}
+
+// redactManifest redacts the Secrets in a manifest with several yaml documents
+func redactManifest(manifest string) string {
+	if !strings.Contains(manifest, "Secret") {
+		return manifest
+	}
+	docs := releaseutil.SplitManifests(manifest)
+	keys := make([]string, 0, len(docs))
+	for k := range docs {
+		keys = append(keys, k)
+	}
+	sort.Sort(releaseutil.BySplitManifestsOrder(keys))
+
+	var result []string
+	for _, k := range keys {
+		doc := docs[k]
+		var obj map[string]interface{}
+		if err := yaml.Unmarshal([]byte(doc), &obj); err == nil && redactObject(obj) {
+			if out, err := yaml.Marshal(obj); err == nil {
+				doc = string(out)
+			}
+		}
+		result = append(result, doc)
+	}
+	return strings.Join(result, "\n---\n")
+}
+
+// redactObject redacts the data of a Secret and reports whether it was one
+func redactObject(obj map[string]interface{}) bool {
+	if obj["kind"] != "Secret" {
+		return false
+	}
+	for _, field := range []string{"data", "stringData"} {
+		if data, ok := obj[field].(map[string]interface{}); ok {
+			for k := range data {
+				data[k] = Redacted
+			}
+		}
+	}
+	if metadata, ok := obj["metadata"].(map[string]interface{}); ok {
+		if annotations, ok := metadata["annotations"].(map[string]interface{}); ok {
+			if _, ok := annotations[lastAppliedAnnotation]; ok {
+				annotations[lastAppliedAnnotation] = Redacted
+			}
+		}
+	}
+	return true
+}
+
+// redactValues redacts the values whose keys look like they hold secrets, and every value nested under such keys,
+// in maps and lists alike
+func redactValues(values map[string]interface{}) {
+	for k, v := range values {
+		values[k] = redactValue(v, secretKeyRegexp.MatchString(k))
+	}
+}
+
+// redactValue returns v with its scalars redacted when secret is set, and those under keys that look like they
+// hold secrets otherwise
+func redactValue(v interface{}, secret bool) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for k, item := range val {
+			val[k] = redactValue(item, secret || secretKeyRegexp.MatchString(k))
+		}
+		return val
+	case []interface{}:
+		for i, item := range val {
+			val[i] = redactValue(item, secret)
+		}
+		return val
+	case nil:
+		return nil
+	default:
+		if secret {
+			return Redacted
+		}
+		return v
+	}
+}
+
+// WriteSnapshot writes a snapshot as a gzipped tarball with one json file per release revision and resource
+func WriteSnapshot(w io.Writer, s *Snapshot) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	add := func(name string, v interface{}) error {
+		data, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return fmt.Errorf("unable to encode %s: %w", name, err)
+		}
+		hdr := &tar.Header{Name: name, Mode: 0600, Size: int64(len(data)), ModTime: s.Metadata.Created}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		_, err = tw.Write(data)
+		return err
+	}
+
+	if err := add("metadata.json", s.Metadata); err != nil {
+		return err
+	}
+	if s.Version != nil {
+		if err := add("version.json", s.Version); err != nil {
+			return err
+		}
+	}
+	if s.APIVersions != nil {
+		if err := add("apiversions.json", s.APIVersions); err != nil {
+			return err
+		}
+	}
+	for _, r := range s.Releases {
+		if err := add(fmt.Sprintf("releases/%s/%s.v%d.json", r.Namespace, r.Name, r.Version), r); err != nil {
+			return err
+		}
+	}
+	for key, objs := range s.Objects {
+		if err := add(path.Join("resources", key+".json"), objs); err != nil {
+			return err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// ReadSnapshot reads a snapshot written by WriteSnapshot
+func ReadSnapshot(r io.Reader) (*Snapshot, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read snapshot: %w", err)
+	}
+	tr := tar.NewReader(gz)
+
+	s := &Snapshot{Objects: map[string][]unstructured.Unstructured{}}
+	foundMetadata := false
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to read snapshot: %w", err)
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read %s from snapshot: %w", hdr.Name, err)
+		}
+
+		name := path.Clean(hdr.Name)
+		switch {
+		case name == "metadata.json":
+			foundMetadata = true
+			err = json.Unmarshal(data, &s.Metadata)
+		case name == "version.json":
+			err = json.Unmarshal(data, &s.Version)
+		case name == "apiversions.json":
+			err = json.Unmarshal(data, &s.APIVersions)
+		case strings.HasPrefix(name, "releases/"):
+			rel := &release.Release{}
+			err = json.Unmarshal(data, rel)
+			s.Releases = append(s.Releases, rel)
+		case strings.HasPrefix(name, "resources/"):
+			var objs []unstructured.Unstructured
+			err = json.Unmarshal(data, &objs)
+			s.Objects[strings.TrimSuffix(strings.TrimPrefix(name, "resources/"), ".json")] = objs
+		default:
+			klog.V(3).Infof("ignoring %s in snapshot", hdr.Name)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to decode %s from snapshot: %w", hdr.Name, err)
+		}
+	}
+	if !foundMetadata {
+		return nil, fmt.Errorf("not a gonogo snapshot, metadata.json is missing")
+	}
+	return s, nil
+}
@@ -0,0 +1,154 @@
+// Copyright 2021 FairwindsOps, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package helm
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	driverv3 "helm.sh/helm/v3/pkg/storage/driver"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/version"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const secretManifest = `---
+# Source: app/templates/deployment.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+---
+# Source: app/templates/secret.yaml
+apiVersion: v1
+kind: Secret
+metadata:
+  name: app
+data:
+  password: aHVudGVyMg==
+`
+
+func testSnapshotHelm(t *testing.T) *Helm {
+	client := fake.NewSimpleClientset(&v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default"}})
+	client.Discovery().(*fakediscovery.FakeDiscovery).FakedServerVersion = &version.Info{Major: "1", Minor: "27", GitVersion: "v1.27.3"}
+	client.Resources = []*metav1.APIResourceList{{GroupVersion: "apps/v1"}, {GroupVersion: "v1"}}
+
+	secrets := driverv3.NewSecrets(client.CoreV1().Secrets("default"))
+	for _, name := range []string{"app", "other"} {
+		for revision := 1; revision <= 2; revision++ {
+			rls := testRelease(name)
+			rls.Version = revision
+			rls.Manifest = secretManifest
+			rls.Config = map[string]interface{}{"image": "app:1", "db": map[string]interface{}{"password": "hunter2", "replicas": 2}}
+			assert.NoError(t, secrets.Create(fmt.Sprintf("sh.helm.release.v1.%s.v%d", name, revision), rls))
+		}
+	}
+
+	ingresses := schema.GroupVersionResource{Group: "networking.k8s.io", Version: "v1", Resource: "ingresses"}
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{ingresses: "IngressList"},
+		&unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "networking.k8s.io/v1",
+			"kind":       "Ingress",
+			"metadata":   map[string]interface{}{"name": "web", "namespace": "default"},
+		}},
+		&unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "networking.k8s.io/v1",
+			"kind":       "Ingress",
+			"metadata":   map[string]interface{}{"name": "api", "namespace": "team"},
+		}},
+	)
+	return &Helm{Kube: &kube{Client: client}, Dynamic: &dynamicClientInstance{Client: dynamicClient}, ReleaseNames: []string{"app"}}
+}
+
+func TestSnapshot(t *testing.T) {
+	ingresses := schema.GroupVersionResource{Group: "networking.k8s.io", Version: "v1", Resource: "ingresses"}
+	for _, redact := range []bool{false, true} {
+		s, err := testSnapshotHelm(t).Snapshot([]schema.GroupVersionResource{ingresses}, redact)
+		assert.NoError(t, err)
+
+		var buf bytes.Buffer
+		assert.NoError(t, WriteSnapshot(&buf, s))
+		got, err := ReadSnapshot(&buf)
+		assert.NoError(t, err)
+		assert.Equal(t, redact, got.Metadata.Redacted)
+		assert.Equal(t, "v1.27.3", got.Version.GitVersion)
+		assert.ElementsMatch(t, []string{"apps/v1", "v1"}, got.APIVersions)
+		assert.Len(t, got.Releases, 2, "both revisions of the selected release")
+		assert.Len(t, got.Objects["networking.k8s.io/v1/ingresses"], 2)
+
+		replay := NewSnapshotHelm(got)
+		assert.NoError(t, replay.GetReleasesVersionThree())
+		assert.Len(t, replay.Releases, 1)
+		assert.Equal(t, 2, replay.Releases[0].Version)
+		assert.Len(t, replay.History("default", "app"), 2)
+		objs, err := replay.GetClusterObjects("networking.k8s.io", "v1", "ingresses", "team")
+		assert.NoError(t, err)
+		assert.Len(t, objs, 1)
+		_, err = replay.GetClusterObjects("apps", "v1", "deployments", "")
+		assert.ErrorIs(t, err, ErrNoCluster)
+
+		rel := replay.Releases[0]
+		if redact {
+			assert.NotContains(t, rel.Manifest, "aHVudGVyMg==")
+			assert.Contains(t, rel.Manifest, "kind: Deployment")
+			assert.Equal(t, map[string]interface{}{"password": Redacted, "replicas": float64(2)}, rel.Config["db"])
+			assert.Equal(t, "app:1", rel.Config["image"])
+		} else {
+			assert.Contains(t, rel.Manifest, "aHVudGVyMg==")
+			assert.Equal(t, "hunter2", rel.Config["db"].(map[string]interface{})["password"])
+		}
+	}
+}
+
+func TestReadSnapshotInvalid(t *testing.T) {
+	_, err := ReadSnapshot(bytes.NewBufferString("not a tarball"))
+	assert.Error(t, err)
+
+	var buf bytes.Buffer
+	assert.NoError(t, WriteSnapshot(&buf, &Snapshot{}))
+	_, err = ReadSnapshot(&buf)
+	assert.NoError(t, err)
+}
+
+func TestRedactValues(t *testing.T) {
+	values := map[string]interface{}{
+		"users": []interface{}{
+			map[string]interface{}{"name": "admin", "password": "hunter2"},
+		},
+		"apiKey":   12345,
+		"tokens":   []interface{}{"a", "b"},
+		"replicas": 2,
+		"secret":   nil,
+	}
+	redactValues(values)
+	assert.Equal(t, map[string]interface{}{
+		"users": []interface{}{
+			map[string]interface{}{"name": "admin", "password": Redacted},
+		},
+		"apiKey":   Redacted,
+		"tokens":   []interface{}{Redacted, Redacted},
+		"replicas": 2,
+		"secret":   nil,
+	}, values)
+}
@@ -0,0 +1,171 @@
+// Copyright 2021 FairwindsOps, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package helm
+
+import (
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/release"
+	"k8s.io/klog"
+)
+
+// Subcharts returns a release for each enabled dependency of the chart of an umbrella release, named
+// parent/dependency after the alias of the dependency. Each has the chart of the dependency, the values the parent
+// passes to it along with global, and the manifests rendered from its templates. Dependencies whose version is not
+// known, because the chart was stored without its Chart.lock or subcharts, are left out.
+func Subcharts(rel *release.Release) []*release.Release {
+	if rel.Chart == nil || rel.Chart.Metadata == nil {
+		return nil
+	}
+	parent := rel.Chart
+
+	loaded := map[string]*chart.Chart{}
+	for _, sub := range parent.Dependencies() {
+		loaded[sub.Name()] = sub
+	}
+	deps := parent.Metadata.Dependencies
+	if len(deps) == 0 {
+		for _, sub := range parent.Dependencies() {
+			deps = append(deps, &chart.Dependency{Name: sub.Name(), Version: sub.Metadata.Version})
+		}
+	}
+	if len(deps) == 0 {
+		return nil
+	}
+
+	locked := map[string]string{}
+	if parent.Lock != nil {
+		for _, dep := range parent.Lock.Dependencies {
+			locked[dep.Name] = dep.Version
+		}
+	}
+
+	values, err := chartutil.CoalesceValues(parent, rel.Config)
+	if err != nil {
+		klog.V(3).Infof("unable to read the values of release %s/%s for its subcharts: %v", rel.Namespace, rel.Name, err)
+		values = rel.Config
+	}
+	// helm marks the enabled dependencies when installing, the conditions are only evaluated for charts it did not process
+	processed := false
+	for _, dep := range deps {
+		processed = processed || dep.Enabled
+	}
+
+	var subcharts []*release.Release
+	for _, dep := range deps {
+		name := dep.Name
+		if dep.Alias != "" {
+			name = dep.Alias
+		}
+		if processed && !dep.Enabled || !processed && !dependencyEnabled(dep, values) {
+			klog.V(3).Infof("subchart %s of release %s/%s is disabled", name, rel.Namespace, rel.Name)
+			continue
+		}
+
+		sub := &chart.Chart{Metadata: &chart.Metadata{Name: dep.Name}}
+		if l, ok := loaded[name]; ok {
+			sub = l
+		} else if l, ok := loaded[dep.Name]; ok {
+			sub = l
+		}
+		metadata := *sub.Metadata
+		// helm renames aliased subcharts, bundles match the name of the chart
+		metadata.Name = dep.Name
+		if metadata.Version == "" {
+			metadata.Version = locked[dep.Name]
+		}
+		if metadata.Version == "" {
+			if _, err := semver.StrictNewVersion(strings.TrimPrefix(dep.Version, "v")); err == nil {
+				metadata.Version = dep.Version
+			}
+		}
+		if metadata.Version == "" {
+			klog.V(3).Infof("ignoring subchart %s of release %s/%s, its version %q is not a version", name, rel.Namespace, rel.Name, dep.Version)
+			continue
+		}
+		c := *sub
+		c.Metadata = &metadata
+
+		config := map[string]interface{}{}
+		if v, ok := values[name].(map[string]interface{}); ok {
+			config = v
+		}
+		if global, ok := values["global"]; ok {
+			config["global"] = global
+		}
+
+		subcharts = append(subcharts, &release.Release{
+			Name:      rel.Name + "/" + name,
+			Namespace: rel.Namespace,
+			Info:      rel.Info,
+			Version:   rel.Version,
+			Chart:     &c,
+			Config:    config,
+			Manifest:  subchartManifest(rel.Manifest, parent.Metadata.Name, name, dep.Name),
+		})
+	}
+	return subcharts
+}
+
+// subchartManifest returns the manifests of a release rendered from the templates of a subchart, which helm
+// marks with a Source comment under the charts directory of the parent
+func subchartManifest(manifest, parent string, names ...string) string {
+	var docs []string
+	for _, doc := range strings.Split(manifest, "\n---") {
+		for _, name := range names {
+			if strings.Contains(doc, "# Source: "+parent+"/charts/"+name+"/") {
+				docs = append(docs, strings.TrimPrefix(strings.TrimSpace(doc), "---\n"))
+				break
+			}
+		}
+	}
+	if len(docs) == 0 {
+		return ""
+	}
+	return "---\n" + strings.Join(docs, "\n---\n") + "\n"
+}
+
+// dependencyEnabled evaluates the condition and tags of a dependency against the values of its parent like helm.
+// The first path of the condition that is set decides, then the tags, where any tag that is true enables it.
+func dependencyEnabled(dep *chart.Dependency, values chartutil.Values) bool {
+	for _, path := range strings.Split(dep.Condition, ",") {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+		v, err := values.PathValue(path)
+		if err != nil {
+			continue
+		}
+		if enabled, ok := v.(bool); ok {
+			return enabled
+		}
+	}
+
+	enabled, set := false, false
+	for _, tag := range dep.Tags {
+		v, err := values.PathValue("tags." + tag)
+		if err != nil {
+			continue
+		}
+		if b, ok := v.(bool); ok {
+			enabled, set = enabled || b, true
+		}
+	}
+	return enabled || !set
+}
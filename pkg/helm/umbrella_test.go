@@ -0,0 +1,182 @@
+// Copyright 2021 FairwindsOps, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package helm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/release"
+)
+
+const umbrellaManifest = `---
+# Source: platform/charts/certs/templates/deployment.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: cert-manager
+---
+# Source: platform/charts/ingress-nginx/templates/deployment.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: ingress-nginx
+---
+# Source: platform/templates/configmap.yaml
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: platform
+`
+
+func umbrellaRelease(deps []*chart.Dependency, config map[string]interface{}) *release.Release {
+	return &release.Release{
+		Name:      "platform",
+		Namespace: "infra",
+		Info:      &release.Info{Status: release.StatusDeployed},
+		Chart: &chart.Chart{
+			Metadata: &chart.Metadata{Name: "platform", Version: "0.1.0", Dependencies: deps},
+			Lock:     &chart.Lock{Dependencies: []*chart.Dependency{{Name: "cert-manager", Version: "1.7.1"}}},
+			Values: map[string]interface{}{
+				"global":        map[string]interface{}{"domain": "example.com"},
+				"ingress-nginx": map[string]interface{}{"enabled": false},
+			},
+		},
+		Config:   config,
+		Manifest: umbrellaManifest,
+	}
+}
+
+func TestSubcharts(t *testing.T) {
+	tests := []struct {
+		name       string
+		deps       []*chart.Dependency
+		config     map[string]interface{}
+		want       map[string]string
+		wantConfig map[string]interface{}
+	}{
+		{
+			name: "conditions evaluated against the values",
+			deps: []*chart.Dependency{
+				{Name: "cert-manager", Alias: "certs", Version: "~1.7"},
+				{Name: "ingress-nginx", Version: "4.0.1", Condition: "ingress-nginx.enabled"},
+			},
+			config:     map[string]interface{}{"certs": map[string]interface{}{"replicaCount": 2}},
+			want:       map[string]string{"platform/certs": "cert-manager@1.7.1"},
+			wantConfig: map[string]interface{}{"replicaCount": 2, "global": map[string]interface{}{"domain": "example.com"}},
+		},
+		{
+			name: "condition enabled by the release values",
+			deps: []*chart.Dependency{
+				{Name: "cert-manager", Alias: "certs", Version: "~1.7"},
+				{Name: "ingress-nginx", Version: "4.0.1", Condition: "ingress-nginx.enabled"},
+			},
+			config: map[string]interface{}{"ingress-nginx": map[string]interface{}{"enabled": true}},
+			want:   map[string]string{"platform/certs": "cert-manager@1.7.1", "platform/ingress-nginx": "ingress-nginx@4.0.1"},
+		},
+		{
+			name: "enabled as marked by helm",
+			deps: []*chart.Dependency{
+				{Name: "cert-manager", Alias: "certs", Version: "~1.7"},
+				{Name: "ingress-nginx", Version: "4.0.1", Condition: "ingress-nginx.enabled", Enabled: true},
+			},
+			want: map[string]string{"platform/ingress-nginx": "ingress-nginx@4.0.1"},
+		},
+		{
+			name: "unknown version",
+			deps: []*chart.Dependency{{Name: "redis", Version: "^17.0.0"}},
+			want: map[string]string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			subcharts := Subcharts(umbrellaRelease(tt.deps, tt.config))
+			got := map[string]string{}
+			for _, s := range subcharts {
+				got[s.Name] = s.Chart.Metadata.Name + "@" + s.Chart.Metadata.Version
+				assert.Equal(t, "infra", s.Namespace)
+				assert.Equal(t, release.StatusDeployed, s.Info.Status)
+				if s.Name == "platform/certs" {
+					assert.Contains(t, s.Manifest, "name: cert-manager")
+					assert.NotContains(t, s.Manifest, "name: ingress-nginx")
+					assert.NotContains(t, s.Manifest, "name: platform")
+					if tt.wantConfig != nil {
+						assert.Equal(t, tt.wantConfig, s.Config)
+					}
+				}
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestSubchartsLoaded(t *testing.T) {
+	rel := umbrellaRelease(nil, nil)
+	rel.Chart.Lock = nil
+	rel.Chart.AddDependency(&chart.Chart{Metadata: &chart.Metadata{Name: "cert-manager", Version: "1.8.0"}})
+
+	subcharts := Subcharts(rel)
+	assert.Len(t, subcharts, 1)
+	assert.Equal(t, "platform/cert-manager", subcharts[0].Name)
+	assert.Equal(t, "1.8.0", subcharts[0].Chart.Metadata.Version)
+
+	assert.Empty(t, Subcharts(&release.Release{Name: "plain", Chart: &chart.Chart{Metadata: &chart.Metadata{Name: "plain"}}}))
+}
+
+func TestDependencyEnabled(t *testing.T) {
+	values := map[string]interface{}{
+		"redis":  map[string]interface{}{"enabled": false},
+		"global": map[string]interface{}{"redis": map[string]interface{}{"enabled": true}},
+	}
+	tests := []struct {
+		condition string
+		want      bool
+	}{
+		{"", true},
+		{"redis.enabled", false},
+		{"missing.enabled, global.redis.enabled", true},
+		{"redis.enabled,global.redis.enabled", false},
+		{"missing.enabled", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.condition, func(t *testing.T) {
+			assert.Equal(t, tt.want, dependencyEnabled(&chart.Dependency{Condition: tt.condition}, values))
+		})
+	}
+}
+
+func TestDependencyEnabledTags(t *testing.T) {
+	values := map[string]interface{}{
+		"tags":  map[string]interface{}{"frontend": false, "backend": true},
+		"redis": map[string]interface{}{"enabled": true},
+	}
+	tests := []struct {
+		name string
+		dep  *chart.Dependency
+		want bool
+	}{
+		{"no tags", &chart.Dependency{}, true},
+		{"disabled tag", &chart.Dependency{Tags: []string{"frontend"}}, false},
+		{"any tag enabled", &chart.Dependency{Tags: []string{"frontend", "backend"}}, true},
+		{"unset tag", &chart.Dependency{Tags: []string{"other"}}, true},
+		{"condition wins over tags", &chart.Dependency{Condition: "redis.enabled", Tags: []string{"frontend"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, dependencyEnabled(tt.dep, values))
+		})
+	}
+}
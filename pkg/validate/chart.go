@@ -0,0 +1,93 @@
+// Copyright 2021 FairwindsOps, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package validate
+
+import (
+	"fmt"
+
+	"github.com/fairwindsops/gonogo/pkg/bundle"
+	"github.com/fairwindsops/gonogo/pkg/helm"
+	"helm.sh/helm/v3/pkg/chart"
+	"k8s.io/klog"
+)
+
+// withChartBundles merges the bundles shipped in the chart that b upgrades to into b, when they apply to the release.
+// The chart is downloaded from the repository of the bundle, b is returned unchanged when it can not be. The
+// overlays of config are applied again to the merged bundle, so that charts do not undo them.
+func (c *Config) withChartBundles(config *bundle.BundleConfig, b *bundle.Bundle, metadata *chart.Metadata, releaseName, namespace string) *bundle.Bundle {
+	if !c.ChartBundles || b.Source.Repository == "" {
+		return b
+	}
+
+	target := b.Versions.Target()
+	ch, err := c.targetChart(b)
+	if err != nil {
+		klog.Warningf("unable to look for bundles in chart %s %s: %v", b.Source.Chart, target, err)
+		return b
+	}
+
+	shipped, err := bundle.ChartBundles(ch)
+	if err != nil {
+		klog.Warningf("ignoring bundles shipped in chart %s %s: %v", b.Source.Chart, target, err)
+		return b
+	}
+
+	applicable := []*bundle.Bundle{b}
+	for _, s := range shipped {
+		if s.Versions.Target() != target {
+			continue
+		}
+		_, ok, err := s.MatchRelease(metadata, releaseName, namespace)
+		if err != nil {
+			klog.Warningf("unable to compare release %s/%s with bundle %s shipped in chart %s %s: %v", namespace, releaseName, s.Name, b.Source.Chart, target, err)
+			continue
+		}
+		if ok {
+			klog.V(3).Infof("using bundle %s shipped in chart %s %s for release %s/%s", s.Name, b.Source.Chart, target, namespace, releaseName)
+			applicable = append(applicable, s)
+		}
+	}
+	if len(applicable) == 1 {
+		return b
+	}
+	merged, err := config.ApplyPatches(bundle.Merge(applicable...))
+	if err != nil || merged == nil {
+		klog.Warningf("ignoring bundles shipped in chart %s %s, unable to apply overlays to them: %v", b.Source.Chart, target, err)
+		return b
+	}
+	return merged
+}
+
+// loadedChart is a chart downloaded by targetChart, or the error downloading it
+type loadedChart struct {
+	chart *chart.Chart
+	err   error
+}
+
+// targetChart returns the chart that b upgrades to, downloaded from the repository of the bundle. Charts are
+// downloaded once and shared by the checks that need them.
+func (c *Config) targetChart(b *bundle.Bundle) (*chart.Chart, error) {
+	target := b.Versions.Target()
+	key := fmt.Sprintf("%s/%s-%s", b.Source.Repository, b.Source.Chart, target)
+	if c.charts == nil {
+		c.charts = map[string]loadedChart{}
+	}
+	l, ok := c.charts[key]
+	if !ok {
+		l.chart, l.err = helm.LoadChart(b.Source.Chart, b.Source.Repository, target)
+		c.charts[key] = l
+	}
+	return l.chart, l.err
+}
@@ -0,0 +1,90 @@
+// Copyright 2021 FairwindsOps, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package validate
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fairwindsops/gonogo/pkg/helm"
+	"github.com/stretchr/testify/assert"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/release"
+)
+
+const shippedBundle = `addons:
+  - opa_checks:
+      - |
+        package fairwinds
+        noisy[actionItem] {
+          input.kind == "Deployment"
+          actionItem := {"title": "noisy", "description": "d", "remediation": "r", "category": "Reliability", "severity": 0.1}
+        }
+      - |
+        package fairwinds
+        kept[actionItem] {
+          input.kind == "Deployment"
+          actionItem := {"title": "kept", "description": "d", "remediation": "r", "category": "Reliability", "severity": 0.1}
+        }
+`
+
+func TestValidateChartBundlesOverlay(t *testing.T) {
+	overlay := filepath.Join(t.TempDir(), "overlay.yaml")
+	assert.NoError(t, os.WriteFile(overlay, []byte(`apiVersion: gonogo.fairwinds.com/v1alpha1
+kind: BundleOverlay
+patches:
+- name: cert-manager
+  disable:
+    opa_checks:
+    - noisy
+`), 0o644))
+
+	tests := []struct {
+		name       string
+		bundles    []string
+		wantTitles []string
+	}{
+		{name: "without overlay", bundles: []string{"testdata/render.yaml"}, wantTitles: []string{"noisy", "kept"}},
+		{name: "overlay disables a shipped check", bundles: []string{"testdata/render.yaml", overlay}, wantTitles: []string{"kept"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rel := helm.NewOfflineRelease("cert-manager", "cert-manager", &chart.Metadata{Name: "cert-manager", Version: "1.7.1"}, nil, renderManifest)
+			h, err := helm.NewOfflineHelm([]*release.Release{rel}, "1.27.3", []string{"apps/v1"})
+			assert.NoError(t, err)
+
+			target := renderTestChart()
+			target.Files = append(target.Files, &chart.File{Name: "gonogo.yaml", Data: []byte(shippedBundle)})
+			c := &Config{
+				Releases:     h,
+				Cluster:      h,
+				Bundle:       tt.bundles,
+				CacheDir:     t.TempDir(),
+				ChartBundles: true,
+				charts:       map[string]loadedChart{"https://charts.jetstack.io/cert-manager-1.8.0": {chart: target}},
+			}
+			o, err := c.Validate(context.Background())
+			assert.NoError(t, err)
+			assert.Len(t, o.Addons, 1)
+			var titles []string
+			for _, ai := range o.Addons[0].ActionItems {
+				titles = append(titles, ai.Title)
+			}
+			assert.ElementsMatch(t, tt.wantTitles, titles)
+		})
+	}
+}
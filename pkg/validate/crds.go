@@ -0,0 +1,379 @@
+// Copyright 2021 FairwindsOps, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package validate
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/fairwindsops/gonogo/pkg/helm"
+	"github.com/thoas/go-funk"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// checkCRDs is the name of the crd compatibility check, as reported in SkippedChecks
+const checkCRDs = "crds"
+
+// crd is what the checks compare of a v1 CustomResourceDefinition
+type crd struct {
+	name           string
+	group          string
+	versions       []crdVersion
+	storedVersions []string
+	// conversion is the conversion strategy, None when it is not set
+	conversion string
+	// webhook is the namespace/name of the service of the conversion webhook, if any
+	webhook string
+	// manual is set for the crds in the crds directory of a chart, which helm does not upgrade
+	manual bool
+}
+
+type crdVersion struct {
+	name    string
+	served  bool
+	storage bool
+	schema  map[string]interface{}
+}
+
+// parseCRD reads a v1 CustomResourceDefinition, objects of other kinds and apis are not
+func parseCRD(obj map[string]interface{}) (crd, bool) {
+	// decoded manifests and cluster objects are given the same types
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return crd{}, false
+	}
+	var c struct {
+		APIVersion string `json:"apiVersion"`
+		Kind       string `json:"kind"`
+		Metadata   struct {
+			Name string `json:"name"`
+		} `json:"metadata"`
+		Spec struct {
+			Group    string `json:"group"`
+			Versions []struct {
+				Name    string `json:"name"`
+				Served  bool   `json:"served"`
+				Storage bool   `json:"storage"`
+				Schema  struct {
+					OpenAPIV3Schema map[string]interface{} `json:"openAPIV3Schema"`
+				} `json:"schema"`
+			} `json:"versions"`
+			Conversion struct {
+				Strategy string `json:"strategy"`
+				Webhook  struct {
+					ClientConfig struct {
+						Service struct {
+							Namespace string `json:"namespace"`
+							Name      string `json:"name"`
+						} `json:"service"`
+					} `json:"clientConfig"`
+				} `json:"webhook"`
+			} `json:"conversion"`
+		} `json:"spec"`
+		Status struct {
+			StoredVersions []string `json:"storedVersions"`
+		} `json:"status"`
+	}
+	if err := json.Unmarshal(data, &c); err != nil || c.APIVersion != "apiextensions.k8s.io/v1" || c.Kind != "CustomResourceDefinition" {
+		return crd{}, false
+	}
+
+	out := crd{
+		name:           c.Metadata.Name,
+		group:          c.Spec.Group,
+		storedVersions: c.Status.StoredVersions,
+		conversion:     c.Spec.Conversion.Strategy,
+	}
+	if out.conversion == "" {
+		out.conversion = "None"
+	}
+	if s := c.Spec.Conversion.Webhook.ClientConfig.Service; s.Name != "" {
+		out.webhook = s.Namespace + "/" + s.Name
+	}
+	for _, v := range c.Spec.Versions {
+		out.versions = append(out.versions, crdVersion{name: v.Name, served: v.Served, storage: v.Storage, schema: v.Schema.OpenAPIV3Schema})
+	}
+	return out, true
+}
+
+func (c crd) version(name string) (crdVersion, bool) {
+	for _, v := range c.versions {
+		if v.name == name {
+			return v, true
+		}
+	}
+	return crdVersion{}, false
+}
+
+func (c crd) storageVersion() string {
+	for _, v := range c.versions {
+		if v.storage {
+			return v.name
+		}
+	}
+	return ""
+}
+
+// targetCRDs returns the crds of the target chart: those in its crds directories and those its templates render
+func (m *match) targetCRDs() ([]crd, error) {
+	var crds []crd
+	seen := map[string]bool{}
+	add := func(objs []map[string]interface{}, manual bool) {
+		for _, obj := range objs {
+			c, ok := parseCRD(obj)
+			if !ok || seen[c.name] {
+				continue
+			}
+			seen[c.name] = true
+			c.manual = manual
+			crds = append(crds, c)
+		}
+	}
+	for _, f := range m.target.CRDObjects() {
+		objs, err := splitYAML(f.File.Data)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read %s of chart %s: %w", f.Filename, m.target.Name(), err)
+		}
+		add(objs, true)
+	}
+	add(m.rendered, false)
+	return crds, nil
+}
+
+// validateCRDs compares the crds of the target chart with those in the cluster, and adds action items for the
+// versions that are removed, storage versions and conversions that change, schemas that accept less and crds that
+// helm will not upgrade
+func (m *match) validateCRDs() error {
+	targets, err := m.targetCRDs()
+	if err != nil {
+		return err
+	}
+	if len(targets) == 0 {
+		return nil
+	}
+
+	objs, err := m.Cluster.GetClusterObjects("apiextensions.k8s.io", "v1", "customresourcedefinitions", metav1.NamespaceAll)
+	if err != nil {
+		if errors.Is(err, helm.ErrNoCluster) || helm.IsAccessError(err) {
+			m.skip(checkCRDs, fmt.Sprintf("unable to list the crds of the cluster: %v", err))
+			return nil
+		}
+		return fmt.Errorf("unable to list the crds of the cluster: %w", err)
+	}
+	installed := map[string]crd{}
+	for _, obj := range objs {
+		if c, ok := parseCRD(obj.Object); ok {
+			installed[c.name] = c
+		}
+	}
+
+	for _, target := range targets {
+		current, ok := installed[target.name]
+		if !ok {
+			if target.manual {
+				m.addCRDItem(target.name, "CRD is not installed", "crdManualApply", "critical",
+					fmt.Sprintf("CRD %s is in the crds directory of chart %s %s and is not in the cluster. Helm only installs those CRDs with the chart, not on upgrades", target.name, m.target.Name(), m.target.Metadata.Version),
+					"Apply the CRD with kubectl apply before upgrading the release")
+			}
+			continue
+		}
+		m.compareCRDs(current, target)
+	}
+	return nil
+}
+
+// compareCRDs adds the action items for the changes from the crd in the cluster to the target one
+func (m *match) compareCRDs(current, target crd) {
+	for _, v := range current.versions {
+		tv, ok := target.version(v.name)
+		switch {
+		case !ok && funk.ContainsString(current.storedVersions, v.name):
+			m.addCRDItem(target.name, "Stored CRD version is removed", "crdStoredVersionRemoved", "critical",
+				fmt.Sprintf("CRD %s no longer has version %s, which objects are stored in. The api server rejects CRDs without the versions listed in status.storedVersions", target.name, v.name),
+				fmt.Sprintf("Migrate the stored objects to version %s and remove %s from status.storedVersions of the CRD before upgrading", target.storageVersion(), v.name))
+		case v.served && (!ok || !tv.served):
+			m.addCRDItem(target.name, "Served CRD version is removed", "crdServedVersionRemoved", "warning",
+				fmt.Sprintf("CRD %s no longer serves version %s", target.name, v.name),
+				fmt.Sprintf("Update the objects, manifests and clients that use %s/%s to %s/%s", current.group, v.name, target.group, target.storageVersion()))
+		}
+		if ok {
+			if fields := narrowedFields("", v.schema, tv.schema); len(fields) > 0 {
+				m.addCRDItem(target.name, "CRD schema is narrowed", "crdSchemaNarrowed", "warning",
+					fmt.Sprintf("Version %s of CRD %s accepts less than the installed one: %s", v.name, target.name, strings.Join(fields, ", ")),
+					"Check that the existing objects are valid against the new schema, the api server rejects changes to objects that are not")
+			}
+		}
+	}
+
+	if from, to := current.storageVersion(), target.storageVersion(); from != to {
+		description := fmt.Sprintf("CRD %s stores objects in version %s instead of %s. Existing objects stay stored in %s until they are written again", target.name, to, from, from)
+		if target.conversion == "None" {
+			description += ", and with the None conversion strategy only their apiVersion changes between versions"
+		}
+		m.addCRDItem(target.name, "CRD storage version changes", "crdStorageVersionChanged", "warning", description,
+			fmt.Sprintf("Migrate the stored objects to %s after the upgrade, before a version of the chart removes %s", to, from))
+	}
+
+	if current.conversion != target.conversion {
+		remediation := "Check that the objects of every version convert as expected"
+		if target.webhook != "" {
+			remediation = fmt.Sprintf("Make sure the conversion webhook service %s is running when the CRD is applied, requests for the objects of the CRD fail without it", target.webhook)
+		}
+		m.addCRDItem(target.name, "CRD conversion changes", "crdConversionChanged", "warning",
+			fmt.Sprintf("CRD %s changes its conversion strategy from %s to %s", target.name, current.conversion, target.conversion), remediation)
+	}
+
+	if target.manual && crdChanged(current, target) {
+		m.addCRDItem(target.name, "CRD needs to be applied manually", "crdManualApply", "warning",
+			fmt.Sprintf("CRD %s changes in the crds directory of chart %s %s. Helm does not upgrade the CRDs in that directory", target.name, m.target.Name(), m.target.Metadata.Version),
+			"Apply the CRD with kubectl apply --server-side before upgrading the release")
+	}
+}
+
+// crdChanged reports whether the versions or the schemas of a crd differ
+func crdChanged(current, target crd) bool {
+	if len(current.versions) != len(target.versions) {
+		return true
+	}
+	for i, v := range current.versions {
+		tv := target.versions[i]
+		if v.name != tv.name || v.served != tv.served || v.storage != tv.storage || !reflect.DeepEqual(v.schema, tv.schema) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *match) addCRDItem(name, title, eventType, severity, description, remediation string) {
+	m.AddonOutput.ActionItems = append(m.AddonOutput.ActionItems, &ActionItem{
+		ResourceKind: "CustomResourceDefinition",
+		ResourceName: name,
+		Title:        title,
+		Description:  description,
+		Remediation:  remediation,
+		EventType:    eventType,
+		Severity:     severity,
+		Category:     "Reliability",
+		Report:       "gonogo",
+	})
+}
+
+// narrowedFields returns the fields of an openapi schema that accept less in target than in current: properties
+// removed, types changed, fields newly required, enums and bounds tightened and patterns changed
+func narrowedFields(path string, current, target map[string]interface{}) []string {
+	if current == nil || target == nil {
+		return nil
+	}
+	at := func(reason string) string {
+		if path == "" {
+			return "(root) " + reason
+		}
+		return path + " " + reason
+	}
+
+	var fields []string
+	if ct, tt := current["type"], target["type"]; ct != nil && tt != nil && ct != tt {
+		fields = append(fields, at(fmt.Sprintf("changes type from %v to %v", ct, tt)))
+	}
+	if te, ok := target["enum"].([]interface{}); ok {
+		ce, _ := current["enum"].([]interface{})
+		if _, ok := current["enum"]; !ok || len(enumRemoved(ce, te)) > 0 {
+			fields = append(fields, at("allows fewer values"))
+		}
+	}
+	if current["pattern"] != target["pattern"] && target["pattern"] != nil {
+		fields = append(fields, at("changes its pattern"))
+	}
+	for _, bound := range []string{"maximum", "maxLength", "maxItems", "maxProperties"} {
+		if tightened(current[bound], target[bound], func(c, t float64) bool { return t < c }) {
+			fields = append(fields, at("lowers "+bound))
+		}
+	}
+	for _, bound := range []string{"minimum", "minLength", "minItems", "minProperties"} {
+		if tightened(current[bound], target[bound], func(c, t float64) bool { return t > c }) {
+			fields = append(fields, at("raises "+bound))
+		}
+	}
+
+	required, _ := current["required"].([]interface{})
+	newRequired, _ := target["required"].([]interface{})
+	for _, r := range enumRemoved(newRequired, required) {
+		fields = append(fields, join(path, fmt.Sprint(r))+" is required")
+	}
+
+	currentProperties, _ := current["properties"].(map[string]interface{})
+	targetProperties, _ := target["properties"].(map[string]interface{})
+	preserves := target["x-kubernetes-preserve-unknown-fields"] == true || target["additionalProperties"] != nil
+	names := make([]string, 0, len(currentProperties))
+	for name := range currentProperties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		tp, ok := targetProperties[name].(map[string]interface{})
+		if !ok {
+			if !preserves {
+				fields = append(fields, join(path, name)+" is removed")
+			}
+			continue
+		}
+		cp, _ := currentProperties[name].(map[string]interface{})
+		fields = append(fields, narrowedFields(join(path, name), cp, tp)...)
+	}
+
+	ci, _ := current["items"].(map[string]interface{})
+	ti, _ := target["items"].(map[string]interface{})
+	fields = append(fields, narrowedFields(path+"[]", ci, ti)...)
+	return fields
+}
+
+func join(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// enumRemoved returns the values of current that are not in target
+func enumRemoved(current, target []interface{}) []interface{} {
+	var removed []interface{}
+	for _, c := range current {
+		found := false
+		for _, t := range target {
+			if fmt.Sprint(c) == fmt.Sprint(t) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			removed = append(removed, c)
+		}
+	}
+	return removed
+}
+
+// tightened reports whether a bound is set in target and either not in current or tighter according to tighter
+func tightened(current, target interface{}, tighter func(c, t float64) bool) bool {
+	t, ok := target.(float64)
+	if !ok {
+		return false
+	}
+	c, ok := current.(float64)
+	return !ok || tighter(c, t)
+}
@@ -0,0 +1,276 @@
+// Copyright 2021 FairwindsOps, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package validate
+
+import (
+	"context"
+	"testing"
+
+	"github.com/fairwindsops/gonogo/pkg/helm"
+	"github.com/stretchr/testify/assert"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/release"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const clusterCRDs = `apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: issuers.cert-manager.io
+spec:
+  group: cert-manager.io
+  conversion:
+    strategy: Webhook
+    webhook:
+      clientConfig:
+        service:
+          namespace: cert-manager
+          name: cert-manager-webhook
+  versions:
+    - name: v1alpha2
+      served: true
+      storage: false
+      schema:
+        openAPIV3Schema:
+          type: object
+    - name: v1
+      served: true
+      storage: true
+      schema:
+        openAPIV3Schema:
+          type: object
+          properties:
+            spec:
+              type: object
+              properties:
+                acme:
+                  type: object
+                ca:
+                  type: object
+status:
+  storedVersions: [v1alpha2, v1]
+---
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: orders.acme.cert-manager.io
+spec:
+  group: acme.cert-manager.io
+  versions:
+    - name: v1
+      served: true
+      storage: true
+      schema:
+        openAPIV3Schema:
+          type: object
+status:
+  storedVersions: [v1]
+`
+
+const chartCRDs = `apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: issuers.cert-manager.io
+spec:
+  group: cert-manager.io
+  versions:
+    - name: v1
+      served: true
+      storage: true
+      schema:
+        openAPIV3Schema:
+          type: object
+          properties:
+            spec:
+              type: object
+              required: [acme]
+              properties:
+                acme:
+                  type: object
+---
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: certificates.cert-manager.io
+spec:
+  group: cert-manager.io
+  versions:
+    - name: v1
+      served: true
+      storage: true
+`
+
+const renderedCRD = `apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: orders.acme.cert-manager.io
+spec:
+  group: acme.cert-manager.io
+  versions:
+    - name: v1
+      served: false
+      storage: false
+      schema:
+        openAPIV3Schema:
+          type: object
+    - name: v2
+      served: true
+      storage: true
+      schema:
+        openAPIV3Schema:
+          type: object
+`
+
+// objectCluster is a staticCluster with objects
+type objectCluster struct {
+	staticCluster
+	objects []unstructured.Unstructured
+}
+
+func (c objectCluster) GetClusterObjects(group, version, resource, namespace string) ([]unstructured.Unstructured, error) {
+	return c.objects, nil
+}
+
+func TestValidateCRDs(t *testing.T) {
+	installed, err := splitYAML([]byte(clusterCRDs))
+	assert.NoError(t, err)
+	cluster := objectCluster{staticCluster: "v1.27.3"}
+	for _, obj := range installed {
+		cluster.objects = append(cluster.objects, unstructured.Unstructured{Object: obj})
+	}
+	rendered, err := splitYAML([]byte(renderedCRD))
+	assert.NoError(t, err)
+	target := &chart.Chart{
+		Metadata: &chart.Metadata{Name: "cert-manager", Version: "1.8.0"},
+		Files:    []*chart.File{{Name: "crds/crds.yaml", Data: []byte(chartCRDs)}},
+	}
+
+	m := match{
+		Release:     helm.NewOfflineRelease("cert-manager", "cert-manager", &chart.Metadata{Name: "cert-manager", Version: "1.7.1"}, nil, ""),
+		AddonOutput: &AddonOutput{},
+		Cluster:     cluster,
+		target:      target,
+		rendered:    rendered,
+	}
+	assert.NoError(t, m.validateCRDs())
+	var items []string
+	for _, ai := range m.AddonOutput.ActionItems {
+		items = append(items, ai.ResourceName+": "+ai.Title)
+	}
+	assert.Equal(t, []string{
+		"issuers.cert-manager.io: Stored CRD version is removed",
+		"issuers.cert-manager.io: CRD schema is narrowed",
+		"issuers.cert-manager.io: CRD conversion changes",
+		"issuers.cert-manager.io: CRD needs to be applied manually",
+		"certificates.cert-manager.io: CRD is not installed",
+		"orders.acme.cert-manager.io: Served CRD version is removed",
+		"orders.acme.cert-manager.io: CRD storage version changes",
+	}, items)
+	assert.Equal(t, "Version v1 of CRD issuers.cert-manager.io accepts less than the installed one: spec.acme is required, spec.ca is removed", m.AddonOutput.ActionItems[1].Description)
+}
+
+func TestValidateCRDsWithoutRendering(t *testing.T) {
+	installed, err := splitYAML([]byte(clusterCRDs))
+	assert.NoError(t, err)
+	cluster := objectCluster{staticCluster: "v1.27.3"}
+	for _, obj := range installed {
+		cluster.objects = append(cluster.objects, unstructured.Unstructured{Object: obj})
+	}
+	rel := helm.NewOfflineRelease("cert-manager", "cert-manager", &chart.Metadata{Name: "cert-manager", Version: "1.7.1"}, nil, renderManifest)
+	target := &chart.Chart{
+		Metadata: &chart.Metadata{Name: "cert-manager", Version: "1.8.0"},
+		Files:    []*chart.File{{Name: "crds/crds.yaml", Data: []byte(chartCRDs)}},
+	}
+
+	c := &Config{
+		Releases:  staticReleases{rel},
+		Cluster:   cluster,
+		Bundle:    []string{"testdata/render.yaml"},
+		CacheDir:  t.TempDir(),
+		CheckCRDs: true,
+		charts:    map[string]loadedChart{"https://charts.jetstack.io/cert-manager-1.8.0": {chart: target}},
+	}
+	o, err := c.Validate(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, o.Addons, 1)
+	assert.Nil(t, o.Addons[0].ManifestDiff, "the target chart is not rendered without RenderTarget")
+	var titles []string
+	for _, ai := range o.Addons[0].ActionItems {
+		titles = append(titles, ai.ResourceName+": "+ai.Title)
+	}
+	assert.Equal(t, []string{
+		"issuers.cert-manager.io: Stored CRD version is removed",
+		"issuers.cert-manager.io: CRD schema is narrowed",
+		"issuers.cert-manager.io: CRD conversion changes",
+		"issuers.cert-manager.io: CRD needs to be applied manually",
+		"certificates.cert-manager.io: CRD is not installed",
+	}, titles)
+}
+
+func TestValidateCRDsOffline(t *testing.T) {
+	h, err := helm.NewOfflineHelm([]*release.Release{}, "1.27.3", []string{"apps/v1"})
+	assert.NoError(t, err)
+	m := match{
+		Release:     helm.NewOfflineRelease("cert-manager", "cert-manager", &chart.Metadata{Name: "cert-manager", Version: "1.7.1"}, nil, ""),
+		AddonOutput: &AddonOutput{},
+		Cluster:     h,
+		target:      &chart.Chart{Metadata: &chart.Metadata{Name: "cert-manager", Version: "1.8.0"}, Files: []*chart.File{{Name: "crds/crds.yaml", Data: []byte(chartCRDs)}}},
+	}
+	assert.NoError(t, m.validateCRDs())
+	assert.Empty(t, m.AddonOutput.ActionItems)
+	assert.Len(t, m.AddonOutput.SkippedChecks, 1)
+	assert.Equal(t, checkCRDs, m.AddonOutput.SkippedChecks[0].Check)
+}
+
+func TestNarrowedFields(t *testing.T) {
+	tests := []struct {
+		name            string
+		current, target map[string]interface{}
+		want            []string
+	}{
+		{
+			name:    "unchanged",
+			current: map[string]interface{}{"type": "object", "properties": map[string]interface{}{"a": map[string]interface{}{"type": "string"}}},
+			target:  map[string]interface{}{"type": "object", "properties": map[string]interface{}{"a": map[string]interface{}{"type": "string"}}},
+		},
+		{
+			name:    "widened",
+			current: map[string]interface{}{"type": "string", "enum": []interface{}{"a"}, "maxLength": 5.0},
+			target:  map[string]interface{}{"type": "string", "enum": []interface{}{"a", "b"}, "maxLength": 10.0},
+		},
+		{
+			name:    "narrowed",
+			current: map[string]interface{}{"type": "string", "enum": []interface{}{"a", "b"}, "maxLength": 10.0},
+			target:  map[string]interface{}{"type": "string", "enum": []interface{}{"a"}, "maxLength": 5.0, "minLength": 1.0, "pattern": "^a"},
+			want:    []string{"(root) allows fewer values", "(root) changes its pattern", "(root) lowers maxLength", "(root) raises minLength"},
+		},
+		{
+			name:    "items and types",
+			current: map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}},
+			target:  map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "integer"}},
+			want:    []string{"[] changes type from string to integer"},
+		},
+		{
+			name:    "removed property kept by preserve unknown fields",
+			current: map[string]interface{}{"properties": map[string]interface{}{"a": map[string]interface{}{}}},
+			target:  map[string]interface{}{"x-kubernetes-preserve-unknown-fields": true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, narrowedFields("", tt.current, tt.target))
+		})
+	}
+}
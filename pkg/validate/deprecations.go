@@ -0,0 +1,193 @@
+// Copyright 2021 FairwindsOps, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package validate
+
+import (
+	_ "embed"
+	"fmt"
+	"strings"
+
+	"github.com/blang/semver/v4"
+	"sigs.k8s.io/yaml"
+)
+
+// checkDeprecatedAPIs is the name of the deprecated api check, as reported in SkippedChecks
+const checkDeprecatedAPIs = "deprecated_apis"
+
+//go:embed deprecated_apis.yaml
+var deprecatedAPIsFile []byte
+
+// deprecatedAPI is the api version of a kind that kubernetes deprecated and stops serving
+type deprecatedAPI struct {
+	APIVersion   string `json:"apiVersion"`
+	Kind         string `json:"kind"`
+	DeprecatedIn string `json:"deprecatedIn"`
+	RemovedIn    string `json:"removedIn"`
+	Replacement  string `json:"replacement"` // api version to use instead, empty when the kind has none
+
+	deprecatedIn semver.Version
+	removedIn    semver.Version
+}
+
+// deprecatedAPIs reads the embedded database of deprecated apis, keyed by api version and kind
+func deprecatedAPIs() (map[string]deprecatedAPI, error) {
+	var list []deprecatedAPI
+	if err := yaml.UnmarshalStrict(deprecatedAPIsFile, &list); err != nil {
+		return nil, fmt.Errorf("unable to read the deprecated apis: %w", err)
+	}
+	apis := map[string]deprecatedAPI{}
+	for _, api := range list {
+		var err error
+		if api.deprecatedIn, err = minorVersion(api.DeprecatedIn); err != nil {
+			return nil, err
+		}
+		if api.removedIn, err = minorVersion(api.RemovedIn); err != nil {
+			return nil, err
+		}
+		apis[api.APIVersion+"/"+api.Kind] = api
+	}
+	return apis, nil
+}
+
+// minorVersion parses the major and minor of a kubernetes version. Apis are removed in a minor version, comparing
+// patches and pre-releases such as v1.25.0-gke.100 would make them look removed later.
+func minorVersion(v string) (semver.Version, error) {
+	parsed, err := semver.ParseTolerant(v)
+	if err != nil {
+		return semver.Version{}, fmt.Errorf("unable to parse kubernetes version %s: %w", v, err)
+	}
+	return semver.Version{Major: parsed.Major, Minor: parsed.Minor}, nil
+}
+
+// apiVersions are the kubernetes versions deprecated apis are compared with
+type apiVersions struct {
+	// cluster is the version of the cluster, nil when it is not known
+	cluster *semver.Version
+	// upgrade is the version the cluster is upgraded to, nil when none was given
+	upgrade *semver.Version
+}
+
+// deprecatedAPIVersions returns the versions the deprecated apis are compared with: that of the cluster and
+// TargetKubeVersion
+func (c *Config) deprecatedAPIVersions(cl cluster) (apiVersions, error) {
+	var versions apiVersions
+	if cl.version != nil {
+		v, err := minorVersion(cl.version.String())
+		if err != nil {
+			return versions, err
+		}
+		versions.cluster = &v
+	}
+	if c.TargetKubeVersion != "" {
+		v, err := minorVersion(c.TargetKubeVersion)
+		if err != nil {
+			return versions, err
+		}
+		versions.upgrade = &v
+	}
+	return versions, nil
+}
+
+// validateDeprecatedAPIs adds an action item for each object of the installed manifest of the release, and of the
+// rendered target chart, whose api is deprecated or removed in the cluster version or the version it is upgraded to
+func (m *match) validateDeprecatedAPIs(apis map[string]deprecatedAPI, versions apiVersions) error {
+	if versions.cluster == nil && versions.upgrade == nil {
+		m.skip(checkDeprecatedAPIs, "neither the cluster version nor a kubernetes version to upgrade to is known")
+		return nil
+	}
+
+	installed, err := splitYAML([]byte(m.Release.Manifest))
+	if err != nil {
+		return err
+	}
+	m.addDeprecatedAPIs(apis, versions, installed, true)
+	m.addDeprecatedAPIs(apis, versions, m.rendered, false)
+	return nil
+}
+
+// addDeprecatedAPIs adds an action item for each object with a deprecated or removed api, at most one per object.
+// installed tells whether the objects are those of the installed release or of the target chart.
+func (m *match) addDeprecatedAPIs(apis map[string]deprecatedAPI, versions apiVersions, objects []map[string]interface{}, installed bool) {
+	source := "the target chart"
+	if installed {
+		source = "the installed release"
+	}
+	seen := map[string]bool{}
+	for _, obj := range objects {
+		apiVersion, _ := obj["apiVersion"].(string)
+		kind, _ := obj["kind"].(string)
+		api, ok := apis[apiVersion+"/"+kind]
+		if !ok {
+			continue
+		}
+		metadata, _ := obj["metadata"].(map[string]interface{})
+		name, _ := metadata["name"].(string)
+		namespace, _ := metadata["namespace"].(string)
+		key := strings.Join([]string{apiVersion, kind, namespace, name}, "/")
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		item := deprecatedAPIItem(api, versions, fmt.Sprintf("%s %s in %s uses %s", kind, name, source, apiVersion))
+		if item == nil {
+			continue
+		}
+		if namespace == "" {
+			namespace = m.Release.Namespace
+		}
+		item.ResourceNamespace = namespace
+		item.ResourceKind = kind
+		item.ResourceName = name
+		if installed && versions.cluster != nil && versions.cluster.GTE(api.removedIn) {
+			item.Remediation += ". Helm can not upgrade a release whose manifest has objects of apis the cluster does not serve, update the manifest with the helm mapkubeapis plugin first"
+		}
+		m.AddonOutput.ActionItems = append(m.AddonOutput.ActionItems, item)
+	}
+}
+
+// deprecatedAPIItem returns the action item for a deprecated api, nil when it is neither deprecated nor removed
+// in the versions. subject describes the object that uses the api.
+func deprecatedAPIItem(api deprecatedAPI, versions apiVersions, subject string) *ActionItem {
+	remediation := fmt.Sprintf("Use %s instead", api.Replacement)
+	if api.Replacement == "" {
+		remediation = fmt.Sprintf("%s %s has no replacement, remove the objects", api.APIVersion, api.Kind)
+	}
+	item := &ActionItem{
+		Remediation: remediation,
+		Category:    "Reliability",
+		Report:      "gonogo",
+	}
+
+	switch {
+	case versions.cluster != nil && versions.cluster.GTE(api.removedIn):
+		item.Title = "Removed API"
+		item.Description = fmt.Sprintf("%s, which the cluster does not serve since Kubernetes %s", subject, api.RemovedIn)
+	case versions.upgrade != nil && versions.upgrade.GTE(api.removedIn):
+		item.Title = "Removed API"
+		item.Description = fmt.Sprintf("%s, which is not served from Kubernetes %s and the cluster is upgraded to %d.%d", subject, api.RemovedIn, versions.upgrade.Major, versions.upgrade.Minor)
+	case versions.cluster != nil && versions.cluster.GTE(api.deprecatedIn), versions.upgrade != nil && versions.upgrade.GTE(api.deprecatedIn):
+		item.Title = "Deprecated API"
+		item.Description = fmt.Sprintf("%s, which is deprecated since Kubernetes %s and removed in %s", subject, api.DeprecatedIn, api.RemovedIn)
+		item.EventType = "apiDeprecated"
+		item.Severity = "warning"
+		return item
+	default:
+		return nil
+	}
+	item.EventType = "apiRemoved"
+	item.Severity = "critical"
+	return item
+}
@@ -0,0 +1,139 @@
+// Copyright 2021 FairwindsOps, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package validate
+
+import (
+	"context"
+	"testing"
+
+	"github.com/blang/semver/v4"
+	"github.com/fairwindsops/gonogo/pkg/helm"
+	"github.com/stretchr/testify/assert"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/release"
+)
+
+const deprecatedManifest = `---
+apiVersion: policy/v1beta1
+kind: PodDisruptionBudget
+metadata:
+  name: cert-manager
+---
+apiVersion: extensions/v1beta1
+kind: Ingress
+metadata:
+  name: cert-manager
+  namespace: web
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: cert-manager
+`
+
+func TestDeprecatedAPIs(t *testing.T) {
+	apis, err := deprecatedAPIs()
+	assert.NoError(t, err)
+	api, ok := apis["batch/v1beta1/CronJob"]
+	assert.True(t, ok)
+	assert.Equal(t, "batch/v1", api.Replacement)
+	assert.Equal(t, semver.Version{Major: 1, Minor: 25}, api.removedIn)
+}
+
+func TestValidateDeprecatedAPIs(t *testing.T) {
+	v := func(s string) *semver.Version {
+		parsed, err := minorVersion(s)
+		assert.NoError(t, err)
+		return &parsed
+	}
+	rendered, err := splitYAML([]byte(`apiVersion: batch/v1beta1
+kind: CronJob
+metadata:
+  name: cleanup
+`))
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name         string
+		versions     apiVersions
+		wantTitles   []string
+		wantResource []string
+		wantSkipped  bool
+	}{
+		{
+			name:         "cluster version",
+			versions:     apiVersions{cluster: v("v1.24.3-eks-6d3986b")},
+			wantTitles:   []string{"Deprecated API", "Removed API", "Deprecated API"},
+			wantResource: []string{"cert-manager/PodDisruptionBudget/cert-manager", "web/Ingress/cert-manager", "cert-manager/CronJob/cleanup"},
+		},
+		{
+			name:         "upgraded cluster version",
+			versions:     apiVersions{cluster: v("1.24.3"), upgrade: v("1.25")},
+			wantTitles:   []string{"Removed API", "Removed API", "Removed API"},
+			wantResource: []string{"cert-manager/PodDisruptionBudget/cert-manager", "web/Ingress/cert-manager", "cert-manager/CronJob/cleanup"},
+		},
+		{
+			name:         "old cluster version",
+			versions:     apiVersions{cluster: v("1.15.0")},
+			wantTitles:   []string{"Deprecated API"},
+			wantResource: []string{"web/Ingress/cert-manager"},
+		},
+		{
+			name:        "no version",
+			wantSkipped: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			apis, err := deprecatedAPIs()
+			assert.NoError(t, err)
+			m := match{
+				Release:     helm.NewOfflineRelease("cert-manager", "cert-manager", &chart.Metadata{Name: "cert-manager", Version: "1.7.1"}, nil, deprecatedManifest),
+				AddonOutput: &AddonOutput{},
+				rendered:    rendered,
+			}
+			assert.NoError(t, m.validateDeprecatedAPIs(apis, tt.versions))
+			var titles, resources []string
+			for _, ai := range m.AddonOutput.ActionItems {
+				titles = append(titles, ai.Title)
+				resources = append(resources, ai.ResourceNamespace+"/"+ai.ResourceKind+"/"+ai.ResourceName)
+			}
+			assert.Equal(t, tt.wantTitles, titles)
+			assert.Equal(t, tt.wantResource, resources)
+			assert.Equal(t, tt.wantSkipped, len(m.AddonOutput.SkippedChecks) == 1)
+		})
+	}
+}
+
+func TestValidateDeprecatedAPIsUnmatched(t *testing.T) {
+	legacy := helm.NewOfflineRelease("legacy", "web", &chart.Metadata{Name: "legacy", Version: "0.1.0"}, nil, deprecatedManifest)
+	current := helm.NewOfflineRelease("current", "web", &chart.Metadata{Name: "current", Version: "0.1.0"}, nil, offlineManifest)
+	h, err := helm.NewOfflineHelm([]*release.Release{legacy, current}, "1.24.3", []string{"apps/v1"})
+	assert.NoError(t, err)
+
+	c := &Config{Releases: h, Cluster: h, Bundle: []string{"testdata/offline.yaml"}, CacheDir: t.TempDir(), DeprecatedAPIs: true}
+	o, err := c.Validate(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, o.Addons, 1)
+	assert.Equal(t, "legacy", o.Addons[0].Name)
+	assert.Empty(t, o.Addons[0].MatchedBy)
+	assert.Len(t, o.Addons[0].ActionItems, 2)
+	assert.Contains(t, o.Addons[0].ActionItems[1].Remediation, "mapkubeapis")
+	assert.False(t, o.Go)
+
+	c.TargetKubeVersion = "not a version"
+	_, err = c.Validate(context.Background())
+	assert.Error(t, err)
+}
@@ -0,0 +1,175 @@
+// Copyright 2021 FairwindsOps, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package validate
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/fairwindsops/gonogo/pkg/bundle"
+	"k8s.io/klog"
+)
+
+// Fleet contains the necessary pieces to run the validation against several clusters
+type Fleet struct {
+	// Config is the configuration used for every cluster, its Releases and Cluster are replaced by those of the cluster
+	Config Config
+	// Clusters are the clusters to validate
+	Clusters []FleetCluster
+	// Parallel is the number of clusters validated at once, every cluster is validated at once when it is 0
+	Parallel int
+}
+
+// FleetCluster is a cluster of a fleet
+type FleetCluster struct {
+	Name string
+	// Releases and Cluster read the cluster, such as a helm.Helm. When they are nil the cluster is reported with Err instead.
+	Releases ReleaseSource
+	Cluster  ClusterInfo
+	// Err is why the cluster can not be read, such as a kubeconfig context that does not load
+	Err error
+}
+
+// FleetOutput is the result of validating a fleet
+type FleetOutput struct {
+	Clusters []ClusterOutput `yaml:"clusters"`
+	Summary  []FleetAddon    `yaml:"summary"`
+}
+
+// ClusterOutput is the result of validating one cluster of a fleet
+type ClusterOutput struct {
+	Name              string         `yaml:"name"`
+	Error             string         `yaml:"error,omitempty"` // why the cluster could not be validated
+	Addons            []*AddonOutput `yaml:"addons"`
+	UpgradeConfidence int            `yaml:"upgradeConfidence"` // lowest confidence of the addons of the cluster
+	Go                bool           `yaml:"go"`                // whether every addon of the cluster reaches the confidence threshold
+	Explanation       string         `yaml:"explanation"`       // why the upgrade of the cluster is a go or a no-go
+}
+
+// FleetAddon summarizes an addon across the clusters of a fleet
+type FleetAddon struct {
+	Name     string   `yaml:"name"`
+	Clusters []string `yaml:"clusters"` // clusters the addon is installed in
+	Blocked  []string `yaml:"blocked"`  // clusters where the upgrade confidence of the addon is under the threshold
+}
+
+// Validate validates every cluster concurrently with the same bundles and returns the results keyed by cluster along
+// with a summary of where each addon blocks upgrades. A cluster that fails is reported with its error, an error is
+// only returned when the bundles can not be read or every cluster failed.
+func (f *Fleet) Validate(ctx context.Context) (*FleetOutput, error) {
+	o := &FleetOutput{Clusters: make([]ClusterOutput, len(f.Clusters))}
+
+	bundles, err := bundle.NewLoader(f.Config.CacheDir).ReadConfig(f.Config.Bundle)
+	if err != nil {
+		return nil, err
+	}
+
+	parallel := f.Parallel
+	if parallel <= 0 || parallel > len(f.Clusters) {
+		parallel = len(f.Clusters)
+	}
+	sem := make(chan struct{}, parallel)
+	var wg sync.WaitGroup
+	for i, cluster := range f.Clusters {
+		wg.Add(1)
+		go func(i int, cluster FleetCluster) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			o.Clusters[i] = f.validateCluster(ctx, cluster, bundles)
+		}(i, cluster)
+	}
+	wg.Wait()
+
+	failed := 0
+	for _, c := range o.Clusters {
+		if c.Error != "" {
+			failed++
+		}
+	}
+	if failed > 0 && failed == len(o.Clusters) {
+		return o, fmt.Errorf("unable to validate any of the %d clusters", failed)
+	}
+	o.Summary = summarize(o.Clusters)
+	return o, nil
+}
+
+// validateCluster validates one cluster with its own copy of the configuration
+func (f *Fleet) validateCluster(ctx context.Context, cluster FleetCluster, bundles *bundle.BundleConfig) ClusterOutput {
+	out := ClusterOutput{Name: cluster.Name}
+	if cluster.Releases == nil || cluster.Cluster == nil {
+		err := cluster.Err
+		if err == nil {
+			err = fmt.Errorf("no client for the cluster")
+		}
+		klog.Errorf("skipping cluster %s: %v", cluster.Name, err)
+		out.Error = err.Error()
+		return out
+	}
+
+	c := f.Config
+	c.Releases = cluster.Releases
+	c.Cluster = cluster.Cluster
+	c.bundles = bundles
+	c.charts = nil
+	klog.Infof("validating cluster %s", cluster.Name)
+	o, err := c.Validate(ctx)
+	if err != nil {
+		klog.Errorf("unable to validate cluster %s: %v", cluster.Name, err)
+		out.Error = err.Error()
+		return out
+	}
+	out.Addons = o.Addons
+	out.UpgradeConfidence = o.UpgradeConfidence
+	out.Go = o.Go
+	out.Explanation = o.Explanation
+	return out
+}
+
+// summarize lists the clusters each addon is installed in and blocked in, by addon name
+func summarize(clusters []ClusterOutput) []FleetAddon {
+	addons := map[string]*FleetAddon{}
+	for _, c := range clusters {
+		for _, a := range c.Addons {
+			fa, ok := addons[a.Name]
+			if !ok {
+				fa = &FleetAddon{Name: a.Name}
+				addons[a.Name] = fa
+			}
+			fa.Clusters = appendCluster(fa.Clusters, c.Name)
+			if !a.Go {
+				fa.Blocked = appendCluster(fa.Blocked, c.Name)
+			}
+		}
+	}
+
+	summary := make([]FleetAddon, 0, len(addons))
+	for _, fa := range addons {
+		summary = append(summary, *fa)
+	}
+	sort.Slice(summary, func(i, j int) bool { return summary[i].Name < summary[j].Name })
+	return summary
+}
+
+// appendCluster appends a cluster once, an addon can be installed several times in a cluster
+func appendCluster(clusters []string, name string) []string {
+	if len(clusters) > 0 && clusters[len(clusters)-1] == name {
+		return clusters
+	}
+	return append(clusters, name)
+}
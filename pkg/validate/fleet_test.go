@@ -0,0 +1,72 @@
+// Copyright 2021 FairwindsOps, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package validate
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/fairwindsops/gonogo/pkg/helm"
+	"github.com/stretchr/testify/assert"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/release"
+)
+
+func fleetCluster(t *testing.T, name, kubeVersion string) FleetCluster {
+	rel := helm.NewOfflineRelease("cert-manager", "cert-manager", &chart.Metadata{Name: "cert-manager", Version: "1.7.1"}, map[string]interface{}{"replicaCount": 2}, "")
+	h, err := helm.NewOfflineHelm([]*release.Release{rel}, kubeVersion, []string{"apps/v1", "cert-manager.io/v1"})
+	assert.NoError(t, err)
+	return FleetCluster{Name: name, Releases: h, Cluster: h}
+}
+
+func TestFleetValidate(t *testing.T) {
+	f := &Fleet{
+		Config: Config{Bundle: []string{"testdata/offline.yaml"}, CacheDir: t.TempDir()},
+		Clusters: []FleetCluster{
+			fleetCluster(t, "staging", "1.25.0"),
+			fleetCluster(t, "prod", "1.27.3"),
+			{Name: "broken", Err: errors.New("context broken not found")},
+		},
+		Parallel: 2,
+	}
+	o, err := f.Validate(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, o.Clusters, 3)
+	assert.Equal(t, "staging", o.Clusters[0].Name)
+	assert.Len(t, o.Clusters[0].Addons, 1)
+	assert.Empty(t, o.Clusters[0].Addons[0].ActionItems)
+	assert.True(t, o.Clusters[0].Go)
+	assert.Equal(t, o.Clusters[0].Addons[0].UpgradeConfidence, o.Clusters[0].UpgradeConfidence)
+	assert.NotEmpty(t, o.Clusters[0].Explanation)
+	assert.Equal(t, "prod", o.Clusters[1].Name)
+	assert.Len(t, o.Clusters[1].Addons, 1)
+	assert.NotEmpty(t, o.Clusters[1].Addons[0].ActionItems)
+	assert.False(t, o.Clusters[1].Go)
+	assert.Equal(t, o.Clusters[1].Addons[0].UpgradeConfidence, o.Clusters[1].UpgradeConfidence)
+	assert.Contains(t, o.Clusters[1].Explanation, "cert-manager")
+	assert.Equal(t, "context broken not found", o.Clusters[2].Error)
+
+	assert.Equal(t, []FleetAddon{{Name: "cert-manager", Clusters: []string{"staging", "prod"}, Blocked: []string{"prod"}}}, o.Summary)
+}
+
+func TestFleetValidateEveryClusterFails(t *testing.T) {
+	f := &Fleet{
+		Config:   Config{Bundle: []string{"testdata/offline.yaml"}, CacheDir: t.TempDir()},
+		Clusters: []FleetCluster{{Name: "a", Err: errors.New("no")}, {Name: "b"}},
+	}
+	_, err := f.Validate(context.Background())
+	assert.Error(t, err)
+}
@@ -0,0 +1,128 @@
+// Copyright 2021 FairwindsOps, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package validate
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+	"helm.sh/helm/v3/pkg/release"
+)
+
+// analyzeHistory summarizes the revisions of the release in its AddonOutput, and adds an action item when
+// the version being upgraded to was already installed before. The history of an umbrella release is not that of its
+// subcharts, so there is none for them.
+func (m *match) analyzeHistory() {
+	if m.Releases == nil || m.Parent != nil {
+		return
+	}
+	revisions := m.Releases.History(m.Release.Namespace, m.Release.Name)
+	if len(revisions) == 0 {
+		return
+	}
+	h := historyOf(revisions, m.AddonOutput.Versions.Upgrade)
+	m.AddonOutput.History = h
+	if len(h.TargetAttempts) == 0 {
+		return
+	}
+
+	var attempts []string
+	for _, r := range h.TargetAttempts {
+		attempts = append(attempts, fmt.Sprintf("%d (%s)", r.Revision, r.Status))
+	}
+	remediation := fmt.Sprintf("Find out why the earlier attempts did not stick with helm history %s -n %s before upgrading again", m.Release.Name, m.Release.Namespace)
+	if h.LastKnownGood != nil {
+		remediation += fmt.Sprintf(". Revision %d with chart version %s is the last known good revision to roll back to", h.LastKnownGood.Revision, h.LastKnownGood.ChartVersion)
+	}
+	m.AddonOutput.ActionItems = append(m.AddonOutput.ActionItems, &ActionItem{
+		ResourceNamespace: m.Release.Namespace,
+		ResourceName:      m.Release.Name,
+		Title:             fmt.Sprintf("Upgrade to %s was attempted before", m.AddonOutput.Versions.Upgrade),
+		Description:       fmt.Sprintf("Revisions %s of release %s/%s already had chart version %s", strings.Join(attempts, ", "), m.Release.Namespace, m.Release.Name, m.AddonOutput.Versions.Upgrade),
+		Remediation:       remediation,
+		EventType:         "upgradeAttempted",
+		Severity:          "warning",
+		Category:          "Reliability",
+		Report:            "gonogo",
+	})
+}
+
+// historyOf summarizes revisions, which are sorted oldest first, for an upgrade to target
+func historyOf(revisions []*release.Release, target string) *History {
+	h := &History{Revisions: len(revisions)}
+	for _, r := range revisions {
+		status := releaseStatus(r)
+		rev := revisionOf(r)
+		if status == release.StatusFailed.String() && r.Version > 1 {
+			h.FailedUpgrades = append(h.FailedUpgrades, rev)
+		}
+		if r.Info != nil && strings.HasPrefix(r.Info.Description, "Rollback to ") {
+			h.Rollbacks = append(h.Rollbacks, rev)
+		}
+		if target != "" && sameVersion(chartVersion(r), target) {
+			h.TargetAttempts = append(h.TargetAttempts, rev)
+		}
+	}
+
+	// a deployed revision is the one running, otherwise the latest superseded revision was the last to deploy
+	for _, status := range []release.Status{release.StatusDeployed, release.StatusSuperseded} {
+		for i := len(revisions) - 1; i >= 0 && h.LastKnownGood == nil; i-- {
+			if releaseStatus(revisions[i]) == status.String() {
+				h.LastKnownGood = revisionOf(revisions[i])
+				h.LastKnownGood.Values = revisions[i].Config
+			}
+		}
+	}
+	return h
+}
+
+// revisionOf returns the summary of a revision
+func revisionOf(r *release.Release) *Revision {
+	rev := &Revision{
+		Revision:     r.Version,
+		ChartVersion: chartVersion(r),
+		Status:       releaseStatus(r),
+	}
+	if r.Chart != nil && r.Chart.Metadata != nil {
+		rev.AppVersion = r.Chart.Metadata.AppVersion
+	}
+	if r.Info != nil {
+		rev.Description = r.Info.Description
+		if !r.Info.LastDeployed.IsZero() {
+			rev.Updated = r.Info.LastDeployed.UTC().Format(time.RFC3339)
+		}
+	}
+	return rev
+}
+
+// chartVersion returns the version of the chart of a revision
+func chartVersion(r *release.Release) string {
+	if r.Chart == nil || r.Chart.Metadata == nil {
+		return ""
+	}
+	return r.Chart.Metadata.Version
+}
+
+// sameVersion reports whether two versions are equal, ignoring a v prefix
+func sameVersion(a, b string) bool {
+	va, errA := semver.NewVersion(a)
+	vb, errB := semver.NewVersion(b)
+	if errA != nil || errB != nil {
+		return a == b
+	}
+	return va.Equal(vb)
+}
@@ -0,0 +1,95 @@
+// Copyright 2021 FairwindsOps, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package validate
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/release"
+)
+
+func testRevision(revision int, version string, status release.Status, description string) *release.Release {
+	return &release.Release{
+		Name:      "cert-manager",
+		Namespace: "cert-manager",
+		Version:   revision,
+		Info:      &release.Info{Status: status, Description: description},
+		Chart:     &chart.Chart{Metadata: &chart.Metadata{Name: "cert-manager", Version: version}},
+		Config:    map[string]interface{}{"revision": revision},
+	}
+}
+
+func TestHistoryOf(t *testing.T) {
+	tests := []struct {
+		name              string
+		revisions         []*release.Release
+		target            string
+		wantFailed        []int
+		wantRollbacks     []int
+		wantAttempts      []int
+		wantLastKnownGood int
+	}{
+		{
+			name:              "installed once",
+			revisions:         []*release.Release{testRevision(1, "1.7.0", release.StatusDeployed, "Install complete")},
+			target:            "1.8.0",
+			wantLastKnownGood: 1,
+		},
+		{
+			name: "failed upgrade rolled back",
+			revisions: []*release.Release{
+				testRevision(1, "1.7.0", release.StatusSuperseded, "Install complete"),
+				testRevision(2, "v1.8.0", release.StatusFailed, "Upgrade \"cert-manager\" failed: timed out waiting for the condition"),
+				testRevision(3, "1.7.0", release.StatusDeployed, "Rollback to 1"),
+			},
+			target:            "1.8.0",
+			wantFailed:        []int{2},
+			wantRollbacks:     []int{3},
+			wantAttempts:      []int{2},
+			wantLastKnownGood: 3,
+		},
+		{
+			name: "stuck upgrade",
+			revisions: []*release.Release{
+				testRevision(1, "1.6.0", release.StatusFailed, "Release \"cert-manager\" failed"),
+				testRevision(2, "1.7.0", release.StatusSuperseded, "Upgrade complete"),
+				testRevision(3, "1.8.0", release.StatusPendingUpgrade, "Preparing upgrade"),
+			},
+			target:            "1.9.0",
+			wantLastKnownGood: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := historyOf(tt.revisions, tt.target)
+			assert.Equal(t, len(tt.revisions), got.Revisions)
+			assert.Equal(t, tt.wantFailed, revisionNumbers(got.FailedUpgrades))
+			assert.Equal(t, tt.wantRollbacks, revisionNumbers(got.Rollbacks))
+			assert.Equal(t, tt.wantAttempts, revisionNumbers(got.TargetAttempts))
+			assert.Equal(t, tt.wantLastKnownGood, got.LastKnownGood.Revision)
+			assert.Equal(t, map[string]interface{}{"revision": tt.wantLastKnownGood}, got.LastKnownGood.Values)
+		})
+	}
+}
+
+func revisionNumbers(revisions []*Revision) []int {
+	var numbers []int
+	for _, r := range revisions {
+		numbers = append(numbers, r.Revision)
+	}
+	return numbers
+}
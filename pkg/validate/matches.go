@@ -19,20 +19,35 @@ import (
 
 	"github.com/fairwindsops/gonogo/pkg/bundle"
 	"github.com/fairwindsops/gonogo/pkg/helm"
-	"github.com/thoas/go-funk"
+	"helm.sh/helm/v3/pkg/chart"
 	"helm.sh/helm/v3/pkg/release"
 	"k8s.io/klog"
-
-	"github.com/blang/semver/v4"
 )
 
 // match is a helm release and the bundle config that corresponds to it.
 type match struct {
-	Bundle      *bundle.Bundle
-	Release     *release.Release
+	Bundle  *bundle.Bundle
+	Release *release.Release
+	// Parent is the umbrella release when Release is one of its subcharts
+	Parent      *release.Release
 	AddonOutput *AddonOutput
+	// Plan has one match per hop when the release is upgraded to a target through several bundles
+	Plan []match
+
+	Releases ReleaseSource
+	Cluster  ClusterInfo
 
-	Helm *helm.Helm
+	// unmatched is set for releases that no bundle matches, only their status and deprecated apis are checked
+	unmatched bool
+	// target is the chart the release is upgraded to
+	target *chart.Chart
+	// render and checkCRDs are set when target is rendered and when its crds are compared with the cluster
+	render    bool
+	checkCRDs bool
+	// rendered are the objects of target rendered with the values of the release
+	rendered []map[string]interface{}
+	// changes are the objects that the upgrade to target adds, removes or changes
+	changes []objectChange
 }
 
 // matches is a map of matched bundles+releases where the key is the release name
@@ -43,62 +58,180 @@ func (c *Config) getMatches() (matches, error) {
 	// finalMatches is the map that we use to store matches when we find them
 	finalMatches := matches{}
 
-	config, err := bundle.ReadConfig(c.Bundle)
-	if err != nil {
-		return nil, err
+	config := c.bundles
+	if config == nil {
+		var err error
+		config, err = bundle.NewLoader(c.CacheDir).ReadConfig(c.Bundle)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	err = c.Helm.GetReleasesVersionThree()
+	releases, err := c.Releases.ListReleases()
 	if err != nil {
 		return nil, err
 	}
 
-	for _, release := range c.Helm.Releases {
-		for _, bundle := range config.Addons {
-			if bundle.Source.Chart == release.Chart.Metadata.Name {
-
-				v, err := semver.ParseTolerant(release.Chart.Metadata.Version)
-				if err != nil {
-					klog.Error(err)
-					continue
-				}
-				vStart, err := semver.Make(bundle.Versions.Start)
-				if err != nil {
-					klog.Error(err)
-					continue
-				}
-				vEnd, err := semver.Make(bundle.Versions.End)
-				if err != nil {
-					klog.Error(err)
-					continue
-				}
-
-				if v.GTE(vStart) && v.LT(vEnd) {
-					klog.V(3).Infof("Found match for chart %s in release %s", bundle.Name, release.Name)
-
-					finalMatches[fmt.Sprintf("%s/%s", release.Namespace, release.Name)] = match{
-						Bundle:  bundle,
-						Release: release,
-						AddonOutput: &AddonOutput{
-							Name: release.Name,
-							Versions: OutputVersion{
-								Current: release.Chart.Metadata.Version,
-								Upgrade: bundle.Versions.End,
-							},
-							Notes:    bundle.Notes,
-							Warnings: bundle.Warnings,
-						},
-						Helm: c.Helm,
-					}
-				}
+	var matched []string
+	for _, installed := range releases {
+		installed = c.runningRevision(installed)
+		found := false
+		for _, rel := range append([]*release.Release{installed}, helm.Subcharts(installed)...) {
+			if c.matchRelease(finalMatches, config, rel, installed) {
+				matched = append(matched, fmt.Sprintf("%s/%s", rel.Namespace, rel.Name))
+				found = true
 			}
 		}
+		if !found {
+			finalMatches[fmt.Sprintf("%s/%s", installed.Namespace, installed.Name)] = c.unmatchedRelease(installed)
+		}
 	}
 
-	if len(finalMatches) < 1 {
+	if len(matched) < 1 {
 		klog.Infof("no helm releases matched the bundle config.")
 	} else {
-		klog.Infof("releases that matched the config: %v\n", funk.Keys(finalMatches))
+		klog.Infof("releases that matched the config: %v\n", matched)
 	}
 	return finalMatches, nil
 }
+
+// matchRelease adds the match of a release, or of a subchart of the installed release, to finalMatches and reports
+// whether a bundle matched it
+func (c *Config) matchRelease(finalMatches matches, config *bundle.BundleConfig, rel, installed *release.Release) bool {
+	var parent *release.Release
+	if rel != installed {
+		parent = installed
+	}
+	if target, ok := c.target(rel); ok {
+		m := c.planMatch(config, rel, target)
+		m.Parent = parent
+		m.AddonOutput.DiscoveredBy = c.Releases.ProviderOf(installed.Namespace, installed.Name)
+		finalMatches[fmt.Sprintf("%s/%s", rel.Namespace, rel.Name)] = m
+		return true
+	}
+
+	found := false
+	for _, bundle := range config.Addons {
+		matchedBy, ok, err := bundle.MatchRelease(rel.Chart.Metadata, rel.Name, rel.Namespace)
+		if err != nil {
+			klog.Errorf("unable to compare release %s/%s with bundle %s: %v", rel.Namespace, rel.Name, bundle.Name, err)
+			continue
+		}
+
+		if ok {
+			found = true
+			klog.V(3).Infof("Found match for chart %s in release %s", bundle.Name, rel.Name)
+			bundle = c.withChartBundles(config, bundle, rel.Chart.Metadata, rel.Name, rel.Namespace).ForStatus(releaseStatus(rel))
+
+			finalMatches[fmt.Sprintf("%s/%s", rel.Namespace, rel.Name)] = match{
+				Bundle:  bundle,
+				Release: rel,
+				Parent:  parent,
+				AddonOutput: &AddonOutput{
+					Name: rel.Name,
+					Versions: OutputVersion{
+						Current: rel.Chart.Metadata.Version,
+						Upgrade: bundle.Versions.Target(),
+					},
+					Status:       releaseStatus(rel),
+					DiscoveredBy: c.Releases.ProviderOf(installed.Namespace, installed.Name),
+					MatchedBy:    matchedBy,
+					Notes:        bundle.Notes,
+					Warnings:     append([]string(nil), bundle.Warnings...),
+				},
+				Releases: c.Releases,
+				Cluster:  c.Cluster,
+			}
+		}
+	}
+	return found
+}
+
+// unmatchedRelease returns the match of a release that no bundle matches, for its status and apis to be checked
+func (c *Config) unmatchedRelease(rel *release.Release) match {
+	return match{
+		Release: rel,
+		AddonOutput: &AddonOutput{
+			Name: rel.Name,
+			Versions: OutputVersion{
+				Current: rel.Chart.Metadata.Version,
+			},
+			Status:       releaseStatus(rel),
+			DiscoveredBy: c.Releases.ProviderOf(rel.Namespace, rel.Name),
+		},
+		Releases:  c.Releases,
+		Cluster:   c.Cluster,
+		unmatched: true,
+	}
+}
+
+// target returns the requested upgrade target for a release, looked up by namespace/release and then chart name
+func (c *Config) target(rel *release.Release) (string, bool) {
+	if t, ok := c.Targets[fmt.Sprintf("%s/%s", rel.Namespace, rel.Name)]; ok {
+		return t, true
+	}
+	t, ok := c.Targets[rel.Chart.Metadata.Name]
+	return t, ok
+}
+
+// planMatch chains the bundles for a release up to target and returns a match with one entry in Plan per hop.
+// When there is no upgrade path the match only has an action item explaining why.
+func (c *Config) planMatch(config *bundle.BundleConfig, rel *release.Release, target string) match {
+	m := match{
+		Release: rel,
+		AddonOutput: &AddonOutput{
+			Name: rel.Name,
+			Versions: OutputVersion{
+				Current: rel.Chart.Metadata.Version,
+				Upgrade: target,
+			},
+			Status:       releaseStatus(rel),
+			DiscoveredBy: c.Releases.ProviderOf(rel.Namespace, rel.Name),
+		},
+		Releases: c.Releases,
+		Cluster:  c.Cluster,
+	}
+
+	hops, err := bundle.PlanUpgrade(config.Addons, rel.Chart.Metadata, rel.Name, rel.Namespace, target)
+	if err != nil {
+		klog.V(3).Infof("no upgrade plan for release %s/%s: %v", rel.Namespace, rel.Name, err)
+		m.AddonOutput.ActionItems = append(m.AddonOutput.ActionItems, &ActionItem{
+			ResourceNamespace: rel.Namespace,
+			ResourceName:      rel.Name,
+			Title:             "No upgrade path",
+			Description:       err.Error(),
+			Remediation:       "Add bundles that cover every version between the installed and the target version",
+			EventType:         "noUpgradePath",
+			Severity:          "warning",
+			Category:          "Reliability",
+			Report:            "gonogo",
+		})
+		return m
+	}
+
+	m.AddonOutput.Versions.Upgrade = hops[len(hops)-1].To
+	for _, hop := range hops {
+		klog.V(3).Infof("planned hop for release %s/%s from %s to %s with bundle %s", rel.Namespace, rel.Name, hop.From, hop.To, hop.Bundle.Name)
+		metadata := *rel.Chart.Metadata
+		metadata.Version = hop.From
+		hop.Bundle = c.withChartBundles(config, hop.Bundle, &metadata, rel.Name, rel.Namespace).ForStatus(releaseStatus(rel))
+		m.Plan = append(m.Plan, match{
+			Bundle:  hop.Bundle,
+			Release: rel,
+			AddonOutput: &AddonOutput{
+				Name: hop.Bundle.Name,
+				Versions: OutputVersion{
+					Current: hop.From,
+					Upgrade: hop.To,
+				},
+				MatchedBy: hop.MatchedBy,
+				Status:    releaseStatus(rel),
+				Notes:     hop.Bundle.Notes,
+				Warnings:  append([]string(nil), hop.Bundle.Warnings...),
+			},
+			Releases: c.Releases,
+			Cluster:  c.Cluster,
+		})
+	}
+	return m
+}
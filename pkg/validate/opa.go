@@ -17,36 +17,64 @@ package validate
 import (
 	"bytes"
 	"context"
+	"errors"
+	"fmt"
 	"io"
-	"strings"
 
+	"github.com/fairwindsops/gonogo/pkg/bundle"
 	"github.com/fairwindsops/gonogo/pkg/helm"
 	"github.com/fairwindsops/insights-plugins/plugins/opa/pkg/rego"
 	"gopkg.in/yaml.v3"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	"k8s.io/klog"
 )
 
-var (
-	group    string
-	version  string
-	resource string
-)
-
 // getClusterManifests gets manifests from the cluster not included in helm release
 func (m *match) getClusterManifests() ([]map[string]interface{}, error) {
 	var manifests []map[string]interface{}
 	resources := m.Bundle.Resources
+	if len(resources) == 0 {
+		return nil, nil
+	}
 
-	namespaces := m.Helm.GetNamespaces()
+	namespaces, err := m.Cluster.ScopedNamespaces()
+	if err != nil {
+		return nil, err
+	}
+	if namespaces == nil {
+		namespaces = []string{metav1.NamespaceAll}
+	}
 
-	for _, namespace := range namespaces.Items {
-		ns := namespace.Name
-		for _, r := range resources {
-			splitResourcePath(r)
-			objs, err := m.Helm.GetClusterObjects(group, version, resource, ns)
+	type resourcePath struct{ path, group, version, resource string }
+	var paths []resourcePath
+	for _, r := range resources {
+		group, version, resource, err := bundle.ParseResourcePath(r)
+		if err != nil {
+			m.skip(bundle.FieldOpaChecks, fmt.Sprintf("unable to list %s, opa checks ran without them: %v", r, err))
+			continue
+		}
+		paths = append(paths, resourcePath{path: r, group: group, version: version, resource: resource})
+	}
+
+	for _, ns := range namespaces {
+		for _, p := range paths {
+			r := p.path
+			objs, err := m.Cluster.GetClusterObjects(p.group, p.version, p.resource, ns)
 			if err != nil {
-				klog.Error()
+				if errors.Is(err, helm.ErrNoCluster) {
+					m.skip(bundle.FieldOpaChecks, fmt.Sprintf("unable to list %s, opa checks ran without them: %v", r, err))
+					continue
+				}
+				if helm.IsAccessError(err) {
+					where := "in every namespace"
+					if ns != metav1.NamespaceAll {
+						where = "in namespace " + ns
+					}
+					m.skip(bundle.FieldOpaChecks, fmt.Sprintf("unable to list %s %s, opa checks ran without them: %v", r, where, err))
+					continue
+				}
+				klog.Errorf("unable to list %s in namespace %q: %v", r, ns, err)
 				continue
 			}
 			for _, i := range objs {
@@ -58,7 +86,7 @@ func (m *match) getClusterManifests() ([]map[string]interface{}, error) {
 }
 
 // RunOPAChecks evaluates rego defined in bundle spec against helm charts and cluster objects and returns an error
-func (m *match) runOPAChecks() error {
+func (m *match) runOPAChecks(ctx context.Context) error {
 	if len(m.Bundle.OpaChecks) < 1 {
 		return nil
 	}
@@ -74,10 +102,13 @@ func (m *match) runOPAChecks() error {
 	}
 
 	manifests = append(manifests, clusterManifests...)
+	if m.AddonOutput.ManifestDiff != nil {
+		manifests = append(manifests, m.diffInput())
+	}
 
 	for _, o := range m.Bundle.OpaChecks {
 		for _, y := range manifests {
-			m.addActionItem(o, y)
+			m.addActionItem(ctx, o, y)
 		}
 	}
 
@@ -85,10 +116,13 @@ func (m *match) runOPAChecks() error {
 }
 
 // addActionItem runs rego against manifest using passed in opa check from bundle and appends to actionItems
-func (m *match) addActionItem(o string, y map[string]interface{}) {
-	client := helm.NewHelm()
+func (m *match) addActionItem(ctx context.Context, o string, y map[string]interface{}) {
+	var data rego.KubeDataFunction = rego.NilDataFunction{}
+	if d, ok := m.Cluster.(rego.KubeDataFunction); ok {
+		data = d
+	}
 
-	r, err := rego.RunRegoForItemV2(context.TODO(), o, y, client.Kube, nil)
+	r, err := rego.RunRegoForItemV2(ctx, o, y, data, nil)
 	if err != nil {
 		klog.Error(err)
 	}
@@ -125,6 +159,7 @@ func (m *match) addActionItem(o string, y map[string]interface{}) {
 				actionItem.ResourceNamespace = namespace
 			}
 		}
+		actionItem.Origin = m.Bundle.OriginOf(bundle.FieldOpaChecks, o)
 		m.AddonOutput.ActionItems = append(m.AddonOutput.ActionItems, actionItem)
 	}
 }
@@ -149,19 +184,3 @@ func splitYAML(objects []byte) ([]map[string]interface{}, error) {
 	}
 	return output, nil
 }
-
-// splitResourcePath takes resource string defined in bundle and splits into separate strings to be passed to apiserver so that we can dynamically look up objects
-func splitResourcePath(path string) {
-	rs := strings.SplitAfter(path, "/")
-
-	if len(rs) == 3 {
-		group = rs[0]
-		version = rs[1]
-		resource = rs[2]
-	} else {
-		group = ""
-		version = rs[0]
-		resource = rs[1]
-	}
-
-}
@@ -15,47 +15,55 @@
 package validate
 
 import (
-	"fmt"
 	"testing"
 
+	"github.com/fairwindsops/gonogo/pkg/bundle"
+	"github.com/fairwindsops/gonogo/pkg/helm"
 	"github.com/stretchr/testify/assert"
+	"helm.sh/helm/v3/pkg/chart"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 )
 
-func TestSplitResourcePath(t *testing.T) {
+func TestGetClusterManifests(t *testing.T) {
+	deployment := map[string]interface{}{"apiVersion": "apps/v1", "kind": "Deployment", "metadata": map[string]interface{}{"name": "cert-manager"}}
 	tests := []struct {
-		name    string
-		args    string
-		want    []string
-		wantErr bool
+		name      string
+		resources []string
+		want      []map[string]interface{}
+		skipped   int
 	}{
 		{
-			name:    "test for group version and resource",
-			args:    "apps/v1/deployments",
-			want:    []string{"apps/", "v1/", "deployments"},
-			wantErr: false,
+			name:      "test for group version and resource",
+			resources: []string{"apps/v1/deployments"},
+			want:      []map[string]interface{}{deployment},
 		},
 		{
-			name:    "test version and resource with blank group pass",
-			args:    "v1/secrets",
-			want:    []string{"", "v1/", "secrets"},
-			wantErr: false,
+			name:      "test version and resource with blank group",
+			resources: []string{"v1/secrets"},
+			want:      []map[string]interface{}{deployment},
 		},
 		{
-			name:    "test for version and resource with blank group error",
-			args:    "v1/pods",
-			want:    []string{"v1/", "pods"},
-			wantErr: true,
+			name:      "test resource without a version is skipped",
+			resources: []string{"deployments", "apps/v1/deployments"},
+			want:      []map[string]interface{}{deployment},
+			skipped:   1,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			splitResourcePath(tt.args)
-			if tt.wantErr {
-				err := fmt.Errorf("path not split properly")
-				assert.Error(t, err)
-			} else {
-				assert.NoError(t, nil)
+			m := match{
+				Bundle:      &bundle.Bundle{Resources: tt.resources},
+				Release:     helm.NewOfflineRelease("cert-manager", "cert-manager", &chart.Metadata{Name: "cert-manager", Version: "1.7.1"}, nil, ""),
+				AddonOutput: &AddonOutput{},
+				Cluster:     objectCluster{staticCluster: "v1.27.3", objects: []unstructured.Unstructured{{Object: deployment}}},
+			}
+			got, err := m.getClusterManifests()
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+			assert.Len(t, m.AddonOutput.SkippedChecks, tt.skipped)
+			for _, s := range m.AddonOutput.SkippedChecks {
+				assert.Equal(t, bundle.FieldOpaChecks, s.Check)
 			}
 		})
 	}
@@ -15,16 +15,54 @@
 package validate
 
 type Output struct {
-	Addons []*AddonOutput `yaml:"addons"`
+	Addons            []*AddonOutput `yaml:"addons"`
+	UpgradeConfidence int            `yaml:"upgradeConfidence"` // lowest confidence of the addons
+	Go                bool           `yaml:"go"`                // whether every addon reaches the confidence threshold
+	Explanation       string         `yaml:"explanation"`       // why the upgrade is a go or a no-go
 }
 
 type AddonOutput struct {
-	Name              string        `yaml:"name"`
-	Versions          OutputVersion `yaml:"versions"`
-	UpgradeConfidence int           `yaml:"upgradeConfidence"`
-	ActionItems       []*ActionItem `yaml:"actionItems"`
-	Notes             string        `yaml:"notes"`
-	Warnings          []string      `yaml:"warnings"`
+	Name              string             `yaml:"name"`
+	Versions          OutputVersion      `yaml:"versions"`
+	Status            string             `yaml:"status"`       // status of the latest revision of the helm release
+	DiscoveredBy      string             `yaml:"discoveredBy"` // where the release was found: helm, flux or argocd
+	MatchedBy         []string           `yaml:"matchedBy"`
+	UpgradeConfidence int                `yaml:"upgradeConfidence"` // 100 minus the points of the ConfidenceFactors
+	ConfidenceFactors []ConfidenceFactor `yaml:"confidenceFactors"`
+	Go                bool               `yaml:"go"` // whether UpgradeConfidence reaches the threshold of the scoring
+	ActionItems       []*ActionItem      `yaml:"actionItems"`
+	Notes             string             `yaml:"notes"`
+	Warnings          []string           `yaml:"warnings"`
+	SkippedChecks     []SkippedCheck     `yaml:"skippedChecks"`
+	History           *History           `yaml:"history"`
+	ManifestDiff      *ManifestDiff      `yaml:"manifestDiff"` // how the objects of the release change, when the target chart was rendered
+	Plan              []*AddonOutput     `yaml:"plan"`
+}
+
+// History summarizes the revisions of a release that matter before upgrading it
+type History struct {
+	Revisions      int         `yaml:"revisions"`      // number of revisions kept by helm
+	FailedUpgrades []*Revision `yaml:"failedUpgrades"` // upgrades that failed
+	Rollbacks      []*Revision `yaml:"rollbacks"`      // revisions created by rolling back
+	TargetAttempts []*Revision `yaml:"targetAttempts"` // revisions that already had the chart version being upgraded to
+	LastKnownGood  *Revision   `yaml:"lastKnownGood"`  // latest revision that deployed successfully, the rollback point
+}
+
+// Revision is a revision of a helm release
+type Revision struct {
+	Revision     int                    `yaml:"revision"`
+	ChartVersion string                 `yaml:"chartVersion"`
+	AppVersion   string                 `yaml:"appVersion"`
+	Status       string                 `yaml:"status"`
+	Description  string                 `yaml:"description"`
+	Updated      string                 `yaml:"updated"`
+	Values       map[string]interface{} `yaml:"values,omitempty"` // user supplied values, only set for the last known good revision
+}
+
+// SkippedCheck is a check that could not run, usually because of missing permissions
+type SkippedCheck struct {
+	Check  string `yaml:"check"`
+	Reason string `yaml:"reason"`
 }
 
 type ActionItem struct {
@@ -38,6 +76,8 @@ type ActionItem struct {
 	Severity          string `yaml:"severity"`
 	Category          string `yaml:"category"`
 	Report            string `yaml:"report"`
+	Origin            string `yaml:"origin"` // where the check came from: embedded, chart or user
+	File              string `yaml:"file"`   // file the release was declared in, when checking a repository
 }
 type OutputVersion struct {
 	Current string `yaml:"current"`
@@ -0,0 +1,355 @@
+// Copyright 2021 FairwindsOps, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package validate
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/mitchellh/copystructure"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/engine"
+	"helm.sh/helm/v3/pkg/releaseutil"
+)
+
+// checkManifestDiff is the name of the check that renders the target chart, as reported in SkippedChecks
+const checkManifestDiff = "manifest_diff"
+
+// ManifestDiff is how the objects of a release change when it is upgraded to the target chart
+type ManifestDiff struct {
+	Added   []ResourceChange `yaml:"added"`
+	Removed []ResourceChange `yaml:"removed"`
+	Changed []ResourceChange `yaml:"changed"`
+}
+
+// ResourceChange is an object of a release that an upgrade adds, removes or changes
+type ResourceChange struct {
+	APIVersion string   `yaml:"apiVersion"`
+	Kind       string   `yaml:"kind"`
+	Namespace  string   `yaml:"namespace"`
+	Name       string   `yaml:"name"`
+	Fields     []string `yaml:"fields,omitempty"` // paths of the fields that change, only set for changed objects
+}
+
+// objectChange is an object of the installed manifest and the object of the target manifest that replaces it,
+// current is nil for added objects and target for removed ones
+type objectChange struct {
+	current map[string]interface{}
+	target  map[string]interface{}
+	fields  []string
+}
+
+// renderTarget renders the target chart with the values of the release against the capabilities of the cluster,
+// and diffs the objects with those installed. A chart that does not render is an action item.
+func (m *match) renderTarget(cl cluster) error {
+	if strings.TrimSpace(m.Release.Manifest) == "" {
+		m.skip(checkManifestDiff, "the release has no installed manifest to compare the target chart with")
+		return nil
+	}
+
+	current, err := splitYAML([]byte(m.Release.Manifest))
+	if err != nil {
+		return err
+	}
+	rendered, err := renderChart(m.target, m.releaseName(), m.Release.Namespace, m.Release.Version+1, m.Release.Config, cl)
+	if err != nil {
+		m.AddonOutput.ActionItems = append(m.AddonOutput.ActionItems, &ActionItem{
+			ResourceNamespace: m.Release.Namespace,
+			ResourceName:      m.Release.Name,
+			Title:             "Target chart does not render",
+			Description:       fmt.Sprintf("Chart %s %s can not be rendered with the values of the release: %v", m.target.Name(), m.target.Metadata.Version, err),
+			Remediation:       "Change the values of the release to those the target version of the chart expects",
+			EventType:         "renderFailed",
+			Severity:          "critical",
+			Category:          "Reliability",
+			Report:            "gonogo",
+		})
+		return nil
+	}
+
+	m.rendered = rendered
+	m.changes = diffObjects(current, rendered)
+	m.AddonOutput.ManifestDiff = manifestDiff(m.changes)
+	return nil
+}
+
+// setTarget downloads the chart a match upgrades to when RenderTarget or CheckCRDs is set, for runChecks to render
+// it and compare its crds
+func (c *Config) setTarget(m *match) {
+	if !c.RenderTarget && !c.CheckCRDs || m.Bundle.Source.Repository == "" {
+		return
+	}
+	ch, err := c.targetChart(m.Bundle)
+	if err != nil {
+		reason := fmt.Sprintf("unable to download chart %s %s: %v", m.Bundle.Source.Chart, m.Bundle.Versions.Target(), err)
+		if c.RenderTarget {
+			m.skip(checkManifestDiff, reason)
+		}
+		if c.CheckCRDs {
+			m.skip(checkCRDs, reason)
+		}
+		return
+	}
+	m.target = ch
+	m.render = c.RenderTarget
+	m.checkCRDs = c.CheckCRDs
+}
+
+// releaseName is the name helm renders the release with, that of the umbrella release for a subchart
+func (m *match) releaseName() string {
+	if m.Parent != nil {
+		return m.Parent.Name
+	}
+	return m.Release.Name
+}
+
+// renderChart renders the objects of a chart the way helm upgrade does, hooks and notes excluded
+func renderChart(ch *chart.Chart, name, namespace string, revision int, values map[string]interface{}, cl cluster) ([]map[string]interface{}, error) {
+	// helm changes the charts and values it renders, ch is shared by the releases upgraded to it
+	ch, err := copyChart(ch)
+	if err != nil {
+		return nil, err
+	}
+	copied, err := copystructure.Copy(values)
+	if err != nil {
+		return nil, err
+	}
+	values, _ = copied.(map[string]interface{})
+
+	caps := chartutil.DefaultCapabilities.Copy()
+	if cl.version != nil {
+		caps.KubeVersion = chartutil.KubeVersion{Version: cl.version.GitVersion, Major: cl.version.Major, Minor: cl.version.Minor}
+	}
+	if len(cl.apiVersions) > 0 {
+		caps.APIVersions = chartutil.VersionSet(cl.apiVersions)
+	}
+
+	if err := chartutil.ProcessDependencies(ch, values); err != nil {
+		return nil, err
+	}
+	options := chartutil.ReleaseOptions{Name: name, Namespace: namespace, Revision: revision, IsUpgrade: true}
+	renderValues, err := chartutil.ToRenderValues(ch, values, options, caps)
+	if err != nil {
+		return nil, err
+	}
+	files, err := engine.Render(ch, renderValues)
+	if err != nil {
+		return nil, err
+	}
+	for file := range files {
+		if strings.HasSuffix(file, "NOTES.txt") {
+			delete(files, file)
+		}
+	}
+
+	_, manifests, err := releaseutil.SortManifests(files, caps.APIVersions, releaseutil.InstallOrder)
+	if err != nil {
+		return nil, err
+	}
+	var objects []map[string]interface{}
+	for _, manifest := range manifests {
+		objs, err := splitYAML([]byte(manifest.Content))
+		if err != nil {
+			return nil, fmt.Errorf("unable to read %s: %w", manifest.Name, err)
+		}
+		objects = append(objects, objs...)
+	}
+	return objects, nil
+}
+
+// copyChart returns a deep copy of a chart and its dependencies
+func copyChart(ch *chart.Chart) (*chart.Chart, error) {
+	out := *ch
+	metadata, err := copystructure.Copy(ch.Metadata)
+	if err != nil {
+		return nil, err
+	}
+	out.Metadata = metadata.(*chart.Metadata)
+	values, err := copystructure.Copy(ch.Values)
+	if err != nil {
+		return nil, err
+	}
+	out.Values, _ = values.(map[string]interface{})
+
+	var dependencies []*chart.Chart
+	for _, d := range ch.Dependencies() {
+		dc, err := copyChart(d)
+		if err != nil {
+			return nil, err
+		}
+		dependencies = append(dependencies, dc)
+	}
+	out.SetDependencies(dependencies...)
+	return &out, nil
+}
+
+// diffObjects pairs the installed objects with the target ones by group, kind, namespace and name, the version of
+// their api may change. Changed and added objects are in the order of target, removed ones follow.
+func diffObjects(current, target []map[string]interface{}) []objectChange {
+	installed := map[string]map[string]interface{}{}
+	for _, obj := range current {
+		if key, ok := objectKey(obj); ok {
+			installed[key] = obj
+		}
+	}
+
+	var changes []objectChange
+	seen := map[string]bool{}
+	for _, obj := range target {
+		key, ok := objectKey(obj)
+		if !ok || seen[key] {
+			continue
+		}
+		seen[key] = true
+		cur, ok := installed[key]
+		if !ok {
+			changes = append(changes, objectChange{target: obj})
+			continue
+		}
+		var fields []string
+		changedFields("", cur, obj, &fields)
+		if len(fields) > 0 {
+			changes = append(changes, objectChange{current: cur, target: obj, fields: fields})
+		}
+	}
+	for _, obj := range current {
+		key, ok := objectKey(obj)
+		if !ok || seen[key] {
+			continue
+		}
+		seen[key] = true
+		changes = append(changes, objectChange{current: obj})
+	}
+	return changes
+}
+
+// objectKey identifies an object across versions of its api, objects without a kind or a name have none
+func objectKey(obj map[string]interface{}) (string, bool) {
+	kind, _ := obj["kind"].(string)
+	metadata, _ := obj["metadata"].(map[string]interface{})
+	name, _ := metadata["name"].(string)
+	if kind == "" || name == "" {
+		return "", false
+	}
+	namespace, _ := metadata["namespace"].(string)
+	apiVersion, _ := obj["apiVersion"].(string)
+	group := ""
+	if i := strings.LastIndex(apiVersion, "/"); i >= 0 {
+		group = apiVersion[:i]
+	}
+	return strings.Join([]string{group, kind, namespace, name}, "/"), true
+}
+
+// changedFields appends the paths of the fields that differ between a and b. Lists are compared item by item when
+// they have the same length, and as a whole otherwise.
+func changedFields(path string, a, b interface{}, fields *[]string) {
+	am, aok := a.(map[string]interface{})
+	bm, bok := b.(map[string]interface{})
+	if aok && bok {
+		keys := map[string]bool{}
+		for k := range am {
+			keys[k] = true
+		}
+		for k := range bm {
+			keys[k] = true
+		}
+		sorted := make([]string, 0, len(keys))
+		for k := range keys {
+			sorted = append(sorted, k)
+		}
+		sort.Strings(sorted)
+		for _, k := range sorted {
+			p := k
+			if path != "" {
+				p = path + "." + k
+			}
+			changedFields(p, am[k], bm[k], fields)
+		}
+		return
+	}
+
+	al, aok := a.([]interface{})
+	bl, bok := b.([]interface{})
+	if aok && bok && len(al) == len(bl) {
+		for i := range al {
+			changedFields(fmt.Sprintf("%s[%d]", path, i), al[i], bl[i], fields)
+		}
+		return
+	}
+
+	if !reflect.DeepEqual(a, b) {
+		*fields = append(*fields, path)
+	}
+}
+
+// manifestDiff summarizes the changes of the objects of a release
+func manifestDiff(changes []objectChange) *ManifestDiff {
+	d := &ManifestDiff{}
+	for _, c := range changes {
+		switch {
+		case c.current == nil:
+			d.Added = append(d.Added, resourceChange(c.target, nil))
+		case c.target == nil:
+			d.Removed = append(d.Removed, resourceChange(c.current, nil))
+		default:
+			d.Changed = append(d.Changed, resourceChange(c.target, c.fields))
+		}
+	}
+	return d
+}
+
+func resourceChange(obj map[string]interface{}, fields []string) ResourceChange {
+	metadata, _ := obj["metadata"].(map[string]interface{})
+	r := ResourceChange{Fields: fields}
+	r.APIVersion, _ = obj["apiVersion"].(string)
+	r.Kind, _ = obj["kind"].(string)
+	r.Namespace, _ = metadata["namespace"].(string)
+	r.Name, _ = metadata["name"].(string)
+	return r
+}
+
+// diffInput is the document opa checks are evaluated against for the changes of a release, its kind is
+// ManifestDiff. added and removed list the objects, changed lists the current and target objects with the paths
+// of their fields that change.
+func (m *match) diffInput() map[string]interface{} {
+	added, removed, changed := []interface{}{}, []interface{}{}, []interface{}{}
+	for _, c := range m.changes {
+		switch {
+		case c.current == nil:
+			added = append(added, c.target)
+		case c.target == nil:
+			removed = append(removed, c.current)
+		default:
+			fields := make([]interface{}, 0, len(c.fields))
+			for _, f := range c.fields {
+				fields = append(fields, f)
+			}
+			changed = append(changed, map[string]interface{}{"current": c.current, "target": c.target, "fields": fields})
+		}
+	}
+	return map[string]interface{}{
+		"kind": "ManifestDiff",
+		"metadata": map[string]interface{}{
+			"name":      m.Release.Name,
+			"namespace": m.Release.Namespace,
+		},
+		"added":   added,
+		"removed": removed,
+		"changed": changed,
+	}
+}
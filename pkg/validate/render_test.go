@@ -0,0 +1,209 @@
+// Copyright 2021 FairwindsOps, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package validate
+
+import (
+	"context"
+	"testing"
+
+	"github.com/fairwindsops/gonogo/pkg/helm"
+	"github.com/stretchr/testify/assert"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/release"
+)
+
+const renderManifest = `---
+# Source: cert-manager/templates/deployment.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: cert-manager
+spec:
+  replicas: 2
+  template:
+    spec:
+      containers:
+        - name: controller
+          image: quay.io/jetstack/cert-manager-controller:v1.7.1
+---
+# Source: cert-manager/templates/configmap.yaml
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: cert-manager
+data:
+  mode: legacy
+`
+
+// renderTestChart returns the chart of cert-manager 1.8.0 as far as the tests are concerned
+func renderTestChart() *chart.Chart {
+	return &chart.Chart{
+		Metadata: &chart.Metadata{APIVersion: "v2", Name: "cert-manager", Version: "1.8.0", AppVersion: "v1.8.0"},
+		Values:   map[string]interface{}{"replicaCount": 1},
+		Templates: []*chart.File{
+			{Name: "templates/deployment.yaml", Data: []byte(`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: {{ .Release.Name }}
+  annotations:
+    kubernetes: {{ .Capabilities.KubeVersion.Version }}
+spec:
+  replicas: {{ .Values.replicaCount }}
+  template:
+    spec:
+      containers:
+        - name: controller
+          image: quay.io/jetstack/cert-manager-controller:{{ .Chart.AppVersion }}
+`)},
+			{Name: "templates/service.yaml", Data: []byte(`apiVersion: v1
+kind: Service
+metadata:
+  name: {{ .Release.Name }}
+  namespace: {{ .Release.Namespace }}
+`)},
+			{Name: "templates/hook.yaml", Data: []byte(`apiVersion: batch/v1
+kind: Job
+metadata:
+  name: {{ .Release.Name }}-upgrade
+  annotations:
+    helm.sh/hook: pre-upgrade
+`)},
+			{Name: "templates/issuer.yaml", Data: []byte(`{{- if .Values.issuer }}
+apiVersion: cert-manager.io/v1
+kind: Issuer
+metadata:
+  name: {{ required "issuer.name is required" .Values.issuer.name }}
+{{- end }}
+`)},
+			{Name: "templates/NOTES.txt", Data: []byte("cert-manager {{ .Chart.AppVersion }} has been upgraded")},
+		},
+	}
+}
+
+func TestValidateRenderTarget(t *testing.T) {
+	tests := []struct {
+		name       string
+		values     map[string]interface{}
+		wantDiff   *ManifestDiff
+		wantTitles []string
+	}{
+		{
+			name:   "renders",
+			values: map[string]interface{}{"replicaCount": 2},
+			wantDiff: &ManifestDiff{
+				Added:   []ResourceChange{{APIVersion: "v1", Kind: "Service", Namespace: "cert-manager", Name: "cert-manager"}},
+				Removed: []ResourceChange{{APIVersion: "v1", Kind: "ConfigMap", Name: "cert-manager"}},
+				Changed: []ResourceChange{{
+					APIVersion: "apps/v1",
+					Kind:       "Deployment",
+					Name:       "cert-manager",
+					Fields:     []string{"metadata.annotations", "spec.template.spec.containers[0].image"},
+				}},
+			},
+			wantTitles: []string{"ConfigMap cert-manager is removed"},
+		},
+		{
+			name:       "does not render",
+			values:     map[string]interface{}{"issuer": map[string]interface{}{"kind": "ClusterIssuer"}},
+			wantTitles: []string{"Target chart does not render"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rel := helm.NewOfflineRelease("cert-manager", "cert-manager", &chart.Metadata{Name: "cert-manager", Version: "1.7.1"}, tt.values, renderManifest)
+			h, err := helm.NewOfflineHelm([]*release.Release{rel}, "1.27.3", []string{"apps/v1"})
+			assert.NoError(t, err)
+
+			target := renderTestChart()
+			c := &Config{
+				Releases:     h,
+				Cluster:      h,
+				Bundle:       []string{"testdata/render.yaml"},
+				CacheDir:     t.TempDir(),
+				RenderTarget: true,
+				charts:       map[string]loadedChart{"https://charts.jetstack.io/cert-manager-1.8.0": {chart: target}},
+			}
+			o, err := c.Validate(context.Background())
+			assert.NoError(t, err)
+			assert.Len(t, o.Addons, 1)
+			assert.Equal(t, tt.wantDiff, o.Addons[0].ManifestDiff)
+			var titles []string
+			for _, ai := range o.Addons[0].ActionItems {
+				titles = append(titles, ai.Title)
+			}
+			assert.Equal(t, tt.wantTitles, titles)
+			// the chart is shared by the releases upgraded to it and must not be changed by rendering
+			assert.Equal(t, renderTestChart(), target)
+		})
+	}
+}
+
+func TestValidateRenderTargetSkipped(t *testing.T) {
+	rel := helm.NewOfflineRelease("cert-manager", "cert-manager", &chart.Metadata{Name: "cert-manager", Version: "1.7.1"}, nil, "")
+	h, err := helm.NewOfflineHelm([]*release.Release{rel}, "1.27.3", []string{"apps/v1"})
+	assert.NoError(t, err)
+
+	c := &Config{
+		Releases:     h,
+		Cluster:      h,
+		Bundle:       []string{"testdata/render.yaml"},
+		CacheDir:     t.TempDir(),
+		RenderTarget: true,
+		charts:       map[string]loadedChart{"https://charts.jetstack.io/cert-manager-1.8.0": {chart: renderTestChart()}},
+	}
+	o, err := c.Validate(context.Background())
+	assert.NoError(t, err)
+	assert.Nil(t, o.Addons[0].ManifestDiff)
+	assert.Equal(t, []SkippedCheck{{Check: checkManifestDiff, Reason: "the release has no installed manifest to compare the target chart with"}}, o.Addons[0].SkippedChecks)
+}
+
+func TestChangedFields(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b interface{}
+		want []string
+	}{
+		{
+			name: "equal",
+			a:    map[string]interface{}{"spec": map[string]interface{}{"replicas": 1}},
+			b:    map[string]interface{}{"spec": map[string]interface{}{"replicas": 1}},
+		},
+		{
+			name: "nested value, added and removed keys",
+			a:    map[string]interface{}{"spec": map[string]interface{}{"replicas": 1, "paused": true}},
+			b:    map[string]interface{}{"spec": map[string]interface{}{"replicas": 2, "strategy": "Recreate"}},
+			want: []string{"spec.paused", "spec.replicas", "spec.strategy"},
+		},
+		{
+			name: "list items",
+			a:    map[string]interface{}{"args": []interface{}{"--a", "--b"}},
+			b:    map[string]interface{}{"args": []interface{}{"--a", "--c"}},
+			want: []string{"args[1]"},
+		},
+		{
+			name: "list length",
+			a:    map[string]interface{}{"args": []interface{}{"--a"}},
+			b:    map[string]interface{}{"args": []interface{}{"--a", "--c"}},
+			want: []string{"args"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var fields []string
+			changedFields("", tt.a, tt.b, &fields)
+			assert.Equal(t, tt.want, fields)
+		})
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/fairwindsops/gonogo/pkg/bundle"
 	"helm.sh/helm/v3/pkg/chartutil"
 	"k8s.io/klog"
 )
@@ -43,6 +44,7 @@ func (m *match) validateValues() error {
 					Severity:          "warning",
 					Category:          "Reliability",
 					Report:            "gonogo",
+					Origin:            m.Bundle.OriginOf(bundle.FieldValuesSchema, ""),
 				})
 				return nil
 			}
@@ -53,7 +55,7 @@ func (m *match) validateValues() error {
 		return nil
 	}
 
-	repoSchema, err := fetchJSONSchema(m.Bundle.Source.Repository, m.Bundle.Versions.End, m.Bundle.Source.Chart)
+	repoSchema, err := fetchJSONSchema(m.Bundle.Source.Repository, m.Bundle.Versions.Target(), m.Bundle.Source.Chart)
 	if err != nil {
 		m.AddonOutput.Warnings = append(m.AddonOutput.Warnings, "no schema available, unable to validate release")
 		klog.V(3).Infof("no schema found for release %v", m.Release.Name)
@@ -75,6 +77,7 @@ func (m *match) validateValues() error {
 				Severity:          "warning",
 				Category:          "Reliability",
 				Report:            "gonogo",
+				Origin:            bundle.OriginChart,
 			})
 			return nil
 		}
@@ -0,0 +1,187 @@
+// Copyright 2021 FairwindsOps, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package validate
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Scoring holds the weights UpgradeConfidence is computed with. Every addon starts with a confidence of 100 and
+// loses the weight of each of its findings, down to 0.
+type Scoring struct {
+	// Severities is the weight of an action item by its severity, unknown severities weigh as much as warning
+	Severities map[string]float64 `json:"severities"`
+	// NumericSeverity is the weight of an action item with a severity of 1, opa checks set severities between 0 and 1
+	NumericSeverity float64 `json:"numericSeverity"`
+	// EventTypes is the weight of an action item by its event type, it takes precedence over the severity
+	EventTypes map[string]float64 `json:"eventTypes"`
+	// Categories multiply the weight of action items by their category, 1 when the category is not listed
+	Categories map[string]float64 `json:"categories"`
+	// Warning is the weight of each warning of the bundle
+	Warning float64 `json:"warning"`
+	// SkippedCheck is the weight of each check that could not run
+	SkippedCheck float64 `json:"skippedCheck"`
+	// Threshold is the confidence an addon needs to be a go
+	Threshold int `json:"threshold"`
+}
+
+// DefaultScoring returns the weights used when no scoring file is given
+func DefaultScoring() *Scoring {
+	return &Scoring{
+		Severities: map[string]float64{
+			"critical": 50,
+			"danger":   40,
+			"high":     40,
+			"warning":  15,
+			"medium":   15,
+			"low":      5,
+			"info":     0,
+		},
+		NumericSeverity: 50,
+		EventTypes: map[string]float64{
+			"unsupportedClusterVersion": 60,
+			"apiVersionUnavailable":     60,
+			"apiRemoved":                60,
+			"apiDeprecated":             10,
+			"crdStoredVersionRemoved":   60,
+			"noUpgradePath":             40,
+			"renderFailed":              50,
+			"schemaValidationFailed":    30,
+			"releaseFailed":             25,
+			"releasePending":            30,
+			"releaseNotDeployed":        10,
+			"upgradeAttempted":          15,
+		},
+		Categories: map[string]float64{
+			"Reliability": 1,
+			"Security":    1,
+			"Efficiency":  0.5,
+		},
+		Warning:      3,
+		SkippedCheck: 5,
+		Threshold:    70,
+	}
+}
+
+// ReadScoring reads a scoring file. The weights it sets replace the default ones, the others are kept.
+func ReadScoring(path string) (*Scoring, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	s := DefaultScoring()
+	if err := yaml.UnmarshalStrict(data, s); err != nil {
+		return nil, fmt.Errorf("unable to read scoring file %s: %w", path, err)
+	}
+	if s.Threshold < 0 || s.Threshold > 100 {
+		return nil, fmt.Errorf("threshold of scoring file %s must be between 0 and 100", path)
+	}
+	return s, nil
+}
+
+// ConfidenceFactor is a finding that lowered the upgrade confidence of an addon
+type ConfidenceFactor struct {
+	Reason string  `yaml:"reason"`
+	Points float64 `yaml:"points"` // points taken off the confidence
+}
+
+// score sets the UpgradeConfidence of an addon from its action items, warnings and skipped checks and those of the
+// hops of its plan, along with the factors it was derived from and whether it reaches the threshold
+func (s *Scoring) score(a *AddonOutput) {
+	a.ConfidenceFactors = nil
+	s.addFactors(a, a, "")
+	for _, hop := range a.Plan {
+		s.addFactors(a, hop, fmt.Sprintf("hop %s to %s: ", hop.Versions.Current, hop.Versions.Upgrade))
+	}
+
+	total := 0.0
+	for _, f := range a.ConfidenceFactors {
+		total += f.Points
+	}
+	a.UpgradeConfidence = int(math.Max(0, math.Round(100-total)))
+	a.Go = a.UpgradeConfidence >= s.Threshold
+}
+
+// addFactors adds the points of the action items, warnings and skipped checks of findings to a, findings is a
+// itself or one of the hops of its plan
+func (s *Scoring) addFactors(a, findings *AddonOutput, prefix string) {
+	for _, ai := range findings.ActionItems {
+		weight, how := s.actionItemWeight(ai)
+		a.addFactor(fmt.Sprintf("%saction item %q, %s", prefix, ai.Title, how), weight)
+	}
+	for _, w := range findings.Warnings {
+		a.addFactor(fmt.Sprintf("%swarning %q", prefix, w), s.Warning)
+	}
+	for _, sc := range findings.SkippedChecks {
+		a.addFactor(fmt.Sprintf("%sskipped check %s", prefix, sc.Check), s.SkippedCheck)
+	}
+}
+
+// actionItemWeight returns the weight of an action item and how it was found
+func (s *Scoring) actionItemWeight(ai *ActionItem) (float64, string) {
+	var weight float64
+	var how string
+	if w, ok := s.EventTypes[ai.EventType]; ok && ai.EventType != "" {
+		weight, how = w, "event type "+ai.EventType
+	} else if n, err := strconv.ParseFloat(ai.Severity, 64); err == nil {
+		weight, how = n*s.NumericSeverity, "severity "+ai.Severity
+	} else if w, ok := s.Severities[strings.ToLower(ai.Severity)]; ok {
+		weight, how = w, "severity "+ai.Severity
+	} else {
+		weight, how = s.Severities["warning"], "unknown severity weighs as warning"
+	}
+
+	if m, ok := s.Categories[ai.Category]; ok && m != 1 {
+		weight *= m
+		how += fmt.Sprintf(", category %s x%g", ai.Category, m)
+	}
+	return weight, how
+}
+
+func (a *AddonOutput) addFactor(reason string, points float64) {
+	if points == 0 {
+		return
+	}
+	a.ConfidenceFactors = append(a.ConfidenceFactors, ConfidenceFactor{Reason: reason, Points: math.Round(points*10) / 10})
+}
+
+// decide sets the overall confidence and go/no-go of the output from those of its addons
+func (s *Scoring) decide(o *Output) {
+	o.UpgradeConfidence = 100
+	o.Go = true
+	var nogo []string
+	for _, a := range o.Addons {
+		if a.UpgradeConfidence < o.UpgradeConfidence {
+			o.UpgradeConfidence = a.UpgradeConfidence
+		}
+		if !a.Go {
+			o.Go = false
+			nogo = append(nogo, fmt.Sprintf("%s (%d)", a.Name, a.UpgradeConfidence))
+		}
+	}
+	sort.Strings(nogo)
+	if o.Go {
+		o.Explanation = fmt.Sprintf("go: every addon reaches the confidence threshold of %d", s.Threshold)
+		return
+	}
+	o.Explanation = fmt.Sprintf("no-go: %d of %d addons are under the confidence threshold of %d: %s", len(nogo), len(o.Addons), s.Threshold, strings.Join(nogo, ", "))
+}
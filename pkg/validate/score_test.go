@@ -0,0 +1,125 @@
+// Copyright 2021 FairwindsOps, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package validate
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScore(t *testing.T) {
+	tests := []struct {
+		name        string
+		addon       AddonOutput
+		want        int
+		wantGo      bool
+		wantFactors []ConfidenceFactor
+	}{
+		{
+			name:   "nothing found",
+			want:   100,
+			wantGo: true,
+		},
+		{
+			name: "opa check with a numeric severity",
+			addon: AddonOutput{ActionItems: []*ActionItem{
+				{Title: "old annotation", Severity: "0.1", Category: "Reliability"},
+				{Title: "requests", Severity: "0.4", Category: "Efficiency"},
+			}},
+			want:   85,
+			wantGo: true,
+			wantFactors: []ConfidenceFactor{
+				{Reason: `action item "old annotation", severity 0.1`, Points: 5},
+				{Reason: `action item "requests", severity 0.4, category Efficiency x0.5`, Points: 10},
+			},
+		},
+		{
+			name: "event type over severity",
+			addon: AddonOutput{
+				ActionItems:   []*ActionItem{{Title: "Unsupported cluster version", EventType: "unsupportedClusterVersion", Severity: "critical", Category: "Reliability"}},
+				Warnings:      []string{"read the changelog"},
+				SkippedChecks: []SkippedCheck{{Check: "opa_checks"}},
+			},
+			want:   32,
+			wantGo: false,
+			wantFactors: []ConfidenceFactor{
+				{Reason: `action item "Unsupported cluster version", event type unsupportedClusterVersion`, Points: 60},
+				{Reason: `warning "read the changelog"`, Points: 3},
+				{Reason: "skipped check opa_checks", Points: 5},
+			},
+		},
+		{
+			name: "never under 0",
+			addon: AddonOutput{ActionItems: []*ActionItem{
+				{Title: "a", Severity: "critical"}, {Title: "b", Severity: "critical"}, {Title: "c", Severity: "unheard of"},
+			}},
+			want:   0,
+			wantGo: false,
+			wantFactors: []ConfidenceFactor{
+				{Reason: `action item "a", severity critical`, Points: 50},
+				{Reason: `action item "b", severity critical`, Points: 50},
+				{Reason: `action item "c", unknown severity weighs as warning`, Points: 15},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := tt.addon
+			DefaultScoring().score(&a)
+			assert.Equal(t, tt.want, a.UpgradeConfidence)
+			assert.Equal(t, tt.wantGo, a.Go)
+			assert.Equal(t, tt.wantFactors, a.ConfidenceFactors)
+		})
+	}
+}
+
+func TestDecide(t *testing.T) {
+	s := DefaultScoring()
+	o := &Output{}
+	s.decide(o)
+	assert.Equal(t, 100, o.UpgradeConfidence)
+	assert.True(t, o.Go)
+
+	o = &Output{Addons: []*AddonOutput{
+		{Name: "cert-manager", UpgradeConfidence: 40},
+		{Name: "ingress", UpgradeConfidence: 90, Go: true},
+	}}
+	s.decide(o)
+	assert.Equal(t, 40, o.UpgradeConfidence)
+	assert.False(t, o.Go)
+	assert.Equal(t, "no-go: 1 of 2 addons are under the confidence threshold of 70: cert-manager (40)", o.Explanation)
+}
+
+func TestReadScoring(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "scoring.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte("threshold: 50\nseverities:\n  warning: 20\ncategories:\n  Security: 2\n"), 0644))
+	s, err := ReadScoring(path)
+	assert.NoError(t, err)
+	assert.Equal(t, 50, s.Threshold)
+	assert.Equal(t, 20.0, s.Severities["warning"])
+	assert.Equal(t, 50.0, s.Severities["critical"])
+	assert.Equal(t, 2.0, s.Categories["Security"])
+	assert.Equal(t, 1.0, s.Categories["Reliability"])
+
+	for _, invalid := range []string{"threshold: 120\n", "thresold: 50\n"} {
+		assert.NoError(t, os.WriteFile(path, []byte(invalid), 0644))
+		_, err = ReadScoring(path)
+		assert.Error(t, err, invalid)
+	}
+}
@@ -0,0 +1,131 @@
+// Copyright 2021 FairwindsOps, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package validate
+
+import (
+	"fmt"
+
+	"github.com/fairwindsops/gonogo/pkg/helm"
+	"helm.sh/helm/v3/pkg/release"
+)
+
+// statusAdvice explains a release status that needs attention before upgrading
+type statusAdvice struct {
+	title       string
+	description string // formatted with the namespace and name of the release and its revision
+	remediation string // formatted with the name and namespace of the release
+	eventType   string
+}
+
+// statusAdvices has advice for every release status other than deployed and uninstalled
+var statusAdvices = map[release.Status]statusAdvice{
+	release.StatusFailed: {
+		title:       "Release is in a failed state",
+		description: "The last operation on release %s/%s failed at revision %d, the objects in the cluster may not match any revision",
+		remediation: "Find the cause of the failure with helm history %[1]s -n %[2]s. Roll back to the last deployed revision with helm rollback %[1]s -n %[2]s when it was healthy, or fix the cause and retry the upgrade",
+		eventType:   "releaseFailed",
+	},
+	release.StatusPendingInstall: {
+		title:       "Release install is stuck",
+		description: "Release %s/%s has been pending install since revision %d, helm will refuse to upgrade it",
+		remediation: "Make sure no helm operation on the release is still running. A pending install can not be rolled back, uninstall it with helm uninstall %[1]s -n %[2]s and install it again",
+		eventType:   "releasePending",
+	},
+	release.StatusPendingUpgrade: {
+		title:       "Release upgrade is stuck",
+		description: "Release %s/%s has been pending upgrade since revision %d, helm will refuse to upgrade it",
+		remediation: "Make sure no helm operation on the release is still running, then roll back to the last deployed revision with helm rollback %[1]s -n %[2]s and retry the upgrade",
+		eventType:   "releasePending",
+	},
+	release.StatusPendingRollback: {
+		title:       "Release rollback is stuck",
+		description: "Release %s/%s has been pending rollback since revision %d, helm will refuse to upgrade it",
+		remediation: "Make sure no helm operation on the release is still running, then retry the rollback with helm rollback %[1]s -n %[2]s",
+		eventType:   "releasePending",
+	},
+	release.StatusUninstalling: {
+		title:       "Release uninstall is stuck",
+		description: "Release %s/%s has been uninstalling since revision %d",
+		remediation: "Make sure no helm operation on the release is still running, then retry the uninstall with helm uninstall %[1]s -n %[2]s instead of upgrading",
+		eventType:   "releasePending",
+	},
+	release.StatusSuperseded: {
+		title:       "Release has no deployed revision",
+		description: "The latest revision of release %s/%s is superseded at revision %d, no revision is marked as deployed",
+		remediation: "Roll back to the revision that should be running with helm rollback %[1]s <revision> -n %[2]s, or upgrade the release again",
+		eventType:   "releaseNotDeployed",
+	},
+	release.StatusUnknown: {
+		title:       "Release status is unknown",
+		description: "The status of release %s/%s at revision %d is unknown",
+		remediation: "Check the release with helm status %[1]s -n %[2]s and helm history %[1]s -n %[2]s before upgrading",
+		eventType:   "releaseNotDeployed",
+	},
+}
+
+// releaseStatus returns the status of a release
+func releaseStatus(rel *release.Release) string {
+	if rel.Info == nil {
+		return ""
+	}
+	return rel.Info.Status.String()
+}
+
+// runningRevision returns the release bundles are matched against. When the latest revision failed or is pending,
+// the objects in the cluster are still those of the last deployed revision, so its chart, values and manifest are
+// used with the revision number and status of the latest one.
+func (c *Config) runningRevision(rel *release.Release) *release.Release {
+	if rel.Info == nil || (rel.Info.Status != release.StatusFailed && !rel.Info.Status.IsPending()) {
+		return rel
+	}
+	revisions := c.Releases.History(rel.Namespace, rel.Name)
+	for i := len(revisions) - 1; i >= 0; i-- {
+		r := revisions[i]
+		if r.Version >= rel.Version || r.Info == nil || r.Info.Status != release.StatusDeployed || r.Chart == nil || r.Chart.Metadata == nil {
+			continue
+		}
+		running := *r
+		running.Info = rel.Info
+		running.Version = rel.Version
+		return &running
+	}
+	return rel
+}
+
+// validateStatus adds an action item when the release is not deployed
+func (m *match) validateStatus() {
+	if m.Release.Info == nil {
+		return
+	}
+	advice, ok := statusAdvices[m.Release.Info.Status]
+	if !ok {
+		return
+	}
+	remediation := fmt.Sprintf(advice.remediation, m.Release.Name, m.Release.Namespace)
+	if p := m.AddonOutput.DiscoveredBy; p != "" && p != helm.ProviderHelm {
+		remediation = fmt.Sprintf("The release is managed by %s. Fix the cause in the source it reconciles from and let it retry, rather than changing the release with helm", p)
+	}
+	m.AddonOutput.ActionItems = append(m.AddonOutput.ActionItems, &ActionItem{
+		ResourceNamespace: m.Release.Namespace,
+		ResourceName:      m.Release.Name,
+		Title:             advice.title,
+		Description:       fmt.Sprintf(advice.description, m.Release.Namespace, m.Release.Name, m.Release.Version),
+		Remediation:       remediation,
+		EventType:         advice.eventType,
+		Severity:          "warning",
+		Category:          "Reliability",
+		Report:            "gonogo",
+	})
+}
@@ -0,0 +1,94 @@
+// Copyright 2021 FairwindsOps, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package validate
+
+import (
+	"context"
+	"testing"
+
+	"github.com/fairwindsops/gonogo/pkg/helm"
+	"github.com/stretchr/testify/assert"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/release"
+)
+
+func TestValidateStatus(t *testing.T) {
+	tests := []struct {
+		status      release.Status
+		wantTitle   string
+		remediation string
+	}{
+		{status: release.StatusDeployed},
+		{status: release.StatusFailed, wantTitle: "Release is in a failed state", remediation: "helm rollback cert-manager -n cert-manager"},
+		{status: release.StatusPendingInstall, wantTitle: "Release install is stuck", remediation: "helm uninstall cert-manager -n cert-manager"},
+		{status: release.StatusPendingUpgrade, wantTitle: "Release upgrade is stuck", remediation: "helm rollback cert-manager -n cert-manager"},
+		{status: release.StatusSuperseded, wantTitle: "Release has no deployed revision", remediation: "helm rollback cert-manager <revision> -n cert-manager"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.status.String(), func(t *testing.T) {
+			m := match{
+				Release:     &release.Release{Name: "cert-manager", Namespace: "cert-manager", Version: 4, Info: &release.Info{Status: tt.status}},
+				AddonOutput: &AddonOutput{},
+			}
+			m.validateStatus()
+			if tt.wantTitle == "" {
+				assert.Empty(t, m.AddonOutput.ActionItems)
+				return
+			}
+			assert.Len(t, m.AddonOutput.ActionItems, 1)
+			assert.Equal(t, tt.wantTitle, m.AddonOutput.ActionItems[0].Title)
+			assert.Contains(t, m.AddonOutput.ActionItems[0].Description, "cert-manager/cert-manager")
+			assert.Contains(t, m.AddonOutput.ActionItems[0].Description, "revision 4")
+			assert.Contains(t, m.AddonOutput.ActionItems[0].Remediation, tt.remediation)
+		})
+	}
+}
+
+func TestValidateFailedUpgrade(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      release.Status
+		deployed    bool
+		wantCurrent string
+		wantTitle   string
+	}{
+		{name: "failed upgrade", status: release.StatusFailed, deployed: true, wantCurrent: "1.7.1", wantTitle: "Release is in a failed state"},
+		{name: "stuck upgrade", status: release.StatusPendingUpgrade, deployed: true, wantCurrent: "1.7.1", wantTitle: "Release upgrade is stuck"},
+		{name: "failed install", status: release.StatusFailed, wantCurrent: "2.0.0", wantTitle: "Release is in a failed state"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			latest := helm.NewOfflineRelease("cert-manager", "cert-manager", &chart.Metadata{Name: "cert-manager", Version: "2.0.0"}, nil, "")
+			latest.Version = 2
+			latest.Info.Status = tt.status
+			revisions := []*release.Release{latest}
+			if tt.deployed {
+				revisions = append(revisions, helm.NewOfflineRelease("cert-manager", "cert-manager", &chart.Metadata{Name: "cert-manager", Version: "1.7.1"}, nil, ""))
+			}
+			h, err := helm.NewOfflineHelm(revisions, "1.25.0", []string{"apps/v1", "cert-manager.io/v1"})
+			assert.NoError(t, err)
+
+			c := &Config{Releases: h, Cluster: h, Bundle: []string{"testdata/offline.yaml"}, CacheDir: t.TempDir()}
+			o, err := c.Validate(context.Background())
+			assert.NoError(t, err)
+			assert.Len(t, o.Addons, 1)
+			assert.Equal(t, tt.wantCurrent, o.Addons[0].Versions.Current)
+			assert.Equal(t, tt.status.String(), o.Addons[0].Status)
+			assert.Equal(t, tt.deployed, len(o.Addons[0].MatchedBy) > 0, "the bundle matches the deployed revision")
+			assert.Equal(t, tt.wantTitle, o.Addons[0].ActionItems[0].Title)
+			assert.Contains(t, o.Addons[0].ActionItems[0].Description, "revision 2")
+		})
+	}
+}
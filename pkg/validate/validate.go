@@ -15,84 +15,290 @@
 package validate
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
+	"fmt"
 
+	"github.com/fairwindsops/gonogo/pkg/bundle"
 	"github.com/fairwindsops/gonogo/pkg/helm"
+	"helm.sh/helm/v3/pkg/release"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	clusterVersion "k8s.io/apimachinery/pkg/version"
+	"k8s.io/klog"
 )
 
+// ReleaseSource provides the releases to check. helm.Helm reads them from a cluster, a snapshot or a repository.
+type ReleaseSource interface {
+	// ListReleases returns the latest revision of each release to check
+	ListReleases() ([]*release.Release, error)
+	// History returns every revision of a release, oldest first
+	History(namespace, name string) []*release.Release
+	// ProviderOf returns where a release was discovered, such as helm storage or flux
+	ProviderOf(namespace, name string) string
+	// FileOf returns the file a release was declared in, or nothing when it was not read from files
+	FileOf(namespace, name string) string
+}
+
+// ClusterInfo provides what the checks read from the cluster the releases are installed in. helm.Helm reads it from
+// a cluster, or returns an error wrapping helm.ErrNoCluster for what is not known when offline.
+type ClusterInfo interface {
+	GetClusterVersion() (*clusterVersion.Info, error)
+	// GetAPIVersions returns the api group versions served by the cluster
+	GetAPIVersions() ([]string, error)
+	// ScopedNamespaces returns the namespaces cluster objects are read in, nil means every namespace
+	ScopedNamespaces() ([]string, error)
+	GetClusterObjects(group, version, resource, namespace string) ([]unstructured.Unstructured, error)
+}
+
 // Config contains the necessary pieces to run the validation
 type Config struct {
-	// Helm is an instance of the local helm package client
-	Helm *helm.Helm
+	// Releases provides the releases to check, such as a helm.Helm
+	Releases ReleaseSource
+	// Cluster provides what is read from the cluster, such as the same helm.Helm
+	Cluster ClusterInfo
 	// Bundle is the path to the bundle config file
 	Bundle []string
+	// CacheDir is the directory bundles downloaded from remote sources are cached in
+	CacheDir string
+	// Targets are the chart versions to plan upgrades to, keyed by chart name or namespace/release
+	Targets map[string]string
+	// LeastPrivilege runs with only permission to read in the namespaces of the releases. Checks that need
+	// access to the cluster that is denied are skipped and reported instead of failing the validation.
+	LeastPrivilege bool
+	// Scoring holds the weights of the upgrade confidence, DefaultScoring is used when it is nil
+	Scoring *Scoring
+	// ChartBundles merges the bundles shipped in the charts that releases are upgraded to with the other bundles
+	ChartBundles bool
+	// RenderTarget downloads the charts that releases are upgraded to and renders them with the values of the
+	// releases, to report how their objects change in ManifestDiff and let opa checks inspect the changes
+	RenderTarget bool
+	// CheckCRDs downloads the charts that releases are upgraded to and compares their crds with those in the
+	// cluster. The crds of templates are only compared when RenderTarget is set as well.
+	CheckCRDs bool
+	// DeprecatedAPIs checks the objects of the releases, those no bundle matches included, for apis that are
+	// deprecated or removed in the cluster version or TargetKubeVersion
+	DeprecatedAPIs bool
+	// TargetKubeVersion is the kubernetes version the cluster is upgraded to, if any
+	TargetKubeVersion string
+
+	// bundles are the bundles already read from Bundle, they are read by Validate when nil
+	bundles *bundle.BundleConfig
+	// charts caches the charts downloaded by targetChart, keyed by repository, name and version
+	charts map[string]loadedChart
 }
 
 // Validate finds matching releases in-cluster,
 // runs pre-defined checks against those releases, and returns an error if any checks fail
-// also returns an output string that can be printed to the user
-func (c *Config) Validate() (string, error) {
-
-	o := Output{}
+// also returns the results of the checks. Cancelling ctx stops the validation between releases.
+func (c *Config) Validate(ctx context.Context) (*Output, error) {
+	o := &Output{}
 
 	m, err := c.getMatches()
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	clusterVersion, err := c.Helm.GetClusterVersion()
+	cl, err := c.getCluster()
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	clusterAPIVersions, err := c.createVersionSlice()
-	if err != nil {
-		return "", err
+	scoring := c.Scoring
+	if scoring == nil {
+		scoring = DefaultScoring()
 	}
 
-	for _, match := range m {
-		err := match.validateValues()
+	var apis map[string]deprecatedAPI
+	var versions apiVersions
+	if c.DeprecatedAPIs {
+		apis, err = deprecatedAPIs()
 		if err != nil {
-			return "", err
+			return nil, err
 		}
-
-		err = match.runOPAChecks()
+		versions, err = c.deprecatedAPIVersions(cl)
 		if err != nil {
-			return "", err
+			return nil, err
 		}
+	}
 
-		err = match.validateClusterVersion(clusterVersion)
-		if err != nil {
-			return "", err
+	for _, match := range m {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if match.unmatched {
+			// releases no bundle matches are only reported when they are not deployed or use deprecated apis
+			match.validateStatus()
+			if apis != nil {
+				err := match.validateDeprecatedAPIs(apis, versions)
+				if err != nil {
+					return nil, err
+				}
+			}
+			if len(match.AddonOutput.ActionItems) == 0 {
+				continue
+			}
+			match.setFile()
+			scoring.score(match.AddonOutput)
+			o.Addons = append(o.Addons, match.AddonOutput)
+			continue
+		}
+		match.validateStatus()
+		match.analyzeHistory()
+		if len(match.Plan) == 0 {
+			if match.Bundle != nil {
+				c.setTarget(&match)
+				err := match.runChecks(ctx, cl)
+				if err != nil {
+					return nil, err
+				}
+			}
+			if apis != nil {
+				err := match.validateDeprecatedAPIs(apis, versions)
+				if err != nil {
+					return nil, err
+				}
+			}
+			match.setFile()
+			scoring.score(match.AddonOutput)
+			o.Addons = append(o.Addons, match.AddonOutput)
+			continue
 		}
 
-		match.validateAPIVersion(clusterAPIVersions)
-
+		for i, hop := range match.Plan {
+			// the last hop is rendered, its diff is that of the whole upgrade
+			if i == len(match.Plan)-1 {
+				c.setTarget(&hop)
+			}
+			err := hop.runChecks(ctx, cl)
+			if err != nil {
+				return nil, err
+			}
+			scoring.score(hop.AddonOutput)
+			// the findings of the hop are only listed in the plan, the release is scored with them
+			match.AddonOutput.Plan = append(match.AddonOutput.Plan, hop.AddonOutput)
+			if hop.AddonOutput.ManifestDiff != nil {
+				match.AddonOutput.ManifestDiff = hop.AddonOutput.ManifestDiff
+				match.rendered = hop.rendered
+			}
+		}
+		if apis != nil {
+			err := match.validateDeprecatedAPIs(apis, versions)
+			if err != nil {
+				return nil, err
+			}
+		}
+		match.setFile()
+		scoring.score(match.AddonOutput)
 		o.Addons = append(o.Addons, match.AddonOutput)
 	}
+	scoring.decide(o)
+	return o, nil
+}
 
-	out, err := json.MarshalIndent(o, "", " ")
-	if err != nil {
-		return "", err
-	}
+// cluster is what is known about the cluster that the checks run against
+type cluster struct {
+	version     *clusterVersion.Info
+	apiVersions []string
+	// skipped explains why checks that need the cluster can not run, keyed by the bundle field of the check
+	skipped map[string]string
+}
+
+// getCluster reads the version and api versions of the cluster. What was not given when running offline, or with
+// LeastPrivilege what can not be read for lack of permissions, is recorded so that the checks that need it are skipped.
+func (c *Config) getCluster() (cluster, error) {
+	cl := cluster{skipped: map[string]string{}}
 
-	return string(out), err
+	v, err := c.Cluster.GetClusterVersion()
+	switch {
+	case err == nil:
+		cl.version = v
+	case errors.Is(err, helm.ErrNoCluster), c.LeastPrivilege && helm.IsAccessError(err):
+		cl.skipped[bundle.FieldCompatibleK8sVersions] = fmt.Sprintf("unable to read the cluster version: %v", err)
+	default:
+		return cl, err
+	}
 
+	apiVersions, err := c.Cluster.GetAPIVersions()
+	switch {
+	case err == nil:
+		cl.apiVersions = apiVersions
+	case errors.Is(err, helm.ErrNoCluster), c.LeastPrivilege && helm.IsAccessError(err):
+		cl.skipped[bundle.FieldNecessaryAPIVersions] = fmt.Sprintf("unable to read the cluster api versions: %v", err)
+	default:
+		return cl, err
+	}
+	return cl, nil
 }
 
-func (c *Config) createVersionSlice() ([]string, error) {
-	a, err := c.Helm.Kube.Client.Discovery().ServerGroups()
+// runChecks runs every check for a match and adds the results to its AddonOutput
+func (m *match) runChecks(ctx context.Context, cl cluster) error {
+	err := m.validateValues()
 	if err != nil {
-		return nil, err
+		return err
+	}
+
+	if m.render {
+		err = m.renderTarget(cl)
+		if err != nil {
+			return err
+		}
+	}
+	if m.checkCRDs {
+		err = m.validateCRDs()
+		if err != nil {
+			return err
+		}
+	}
+
+	err = m.runOPAChecks(ctx)
+	if err != nil {
+		return err
 	}
 
-	var groupSlice []string
+	if reason, ok := cl.skipped[bundle.FieldCompatibleK8sVersions]; ok {
+		if m.Bundle.CompatibleK8sVersions != (bundle.K8sVersions{}) {
+			m.skip(bundle.FieldCompatibleK8sVersions, reason)
+		}
+	} else {
+		err = m.validateClusterVersion(cl.version)
+		if err != nil {
+			return err
+		}
+	}
+
+	if reason, ok := cl.skipped[bundle.FieldNecessaryAPIVersions]; ok {
+		if len(m.Bundle.NecessaryAPIVersions) > 0 {
+			m.skip(bundle.FieldNecessaryAPIVersions, reason)
+		}
+	} else {
+		m.validateAPIVersion(cl.apiVersions)
+	}
+	return nil
+}
 
-	for _, groups := range a.Groups {
-		for _, v := range groups.Versions {
-			groupSlice = append(groupSlice, v.GroupVersion)
+// setFile records the file the release, or the umbrella release of a subchart, was declared in on its action items,
+// those of the plan hops included
+func (m *match) setFile() {
+	rel := m.Release
+	if m.Parent != nil {
+		rel = m.Parent
+	}
+	file := m.Releases.FileOf(rel.Namespace, rel.Name)
+	if file == "" {
+		return
+	}
+	for _, item := range m.AddonOutput.ActionItems {
+		item.File = file
+	}
+	for _, hop := range m.AddonOutput.Plan {
+		for _, item := range hop.ActionItems {
+			item.File = file
 		}
 	}
+}
 
-	return groupSlice, nil
+// skip records a check that could not run
+func (m *match) skip(check, reason string) {
+	klog.V(3).Infof("skipped %s for release %s/%s: %s", check, m.Release.Namespace, m.Release.Name, reason)
+	m.AddonOutput.SkippedChecks = append(m.AddonOutput.SkippedChecks, SkippedCheck{Check: check, Reason: reason})
 }
@@ -0,0 +1,253 @@
+// Copyright 2021 FairwindsOps, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package validate
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fairwindsops/gonogo/pkg/bundle"
+	"github.com/fairwindsops/gonogo/pkg/helm"
+	"github.com/stretchr/testify/assert"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/release"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	clusterVersion "k8s.io/apimachinery/pkg/version"
+)
+
+const offlineManifest = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: cert-manager
+  annotations:
+    old: "true"
+`
+
+func TestValidateOffline(t *testing.T) {
+	tests := []struct {
+		name        string
+		kubeVersion string
+		apiVersions []string
+		values      map[string]interface{}
+		wantTitles  []string
+		wantSkipped []string
+	}{
+		{
+			name:        "nothing declared",
+			wantTitles:  []string{"old annotation"},
+			wantSkipped: []string{bundle.FieldOpaChecks, bundle.FieldCompatibleK8sVersions, bundle.FieldNecessaryAPIVersions},
+		},
+		{
+			name:        "everything declared",
+			kubeVersion: "1.27.3",
+			apiVersions: []string{"apps/v1"},
+			values:      map[string]interface{}{"replicaCount": "two"},
+			wantTitles:  []string{"Failed Schema Validation", "old annotation", "Unsupported cluster version", "API version cert-manager.io/v1 is not available"},
+			wantSkipped: []string{bundle.FieldOpaChecks},
+		},
+		{
+			name:        "compatible cluster",
+			kubeVersion: "1.25.0",
+			apiVersions: []string{"apps/v1", "cert-manager.io/v1"},
+			values:      map[string]interface{}{"replicaCount": 2},
+			wantTitles:  []string{"old annotation"},
+			wantSkipped: []string{bundle.FieldOpaChecks},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rel := helm.NewOfflineRelease("cert-manager", "cert-manager", &chart.Metadata{Name: "cert-manager", Version: "1.7.1"}, tt.values, offlineManifest)
+			h, err := helm.NewOfflineHelm([]*release.Release{rel}, tt.kubeVersion, tt.apiVersions)
+			assert.NoError(t, err)
+
+			c := &Config{Releases: h, Cluster: h, Bundle: []string{"testdata/offline.yaml"}, CacheDir: t.TempDir()}
+			o, err := c.Validate(context.Background())
+			assert.NoError(t, err)
+			assert.Len(t, o.Addons, 1)
+			var titles, skipped []string
+			for _, ai := range o.Addons[0].ActionItems {
+				titles = append(titles, ai.Title)
+			}
+			for _, s := range o.Addons[0].SkippedChecks {
+				skipped = append(skipped, s.Check)
+			}
+			assert.Equal(t, tt.wantTitles, titles)
+			assert.Equal(t, tt.wantSkipped, skipped)
+		})
+	}
+}
+
+func TestValidateRepo(t *testing.T) {
+	dir := t.TempDir()
+	helmfile := filepath.Join(dir, "helmfile.yaml")
+	assert.NoError(t, os.WriteFile(helmfile, []byte(`
+releases:
+- name: cert-manager
+  namespace: cert-manager
+  chart: jetstack/cert-manager
+  version: 1.7.1
+  values:
+  - replicaCount: two
+`), 0644))
+
+	h, err := helm.NewRepoHelm(dir, "1.27.3", nil)
+	assert.NoError(t, err)
+	c := &Config{Releases: h, Cluster: h, Bundle: []string{"testdata/offline.yaml"}, CacheDir: t.TempDir()}
+	o, err := c.Validate(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, o.Addons, 1)
+	assert.NotEmpty(t, o.Addons[0].ActionItems)
+	for _, ai := range o.Addons[0].ActionItems {
+		assert.Equal(t, helmfile, ai.File, ai.Title)
+	}
+}
+
+// staticReleases is a ReleaseSource of fixed releases, the way gonogo is embedded in other tools
+type staticReleases []*release.Release
+
+func (s staticReleases) ListReleases() ([]*release.Release, error)         { return s, nil }
+func (s staticReleases) History(namespace, name string) []*release.Release { return nil }
+func (s staticReleases) ProviderOf(namespace, name string) string          { return "inventory" }
+func (s staticReleases) FileOf(namespace, name string) string              { return "" }
+
+// staticCluster is a ClusterInfo of a cluster that serves every api and has no objects
+type staticCluster string
+
+func (c staticCluster) GetClusterVersion() (*clusterVersion.Info, error) {
+	return &clusterVersion.Info{GitVersion: string(c)}, nil
+}
+func (c staticCluster) GetAPIVersions() ([]string, error) {
+	return []string{"apps/v1", "cert-manager.io/v1"}, nil
+}
+func (c staticCluster) ScopedNamespaces() ([]string, error) { return nil, nil }
+func (c staticCluster) GetClusterObjects(group, version, resource, namespace string) ([]unstructured.Unstructured, error) {
+	return nil, nil
+}
+
+func TestValidateCustomSource(t *testing.T) {
+	rel := helm.NewOfflineRelease("cert-manager", "cert-manager", &chart.Metadata{Name: "cert-manager", Version: "1.7.1"}, map[string]interface{}{"replicaCount": 2}, offlineManifest)
+	c := &Config{
+		Releases: staticReleases{rel},
+		Cluster:  staticCluster("v1.27.3"),
+		Bundle:   []string{"testdata/offline.yaml"},
+		CacheDir: t.TempDir(),
+	}
+	o, err := c.Validate(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, o.Addons, 1)
+	assert.Equal(t, "inventory", o.Addons[0].DiscoveredBy)
+	assert.Empty(t, o.Addons[0].SkippedChecks)
+	var titles []string
+	for _, ai := range o.Addons[0].ActionItems {
+		titles = append(titles, ai.Title)
+	}
+	assert.Equal(t, []string{"old annotation", "Unsupported cluster version"}, titles)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = c.Validate(ctx)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestValidatePlan(t *testing.T) {
+	bundles := filepath.Join(t.TempDir(), "plan.yaml")
+	assert.NoError(t, os.WriteFile(bundles, []byte(`addons:
+  - name: cert-manager
+    versions:
+      start: 1.7.0
+      end: 1.8.0
+    source:
+      chart: cert-manager
+    warnings:
+      - first hop
+  - name: cert-manager
+    versions:
+      start: 1.8.0
+      end: 1.9.0
+    source:
+      chart: cert-manager
+    compatible_k8s_versions:
+      max: "1.26"
+    warnings:
+      - second hop
+`), 0o644))
+	rel := helm.NewOfflineRelease("cert-manager", "cert-manager", &chart.Metadata{Name: "cert-manager", Version: "1.7.1"}, nil, offlineManifest)
+	c := &Config{
+		Releases: staticReleases{rel},
+		Cluster:  staticCluster("v1.27.3"),
+		Bundle:   []string{bundles},
+		CacheDir: t.TempDir(),
+		Targets:  map[string]string{"cert-manager": "1.9.0"},
+	}
+	o, err := c.Validate(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, o.Addons, 1)
+	a := o.Addons[0]
+	assert.Empty(t, a.ActionItems, "the findings of the hops are only listed in the plan")
+	assert.Empty(t, a.Warnings)
+	assert.Len(t, a.Plan, 2)
+	assert.Equal(t, []string{"first hop"}, a.Plan[0].Warnings)
+	assert.Equal(t, []string{"second hop"}, a.Plan[1].Warnings)
+	assert.Len(t, a.Plan[1].ActionItems, 1)
+	assert.Equal(t, "Unsupported cluster version", a.Plan[1].ActionItems[0].Title)
+
+	var reasons []string
+	for _, f := range a.ConfidenceFactors {
+		reasons = append(reasons, f.Reason)
+	}
+	assert.Len(t, reasons, 3, "each finding of the plan is scored once: %v", reasons)
+	assert.Contains(t, reasons, `hop 1.7.1 to 1.8.0: warning "first hop"`)
+	assert.Contains(t, reasons, `hop 1.8.0 to 1.9.0: warning "second hop"`)
+	assert.Less(t, a.UpgradeConfidence, a.Plan[0].UpgradeConfidence)
+}
+
+func TestValidateUmbrella(t *testing.T) {
+	rel := helm.NewOfflineRelease("platform", "infra", &chart.Metadata{
+		Name:    "platform",
+		Version: "0.1.0",
+		Dependencies: []*chart.Dependency{
+			{Name: "cert-manager", Alias: "certs", Version: "1.7.1"},
+			{Name: "ingress-nginx", Version: "4.0.1"},
+		},
+	}, map[string]interface{}{"certs": map[string]interface{}{"replicaCount": "two"}}, `---
+# Source: platform/charts/certs/templates/deployment.yaml
+`+offlineManifest+`---
+# Source: platform/templates/deployment.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: platform
+  annotations:
+    old: "true"
+`)
+	h, err := helm.NewOfflineHelm([]*release.Release{rel}, "1.25.0", []string{"apps/v1", "cert-manager.io/v1"})
+	assert.NoError(t, err)
+
+	c := &Config{Releases: h, Cluster: h, Bundle: []string{"testdata/offline.yaml"}, CacheDir: t.TempDir()}
+	o, err := c.Validate(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, o.Addons, 1)
+	assert.Equal(t, "platform/certs", o.Addons[0].Name)
+	assert.Equal(t, "1.7.1", o.Addons[0].Versions.Current)
+	var titles, resources []string
+	for _, ai := range o.Addons[0].ActionItems {
+		titles = append(titles, ai.Title)
+		resources = append(resources, ai.ResourceName)
+	}
+	assert.Equal(t, []string{"Failed Schema Validation", "old annotation"}, titles)
+	assert.Equal(t, []string{"platform/certs", "cert-manager"}, resources)
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 
 	"github.com/blang/semver/v4"
+	"github.com/fairwindsops/gonogo/pkg/bundle"
 	"github.com/thoas/go-funk"
 	clusterVersion "k8s.io/apimachinery/pkg/version"
 	"k8s.io/klog"
@@ -29,6 +30,11 @@ func (m *match) validateClusterVersion(cv *clusterVersion.Info) error {
 				ResourceName:      m.Release.Name,
 				Title:             "Unsupported cluster version",
 				Description:       "The Kubernetes cluster version is greater than the maximum version specified in the bundle spec",
+				EventType:         "unsupportedClusterVersion",
+				Severity:          "critical",
+				Category:          "Reliability",
+				Report:            "gonogo",
+				Origin:            m.Bundle.OriginOf(bundle.FieldCompatibleK8sVersions, ""),
 			})
 		}
 	}
@@ -44,9 +50,32 @@ func (m *match) validateClusterVersion(cv *clusterVersion.Info) error {
 				ResourceName:      m.Release.Name,
 				Title:             "Unsupported cluster version",
 				Description:       "The Kubernetes cluster version is less than the minimum version specified in the bundle spec",
+				EventType:         "unsupportedClusterVersion",
+				Severity:          "critical",
+				Category:          "Reliability",
+				Report:            "gonogo",
+				Origin:            m.Bundle.OriginOf(bundle.FieldCompatibleK8sVersions, ""),
 			})
 		}
 	}
+
+	ok, err := m.Bundle.CompatibleK8sVersions.AllowsCluster(cv.String())
+	if err != nil {
+		return err
+	}
+	if !ok {
+		m.AddonOutput.ActionItems = append(m.AddonOutput.ActionItems, &ActionItem{
+			ResourceNamespace: m.Release.Namespace,
+			ResourceName:      m.Release.Name,
+			Title:             "Unsupported cluster version",
+			Description:       fmt.Sprintf("The Kubernetes cluster version does not satisfy the constraint %s specified in the bundle spec", m.Bundle.CompatibleK8sVersions.Constraint),
+			EventType:         "unsupportedClusterVersion",
+			Severity:          "critical",
+			Category:          "Reliability",
+			Report:            "gonogo",
+			Origin:            m.Bundle.OriginOf(bundle.FieldCompatibleK8sVersions, ""),
+		})
+	}
 	return nil
 }
 
@@ -60,6 +89,11 @@ func (m *match) validateAPIVersion(v []string) {
 				ResourceName:      m.Release.Name,
 				Title:             fmt.Sprintf("API version %s is not available", av),
 				Description:       fmt.Sprintf("The Kubernetes cluster version does not contain the api %s", av),
+				EventType:         "apiVersionUnavailable",
+				Severity:          "critical",
+				Category:          "Reliability",
+				Report:            "gonogo",
+				Origin:            m.Bundle.OriginOf(bundle.FieldNecessaryAPIVersions, av),
 			})
 		} else {
 			klog.V(5).Infof("found required apiversion %s", av)